@@ -1,24 +1,185 @@
 package app
 
 import (
+	"context"
+	"fmt"
+
+	"yatter-backend-go/app/bucket"
 	"yatter-backend-go/app/config"
 	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/feed"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/mailer"
+	"yatter-backend-go/app/metrics"
+	"yatter-backend-go/app/migration"
+	"yatter-backend-go/app/secret"
+	"yatter-backend-go/app/snowflake"
+	"yatter-backend-go/ddl"
+
+	"github.com/gomodule/redigo/redis"
 )
 
+// Number of emails waiting to be sent in the background
+const mailQueueSize = 100
+
 // Dependency manager for whole application
 type App struct {
+	// Settings loaded on start
+	Config *config.Config
+
 	Dao dao.Dao
+
+	// Home timelines cached by fan-out on write
+	HomeFeed *feed.Home
+
+	// Token buckets of rate limits
+	RateLimits bucket.Store
+
+	// Sender of emails to accounts
+	Mailer mailer.Mailer
+
+	// Mailer sending in the background, drained by Shutdown
+	mails *mailer.Async
+
+	// Encrypter of TOTP secrets, nil if no key is configured
+	Secrets *secret.Box
 }
 
 // Create dependency manager
-func NewApp() (*App, error) {
-	// panic if lacking something
-	daoCfg := config.MySQLConfig()
+func NewApp(cfg *config.Config) (*App, error) {
+	if cfg.Database.ShouldMigrateOnStart() {
+		if err := migrate(cfg.Database.Primary()); err != nil {
+			return nil, err
+		}
+	}
 
-	dao, err := dao.New(daoCfg)
+	secrets, err := newSecrets(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &App{Dao: dao}, nil
+	dao, err := NewDao(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool *redis.Pool
+	if url := cfg.Redis.URL; url != "" {
+		pool = feed.NewRedisPool(url)
+	}
+	mails := mailer.NewAsync(newMailer(cfg), mailQueueSize)
+	return &App{
+		Config:     cfg,
+		Dao:        dao,
+		HomeFeed:   newHomeFeed(cfg, dao, pool),
+		RateLimits: newRateLimits(cfg, pool),
+		Mailer:     mails,
+		mails:      mails,
+		Secrets:    secrets,
+	}, nil
+}
+
+// Wait until the work left in the background, like emails to send, is done or ctx is done
+func (a *App) Shutdown(ctx context.Context) error {
+	if a.mails == nil {
+		return nil
+	}
+	return a.mails.Shutdown(ctx)
+}
+
+// Release connections held by the application
+func (a *App) Close() error {
+	return a.Dao.Close()
+}
+
+// Create DAO with the databases, pool settings and snowflake node in cfg.
+// Its connection pools and repository methods are observed by metrics.
+func NewDao(cfg *config.Config) (dao.Dao, error) {
+	pool := dao.PoolConfig{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+	}
+	ids, err := snowflake.New(cfg.Snowflake.NodeNumber())
+	if err != nil {
+		return nil, err
+	}
+	d, err := dao.New(cfg.Database.Primary(), cfg.Database.Replica(), pool, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range dao.Collectors(d) {
+		if err := metrics.Registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return dao.Instrument(d), nil
+}
+
+// Create home feed stored in Redis if configured, or in memory otherwise
+func newHomeFeed(cfg *config.Config, d dao.Dao, pool *redis.Pool) *feed.Home {
+	size := cfg.Feed.HomeSize
+	cache := feed.NewMemory(size)
+	if pool != nil {
+		cache = feed.NewRedis(pool, size)
+	}
+	return feed.NewHome(d, cache, size)
+}
+
+// Create store of rate limits in the place configured
+func newRateLimits(cfg *config.Config, pool *redis.Pool) bucket.Store {
+	if cfg.RateLimit.Store == config.RateLimitRedis {
+		return bucket.NewRedis(pool)
+	}
+	return bucket.NewMemory()
+}
+
+// Create mailer with the driver configured
+func newMailer(cfg *config.Config) mailer.Mailer {
+	m := cfg.Mail
+	switch m.Driver {
+	case config.MailSMTP:
+		return mailer.NewSMTP(m.SMTP.Host, m.SMTP.Port, m.SMTP.Username, m.SMTP.Password, m.From)
+	case config.MailFile:
+		return mailer.NewFile(m.Dir, m.From)
+	}
+	return mailer.NewLog(m.From)
+}
+
+// Create encrypter with the key of two-factor authentication, nil if it is not configured
+func newSecrets(cfg *config.Config) (*secret.Box, error) {
+	if cfg.TwoFactor.EncryptionKey == "" {
+		return nil, nil
+	}
+	key, err := secret.ParseKey(cfg.TwoFactor.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return secret.New(key)
+}
+
+// Apply pending migrations
+func migrate(daoCfg dao.DBConfig) error {
+	db, err := dao.Open(daoCfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrations, err := ddl.Migrations(daoCfg.DriverName())
+	if err != nil {
+		return err
+	}
+	m, err := migration.New(db, migrations)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	for _, a := range applied {
+		logger.Default().Info("applied migration", "version", a.Version, "name", a.Name)
+	}
+	return nil
 }
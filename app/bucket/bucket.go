@@ -0,0 +1,93 @@
+// Package bucket keeps token buckets which limit how often each client may do something.
+package bucket
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+type (
+	// Store of token buckets by key
+	Store interface {
+		// Take a token from the bucket of key with limit l at now, creating a full bucket if there is none
+		Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error)
+
+		// Check the bucket of key with limit l at now without taking a token.
+		// Allowed tells whether Take would take one.
+		Peek(ctx context.Context, key string, l Limit, now time.Time) (Result, error)
+	}
+
+	// Size of buckets, holding up to Requests tokens and refilled by Requests tokens over Per
+	Limit struct {
+		Requests int
+		Per      time.Duration
+	}
+
+	// Result of taking a token
+	Result struct {
+		// Whether a token was taken
+		Allowed bool
+
+		// Tokens left in the bucket
+		Remaining int
+
+		// Time until the bucket is full
+		Reset time.Duration
+
+		// Time until a token is available, 0 if Allowed
+		RetryAfter time.Duration
+	}
+)
+
+// Whether l limits anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// Tokens refilled in d
+func (l Limit) refill(d time.Duration) float64 {
+	return float64(d) * float64(l.Requests) / float64(l.Per)
+}
+
+// Time to refill n tokens
+func (l Limit) duration(n float64) time.Duration {
+	return time.Duration(math.Ceil(n * float64(l.Per) / float64(l.Requests)))
+}
+
+// Take a token from the bucket which had tokens elapsed ago.
+// Returns the result and the tokens left.
+func take(l Limit, tokens float64, elapsed time.Duration) (Result, float64) {
+	tokens = refilled(l, tokens, elapsed)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	return result(l, allowed, tokens), tokens
+}
+
+// Check the bucket which had tokens elapsed ago without taking a token
+func peek(l Limit, tokens float64, elapsed time.Duration) Result {
+	tokens = refilled(l, tokens, elapsed)
+	return result(l, tokens >= 1, tokens)
+}
+
+// Tokens in the bucket which had tokens elapsed ago
+func refilled(l Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed > 0 {
+		tokens = math.Min(float64(l.Requests), tokens+l.refill(elapsed))
+	}
+	return tokens
+}
+
+func result(l Limit, allowed bool, tokens float64) Result {
+	r := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     l.duration(float64(l.Requests) - tokens),
+	}
+	if !allowed {
+		r.RetryAfter = l.duration(1 - tokens)
+	}
+	return r
+}
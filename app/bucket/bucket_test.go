@@ -0,0 +1,82 @@
+package bucket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+	"yatter-backend-go/app/bucket"
+	"yatter-backend-go/app/feed"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// 同じテストをメモリとRedisの実装で実行する
+func implementations(t *testing.T) map[string]bucket.Store {
+	s := miniredis.RunT(t)
+	return map[string]bucket.Store{
+		"Memory": bucket.NewMemory(),
+		"Redis":  bucket.NewRedis(feed.NewRedisPool("redis://" + s.Addr())),
+	}
+}
+
+func TestTake(t *testing.T) {
+	ctx := context.Background()
+	l := bucket.Limit{Requests: 2, Per: 10 * time.Second}
+	start := time.Unix(1600000000, 0)
+
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			take := func(key string, after time.Duration) bucket.Result {
+				res, err := s.Take(ctx, key, l, start.Add(after))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return res
+			}
+
+			assert.Equal(t, bucket.Result{Allowed: true, Remaining: 1, Reset: 5 * time.Second}, take("a", 0))
+			assert.Equal(t, bucket.Result{Allowed: true, Remaining: 0, Reset: 10 * time.Second}, take("a", 0))
+
+			// 空になったら次のトークンまで待つ
+			assert.Equal(t, bucket.Result{Allowed: false, Remaining: 0, Reset: 9 * time.Second, RetryAfter: 4 * time.Second}, take("a", time.Second))
+
+			// キーごとに別のバケツ
+			assert.True(t, take("b", time.Second).Allowed)
+
+			// 時間が経つと補充される
+			assert.Equal(t, bucket.Result{Allowed: true, Remaining: 0, Reset: 9 * time.Second}, take("a", 6*time.Second))
+			assert.Equal(t, bucket.Result{Allowed: true, Remaining: 1, Reset: 5 * time.Second}, take("a", time.Hour))
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	ctx := context.Background()
+	l := bucket.Limit{Requests: 2, Per: 10 * time.Second}
+	start := time.Unix(1600000000, 0)
+
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			peek := func(after time.Duration) bucket.Result {
+				res, err := s.Peek(ctx, "a", l, start.Add(after))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return res
+			}
+
+			// バケツがなければ満杯で、見てもトークンは減らない
+			assert.Equal(t, bucket.Result{Allowed: true, Remaining: 2}, peek(0))
+			assert.Equal(t, bucket.Result{Allowed: true, Remaining: 2}, peek(0))
+
+			for i := 0; i < 2; i++ {
+				if _, err := s.Take(ctx, "a", l, start); err != nil {
+					t.Fatal(err)
+				}
+			}
+			assert.Equal(t, bucket.Result{Allowed: false, Remaining: 0, Reset: 9 * time.Second, RetryAfter: 4 * time.Second}, peek(time.Second))
+			assert.Equal(t, bucket.Result{Allowed: true, Remaining: 1, Reset: 4 * time.Second}, peek(6*time.Second))
+		})
+	}
+}
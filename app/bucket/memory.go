@@ -0,0 +1,76 @@
+package bucket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Interval between sweeps of full buckets
+const sweepInterval = time.Minute
+
+type (
+	// Implementation of Store in memory of the process
+	memory struct {
+		mu      sync.Mutex
+		buckets map[string]*memoryBucket
+		swept   time.Time
+	}
+
+	memoryBucket struct {
+		tokens float64
+
+		// when tokens were counted
+		at time.Time
+
+		// when the bucket gets full, and may be dropped
+		full time.Time
+	}
+)
+
+// Create store of buckets kept in memory of the process
+func NewMemory() Store {
+	return &memory{buckets: make(map[string]*memoryBucket)}
+}
+
+func (m *memory) Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(l.Requests), at: now}
+		m.buckets[key] = b
+	}
+	res, tokens := take(l, b.tokens, now.Sub(b.at))
+	b.tokens = tokens
+	b.at = now
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+func (m *memory) Peek(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		return peek(l, float64(l.Requests), 0), nil
+	}
+	return peek(l, b.tokens, now.Sub(b.at)), nil
+}
+
+// Drop full buckets, which are the same as missing ones
+func (m *memory) sweep(now time.Time) {
+	if now.Sub(m.swept) < sweepInterval {
+		return
+	}
+	m.swept = now
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+type (
+	// Implementation of Store in Redis, shared by processes
+	redisStore struct {
+		pool *redis.Pool
+	}
+)
+
+// Take a token from the bucket of KEYS[1] holding ARGV[1] tokens and refilled over ARGV[2] ms, at ARGV[3] ms.
+// Returns whether a token was taken and the tokens left as a string, as Redis truncates numbers to integers.
+var takeScript = redis.NewScript(1, `
+local capacity = tonumber(ARGV[1])
+local per = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = capacity
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+if b[1] then
+	local elapsed = math.max(0, now - tonumber(b[2]))
+	tokens = math.min(capacity, tonumber(b[1]) + elapsed * capacity / per)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'at', now)
+redis.call('PEXPIRE', KEYS[1], per)
+return {allowed, tostring(tokens)}
+`)
+
+// Create store of buckets in Redis
+func NewRedis(pool *redis.Pool) Store {
+	return &redisStore{pool: pool}
+}
+
+func (r *redisStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	defer conn.Close()
+
+	// the bucket is full when it expires
+	per := l.Per.Milliseconds()
+	if per < 1 {
+		per = 1
+	}
+	reply, err := redis.Values(takeScript.Do(conn, "ratelimit:"+key, l.Requests, per, now.UnixNano()/int64(time.Millisecond)))
+	if err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	var allowed int
+	var s string
+	if _, err := redis.Scan(reply, &allowed, &s); err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	return result(l, allowed == 1, tokens), nil
+}
+
+func (r *redisStore) Peek(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	defer conn.Close()
+
+	reply, err := redis.Strings(conn.Do("HMGET", "ratelimit:"+key, "tokens", "at"))
+	if err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	// 期限切れで消えたバケツは満杯
+	if reply[0] == "" {
+		return peek(l, float64(l.Requests), 0), nil
+	}
+	tokens, err := strconv.ParseFloat(reply[0], 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	at, err := strconv.ParseInt(reply[1], 10, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w", err)
+	}
+	elapsed := time.Duration(now.UnixNano()/int64(time.Millisecond)-at) * time.Millisecond
+	return peek(l, tokens, elapsed), nil
+}
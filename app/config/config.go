@@ -1,41 +1,392 @@
+// Package config builds the settings of the application from a YAML file,
+// environment variables and command-line flags, in increasing precedence.
 package config
 
 import (
-	"fmt"
-	"os"
-	"strconv"
+	"net"
+	"net/http"
+	"time"
+	"yatter-backend-go/app/bucket"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/tracing"
 )
 
+// Settings of the whole application.
+//
+// Each field is read from its yaml key in the file, the env variable, and the flag
+// named by the dotted yaml keys like -server.port. Fields tagged secret are redacted by Redacted.
+type Config struct {
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	Redis         RedisConfig         `yaml:"redis"`
+	Feed          FeedConfig          `yaml:"feed"`
+	Media         MediaConfig         `yaml:"media"`
+	CORS          CORSConfig          `yaml:"cors"`
+	Security      SecurityConfig      `yaml:"security"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	Registrations RegistrationsConfig `yaml:"registrations"`
+	Accounts      AccountsConfig      `yaml:"accounts"`
+	TwoFactor     TwoFactorConfig     `yaml:"two_factor"`
+	Mail          MailConfig          `yaml:"mail"`
+	Log           LogConfig           `yaml:"log"`
+	Tracing       TracingConfig       `yaml:"tracing"`
+	Snowflake     SnowflakeConfig     `yaml:"snowflake"`
+
+	// URL the clients access the server at, like https://yatter.example.com.
+	// Links in responses are built from the request if empty.
+	PublicURL string `yaml:"public_url" env:"PUBLIC_URL"`
+}
+
+// Settings of the HTTP server
+type ServerConfig struct {
+	// Port to listen on
+	Port int `yaml:"port" env:"PORT"`
+
+	// Maximum time to read the headers of a request
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+
+	// Maximum time to read a whole request, including uploaded files
+	ReadTimeout time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+
+	// Maximum time to write a response.
+	// It should be longer than the timeout of handlers (60s) to respond with their errors.
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+
+	// Maximum time to keep an idle connection
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+
+	// Maximum bytes of the headers of a request
+	MaxHeaderBytes int `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+
+	// Maximum time to wait for requests in flight on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+
+	// Number of instances serving the same database.
+	// State kept in memory is not shared, so more than one instance needs Redis.
+	Instances int `yaml:"instances" env:"SERVER_INSTANCES"`
+
+	// Addresses or CIDR ranges of reverse proxies, like 10.0.0.0/8.
+	// X-Forwarded-For, X-Real-IP and X-Forwarded-Proto are honored only from them.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	// Address to serve metrics on apart from the API, like 127.0.0.1:9090.
+	// Metrics are not served if empty.
+	AdminAddr string `yaml:"admin_addr" env:"SERVER_ADMIN_ADDR"`
+}
+
+// Settings of Redis
+type RedisConfig struct {
+	// URL of Redis, e.g. redis://localhost:6379/0. Redis is not used if empty.
+	URL string `yaml:"url" env:"REDIS_URL" secret:"url"`
+}
+
+// Settings of home feeds
+type FeedConfig struct {
+	// Maximum number of statuses kept in the cached home feed of each account
+	HomeSize int `yaml:"home_size" env:"HOME_FEED_SIZE"`
+}
+
+// Settings of uploaded media
+type MediaConfig struct {
+	// Maximum bytes of a request uploading media, avatars or headers
+	MaxUploadBytes int64 `yaml:"max_upload_bytes" env:"MEDIA_MAX_UPLOAD_BYTES"`
+
+	// Interval between runs of attachment garbage collection
+	GCInterval time.Duration `yaml:"gc_interval" env:"ATTACHMENT_GC_INTERVAL"`
+
+	// How long an attachment not used by any status is kept
+	MaxAge time.Duration `yaml:"max_age" env:"ATTACHMENT_MAX_AGE"`
+}
+
+// Settings of Cross-Origin Resource Sharing
+type CORSConfig struct {
+	// Origins allowed to call the API, like https://yatter.example.com, or * for any.
+	// Cross-origin requests are not allowed if empty.
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+
+	// Request headers allowed in cross-origin requests, or * for any
+	AllowedHeaders []string `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+
+	// Methods allowed in cross-origin requests
+	AllowedMethods []string `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+
+	// Whether to allow requests with cookies or HTTP authentication.
+	// Origins must be listed explicitly to allow them.
+	AllowCredentials bool `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+
+	// How long browsers may cache the result of a preflight request, not sent if 0
+	MaxAge time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// Settings of security headers in responses
+type SecurityConfig struct {
+	// Content-Security-Policy header, not sent if empty
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"CONTENT_SECURITY_POLICY"`
+
+	// Referrer-Policy header, not sent if empty
+	ReferrerPolicy string `yaml:"referrer_policy" env:"REFERRER_POLICY"`
+
+	// max-age of Strict-Transport-Security header sent to requests over TLS, not sent if 0
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE"`
+
+	// Whether HSTS also applies to subdomains
+	HSTSIncludeSubdomains bool `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS"`
+}
+
+// Stores of rate limits
+const (
+	RateLimitMemory = "memory"
+	RateLimitRedis  = "redis"
+)
+
+// Settings of rate limits.
+// Each client has a token bucket per group, holding up to Requests tokens refilled over Per.
+type RateLimitConfig struct {
+	// Where buckets are kept, memory of the process or redis at redis.url shared by processes
+	Store string `yaml:"store" env:"RATE_LIMIT_STORE"`
+
+	// Creating accounts, by IP address
+	AccountCreation RateLimitRule `yaml:"account_creation" env:"RATE_LIMIT_ACCOUNT_CREATION"`
+
+	// Posting statuses and uploading media, by account
+	Post RateLimitRule `yaml:"post" env:"RATE_LIMIT_POST"`
+
+	// GET requests, by Authentication header or IP address without it
+	Read RateLimitRule `yaml:"read" env:"RATE_LIMIT_READ"`
+
+	// Logging in with passwords and second factors, by IP address
+	Login RateLimitRule `yaml:"login" env:"RATE_LIMIT_LOGIN"`
+
+	// Wrong TOTP or recovery codes in logging in, by account, counting only failures
+	LoginCode RateLimitRule `yaml:"login_code" env:"RATE_LIMIT_LOGIN_CODE"`
+}
+
+// Limit of a group of requests, disabled if Requests is 0.
+// Env variables are named after the group, like RATE_LIMIT_POST_REQUESTS.
+type RateLimitRule struct {
+	Requests int           `yaml:"requests" env:"REQUESTS"`
+	Per      time.Duration `yaml:"per" env:"PER"`
+}
+
+// Size of token buckets of r
+func (r RateLimitRule) Limit() bucket.Limit {
+	return bucket.Limit{Requests: r.Requests, Per: r.Per}
+}
+
+// Modes of registrations
+const (
+	// Anyone can create an account, which gets confirmed by its email
+	RegistrationsOpen = "open"
+
+	// Accounts also need approval by an administrator
+	RegistrationsApproval = "approval"
+
+	// No account can be created
+	RegistrationsClosed = "closed"
+)
+
+// Settings of creating accounts
+type RegistrationsConfig struct {
+	// Who can create accounts, open, approval or closed
+	Mode string `yaml:"mode" env:"REGISTRATIONS_MODE"`
+
+	// How long a token to confirm an email is valid
+	ConfirmationTTL time.Duration `yaml:"confirmation_ttl" env:"CONFIRMATION_TTL"`
+}
+
+// Settings of managing existing accounts
+type AccountsConfig struct {
+	// How long a token to reset a password is valid
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+
+	// Interval to purge data of deleted accounts
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"ACCOUNT_PURGE_INTERVAL"`
+
+	// How long an access token issued by logging in is valid
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+}
+
+// Settings of two-factor authentication by TOTP
+type TwoFactorConfig struct {
+	// Key to encrypt TOTP secrets stored in the database, 32 bytes in base64
+	// like the output of `openssl rand -base64 32`.
+	// Accounts cannot enable two-factor authentication without it.
+	EncryptionKey string `yaml:"encryption_key" env:"TWO_FACTOR_ENCRYPTION_KEY" secret:"true"`
+
+	// Name of the service shown by authenticator apps
+	Issuer string `yaml:"issuer" env:"TWO_FACTOR_ISSUER"`
+}
+
+// Drivers of mail
 const (
-	portKey     = "PORT"
-	defaultPort = 8080
+	MailSMTP = "smtp"
+	MailFile = "file"
+	MailLog  = "log"
 )
 
-// Read port to listen on
-func Port() int {
-	num, err := getInt(portKey)
-	if err != nil {
-		return defaultPort
+// Settings of sending emails
+type MailConfig struct {
+	// How to send emails: smtp, file to write them to files in dir, or log to write them to logs
+	Driver string `yaml:"driver" env:"MAIL_DRIVER"`
+
+	// Address emails are sent from
+	From string `yaml:"from" env:"MAIL_FROM"`
+
+	// Directory of emails written by the file driver
+	Dir string `yaml:"dir" env:"MAIL_DIR"`
+
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+// Settings of the SMTP server
+type SMTPConfig struct {
+	Host string `yaml:"host" env:"SMTP_HOST"`
+	Port int    `yaml:"port" env:"SMTP_PORT"`
+
+	// User authenticated by PLAIN, no authentication if empty
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// Settings of logs
+type LogConfig struct {
+	// Minimum level of logs written, one of debug, info, warn and error
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+
+	// Format of logs, json or logfmt
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// Settings of tracing
+type TracingConfig struct {
+	// Exporter of spans, otlp or stdout. Spans are not recorded if empty.
+	Exporter string `yaml:"exporter" env:"TRACE_EXPORTER"`
+}
+
+// Settings of status IDs
+type SnowflakeConfig struct {
+	// Node number in status IDs generated by this process, or NodeUnset.
+	// Processes sharing a database at the same time should have distinct numbers,
+	// so it is required when server.instances is more than 1.
+	Node int64 `yaml:"node" env:"SNOWFLAKE_NODE"`
+}
+
+// Node number not set, 0 is used for the only instance
+const NodeUnset = -1
+
+// Create settings with the default values
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:              8080,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+			WriteTimeout:      90 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+			Instances:         1,
+			AdminAddr:         "127.0.0.1:9090",
+		},
+		Database: DatabaseConfig{
+			Driver:          DriverMySQL,
+			MaxOpenConns:    10,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 10 * time.Second,
+			Postgres:        PostgresDB{SSLMode: "disable"},
+			SQLite:          SQLiteDB{Path: "yatter.db"},
+		},
+		Feed: FeedConfig{HomeSize: 800},
+		Media: MediaConfig{
+			MaxUploadBytes: 32 << 20,
+			GCInterval:     time.Hour,
+			MaxAge:         24 * time.Hour,
+		},
+		CORS: CORSConfig{
+			AllowedHeaders: []string{"Accept", "Authentication", "Content-Type"},
+			AllowedMethods: []string{
+				http.MethodGet,
+				http.MethodHead,
+				http.MethodPut,
+				http.MethodPatch,
+				http.MethodPost,
+				http.MethodDelete,
+			},
+		},
+		Security: SecurityConfig{
+			// APIはHTMLを返さないので、何も読み込ませない
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			ReferrerPolicy:        "no-referrer",
+			HSTSMaxAge:            365 * 24 * time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Store:           RateLimitMemory,
+			AccountCreation: RateLimitRule{Requests: 5, Per: 30 * time.Minute},
+			Post:            RateLimitRule{Requests: 30, Per: 5 * time.Minute},
+			Read:            RateLimitRule{Requests: 300, Per: 5 * time.Minute},
+			Login:           RateLimitRule{Requests: 10, Per: 5 * time.Minute},
+			LoginCode:       RateLimitRule{Requests: 5, Per: 15 * time.Minute},
+		},
+		Registrations: RegistrationsConfig{
+			Mode:            RegistrationsOpen,
+			ConfirmationTTL: 24 * time.Hour,
+		},
+		Accounts: AccountsConfig{
+			PasswordResetTTL: time.Hour,
+			PurgeInterval:    time.Minute,
+			AccessTokenTTL:   30 * 24 * time.Hour,
+		},
+		TwoFactor: TwoFactorConfig{Issuer: "Yatter"},
+		Mail: MailConfig{
+			Driver: MailLog,
+			From:   "yatter@localhost",
+			Dir:    "mail",
+			SMTP:   SMTPConfig{Port: 587},
+		},
+		Log: LogConfig{Level: "info", Format: string(logger.FormatJSON)},
+		Tracing: TracingConfig{
+			Exporter: tracing.ExporterNone,
+		},
+		Snowflake: SnowflakeConfig{
+			Node: NodeUnset,
+		},
 	}
-	return num
 }
 
-func getInt(key string) (int, error) {
-	v := os.Getenv(key)
-	if v == "" {
-		return 0, fmt.Errorf("config:[%s] not found", key)
+// Networks of the trusted proxies, skipping invalid ones
+func (c *ServerConfig) TrustedNets() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range c.TrustedProxies {
+		if n, err := parseNet(s); err == nil {
+			nets = append(nets, n)
+		}
 	}
-	num, err := strconv.Atoi(v)
-	if err != nil {
-		return 0, fmt.Errorf("config:[%s] should number", key)
+	return nets
+}
+
+// Parse CIDR range, or a single address as the range of itself
+func parseNet(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
 	}
-	return num, nil
+	_, n, err := net.ParseCIDR(s)
+	return n, err
 }
 
-func getString(key string) (string, error) {
-	v := os.Getenv(key)
-	if v == "" {
-		return "", fmt.Errorf("config:[%s] not found", key)
+// Node number to generate IDs with
+func (c *SnowflakeConfig) NodeNumber() int64 {
+	if c.Node == NodeUnset {
+		return 0
 	}
-	return v, nil
+	return c.Node
+}
+
+// Minimum level of logs
+func (c *LogConfig) ParsedLevel() logger.Level {
+	level, _ := logger.ParseLevel(c.Level)
+	return level
 }
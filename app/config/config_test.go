@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(m map[string]string) func(string) string {
+	return func(key string) string { return m[key] }
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  port: 8000
+  shutdown_timeout: 5s
+database:
+  driver: sqlite
+  sqlite:
+    path: file.db
+feed:
+  home_size: 100
+`)
+
+	// ファイル < 環境変数 < フラグの順に優先する
+	cfg, err := load(
+		[]string{"-config", path, "-server.port", "9000"},
+		env(map[string]string{"PORT": "8500", "HOME_FEED_SIZE": "200", "RATE_LIMIT_POST_REQUESTS": "3", "CORS_ALLOWED_ORIGINS": "https://a.example, https://b.example"}),
+		io.Discard,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 9000, cfg.Server.Port)
+	assert.Equal(t, 5*time.Second, cfg.Server.ShutdownTimeout)
+	assert.Equal(t, time.Minute, cfg.Server.ReadTimeout)
+	assert.Equal(t, DriverSQLite, cfg.Database.Driver)
+	assert.Equal(t, "file.db", cfg.Database.SQLite.Path)
+	assert.Equal(t, 200, cfg.Feed.HomeSize)
+	assert.Equal(t, RateLimitRule{Requests: 3, Per: 5 * time.Minute}, cfg.RateLimit.Post)
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.CORS.AllowedOrigins)
+}
+
+func TestLoadConfigFileEnv(t *testing.T) {
+	path := writeFile(t, "database:\n  driver: sqlite\npublic_url: https://yatter.example\n")
+
+	cfg, err := load(nil, env(map[string]string{"CONFIG_FILE": path}), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "https://yatter.example", cfg.PublicURL)
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	path := writeFile(t, "server:\n  prot: 8000\n")
+
+	_, err := load([]string{"-config", path}, env(nil), io.Discard)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "prot")
+}
+
+func TestLoadErrors(t *testing.T) {
+	// 不正な設定はまとめて報告する
+	_, err := load(
+		[]string{"-server.read_timeout", "1 minute"},
+		env(map[string]string{"PORT": "http", "LOG_LEVEL": "verbose", "DB_DRIVER": "mysql"}),
+		io.Discard,
+	)
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+	assert.Contains(t, err.Error(), "env PORT")
+	assert.Contains(t, err.Error(), "server.read_timeout")
+	assert.Contains(t, err.Error(), "log.level")
+	assert.Contains(t, err.Error(), "database.mysql.host")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Database.MySQL = MySQLDB{Host: "db:3306"}
+	cfg.Log.Level = "verbose"
+	cfg.CORS.AllowedOrigins = []string{"*", "example.com"}
+	cfg.PublicURL = "ftp://example.com"
+	cfg.CORS.AllowCredentials = true
+	cfg.CORS.AllowedMethods = []string{"get"}
+	cfg.Security.ReferrerPolicy = "never"
+	cfg.RateLimit.Store = RateLimitRedis
+	cfg.RateLimit.Read.Per = 0
+	cfg.Accounts.PasswordResetTTL = 0
+	cfg.TwoFactor.EncryptionKey = "c2hvcnQ="
+	cfg.Server.Instances = 2
+	cfg.Server.AdminAddr = "9090"
+	cfg.Media.MaxAge = 0
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy"}
+
+	err := cfg.Validate()
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+	for _, key := range []string{"server.port", "database.mysql.user", "database.mysql.database", "log.level", "cors.allowed_origins", "cors.allow_credentials", "cors.allowed_methods", "security.referrer_policy", "redis.url", "server.instances", "server.admin_addr", "server.trusted_proxies", "media.max_age", "rate_limit.read.per", "accounts.password_reset_ttl", "two_factor.encryption_key", "snowflake.node", "public_url"} {
+		assert.Contains(t, err.Error(), key)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.MySQL = MySQLDB{Host: "db:3306", User: "yatter", Password: "secret", Database: "yatter"}
+	cfg.Database.ReplicaDSN = "yatter:secret@tcp(replica:3306)/yatter"
+	cfg.Redis.URL = "redis://:secret@redis:6379/0"
+	cfg.TwoFactor.EncryptionKey = "c2VjcmV0"
+
+	r := cfg.Redacted()
+
+	assert.Equal(t, redacted, r.Database.MySQL.Password)
+	assert.Equal(t, redacted, r.Database.ReplicaDSN)
+	assert.Equal(t, "redis://:"+redacted+"@redis:6379/0", r.Redis.URL)
+	assert.Equal(t, redacted, r.TwoFactor.EncryptionKey)
+	// 元の設定は変わらない
+	assert.Equal(t, "secret", cfg.Database.MySQL.Password)
+
+	var b strings.Builder
+	if err := r.WriteYAML(&b); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, b.String(), "secret")
+	assert.Contains(t, b.String(), "host: db:3306")
+}
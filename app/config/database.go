@@ -0,0 +1,88 @@
+package config
+
+import (
+	"time"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Settings to connect to the database
+type DBConfig interface {
+	// Name of the database/sql driver
+	DriverName() string
+
+	// Data source name passed to the driver
+	FormatDSN() string
+}
+
+// Settings of the databases
+type DatabaseConfig struct {
+	// Database driver, "mysql", "postgres" or "sqlite"
+	Driver string `yaml:"driver" env:"DB_DRIVER"`
+
+	// Whether pending migrations are applied on start.
+	// Enabled by default for SQLite, whose database is created on the fly.
+	MigrateOnStart *bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+
+	// DSN of the read replica, using the same driver as the primary database.
+	// Read-only queries go to the primary database if empty.
+	ReplicaDSN string `yaml:"replica_dsn" env:"DB_REPLICA_DSN" secret:"true"`
+
+	// Maximum number of open connections to each database, unlimited if 0
+	MaxOpenConns int `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+
+	// Maximum number of idle connections to each database
+	MaxIdleConns int `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+
+	// Maximum time a connection may be reused, forever if 0
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+
+	MySQL    MySQLDB    `yaml:"mysql"`
+	Postgres PostgresDB `yaml:"postgres"`
+	SQLite   SQLiteDB   `yaml:"sqlite"`
+}
+
+// Settings given as a DSN string
+type dsnConfig struct {
+	driver string
+	dsn    string
+}
+
+func (c *dsnConfig) DriverName() string {
+	return c.driver
+}
+
+func (c *dsnConfig) FormatDSN() string {
+	return c.dsn
+}
+
+// Settings of the database selected by Driver
+func (c *DatabaseConfig) Primary() DBConfig {
+	switch c.Driver {
+	case DriverPostgres:
+		return &c.Postgres
+	case DriverSQLite:
+		return &c.SQLite
+	}
+	return &c.MySQL
+}
+
+// Settings of the read replica, or nil if not configured
+func (c *DatabaseConfig) Replica() DBConfig {
+	if c.ReplicaDSN == "" {
+		return nil
+	}
+	return &dsnConfig{driver: c.Driver, dsn: c.ReplicaDSN}
+}
+
+// Whether pending migrations are applied on start
+func (c *DatabaseConfig) ShouldMigrateOnStart() bool {
+	if c.MigrateOnStart == nil {
+		return c.Driver == DriverSQLite
+	}
+	return *c.MigrateOnStart
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Env variable of the path of the config file, when -config is not given
+const fileEnv = "CONFIG_FILE"
+
+// Replacement of secret values
+const redacted = "REDACTED"
+
+// Field of Config which can be set from a string
+type field struct {
+	// Dotted yaml keys, used as the name of the flag
+	path string
+
+	env    string
+	secret string
+	value  reflect.Value
+}
+
+// Load settings from the YAML file given by -config or CONFIG_FILE, env variables and flags in args.
+// All invalid settings are reported together as Errors.
+func Load(args []string) (*Config, error) {
+	return load(args, os.Getenv, io.Discard)
+}
+
+func load(args []string, getenv func(string) string, output io.Writer) (*Config, error) {
+	cfg := Default()
+	fields := fieldsOf(reflect.ValueOf(cfg).Elem(), "", "")
+
+	fs := flag.NewFlagSet("yatter-backend-go", flag.ContinueOnError)
+	fs.SetOutput(output)
+	file := fs.String("config", getenv(fileEnv), "path of YAML config file (env "+fileEnv+")")
+	var flagged []func() error
+	for _, f := range fields {
+		f := f
+		usage := "see " + f.path + " in the config file"
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		fs.Func(f.path, usage, func(s string) error {
+			// 環境変数より優先するので、後でまとめて設定する
+			flagged = append(flagged, func() error { return set(f, s) })
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	if *file != "" {
+		if err := readFile(cfg, *file); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs Errors
+	for _, f := range fields {
+		if v := getenv(f.env); f.env != "" && v != "" {
+			if err := set(f, v); err != nil {
+				errs = append(errs, fmt.Errorf("env %s: %w", f.env, err))
+			}
+		}
+	}
+	for _, apply := range flagged {
+		if err := apply(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// 読めなかった値は既定値のままにして、他の設定も検証する
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+// Overwrite cfg with the YAML file at path, rejecting unknown keys
+func readFile(cfg *Config, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	if err := d.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// List fields of the struct v recursively.
+// Env variables of fields in a struct with env tag are prefixed by it, like RATE_LIMIT_POST_REQUESTS.
+func fieldsOf(v reflect.Value, prefix string, envPrefix string) []field {
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		env := sf.Tag.Get("env")
+		if env != "" {
+			env = envPrefix + env
+		}
+		if sf.Type.Kind() == reflect.Struct {
+			if env != "" {
+				env += "_"
+			}
+			fields = append(fields, fieldsOf(v.Field(i), path+".", env)...)
+			continue
+		}
+		fields = append(fields, field{
+			path:   path,
+			env:    env,
+			secret: sf.Tag.Get("secret"),
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+// Set f parsing s by its type
+func set(f field, s string) error {
+	v := f.value
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := set(field{path: f.path, value: p.Elem()}, s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	switch v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%s should be duration like 30s", f.path)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case []string:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s should be number", f.path)
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%s should be bool", f.path)
+		}
+		v.SetBool(b)
+	default:
+		panic("config: unsupported type of " + f.path)
+	}
+	return nil
+}
+
+// Copy of c with secrets replaced, to be shown to people
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.CORS.AllowedOrigins = append([]string(nil), c.CORS.AllowedOrigins...)
+	for _, f := range fieldsOf(reflect.ValueOf(&r).Elem(), "", "") {
+		s := f.value.String()
+		if f.secret == "" || s == "" {
+			continue
+		}
+		if f.secret == "url" {
+			// URLの中のパスワードだけ隠す
+			if u, err := url.Parse(s); err == nil {
+				if _, ok := u.User.Password(); ok {
+					u.User = url.UserPassword(u.User.Username(), redacted)
+				}
+				f.value.SetString(u.String())
+				continue
+			}
+		}
+		f.value.SetString(redacted)
+	}
+	return &r
+}
+
+// Write c as YAML
+func (c *Config) WriteYAML(w io.Writer) error {
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(c); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return e.Close()
+}
@@ -1,80 +1,52 @@
 package config
 
 import (
-	"fmt"
-	"log"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
-// accessor namespace
-var MySQL _mysql
+// Settings to connect to MySQL
+type MySQLDB struct {
+	Host     string `yaml:"host" env:"MYSQL_HOST"`
+	User     string `yaml:"user" env:"MYSQL_USER"`
+	Password string `yaml:"password" env:"MYSQL_PASSWORD" secret:"true"`
+	Database string `yaml:"database" env:"MYSQL_DATABASE"`
 
-type _mysql struct{}
-
-// Read MySQL host
-func (_mysql) Host() string {
-	v, err := getString("MYSQL_HOST")
-	if err != nil {
-		log.Fatal(err)
-	}
-	return v
-}
-
-// Read MySQL user
-func (_mysql) User() string {
-	v, err := getString("MYSQL_USER")
-	if err != nil {
-		log.Fatal(err)
-	}
-	return v
+	// Timezone of the connection, Japan Standard Time if empty
+	TZ string `yaml:"tz" env:"MYSQL_TZ"`
 }
 
-// Read MySQL password
-func (_mysql) Password() string {
-	v, err := getString("MYSQL_PASSWORD")
-	if err != nil {
-		log.Fatal(err)
-	}
-	return v
+func (*MySQLDB) DriverName() string {
+	return DriverMySQL
 }
 
-// Read MySQL database name
-func (_mysql) Database() string {
-	v, err := getString("MYSQL_DATABASE")
-	if err != nil {
-		log.Fatal(err)
-	}
-	return v
+func (c *MySQLDB) FormatDSN() string {
+	return c.mysqlConfig().FormatDSN()
 }
 
-// Read Timezone for MySQL
-func (_mysql) Location() *time.Location {
-	tz, err := getString("MYSQL_TZ")
-	if err != nil {
-		return time.FixedZone("Asia/Tokyo", 9*60*60)
-	}
-	loc, err := time.LoadLocation(tz)
-	if err != nil {
-		log.Fatal(fmt.Errorf("invalid timezone %+v", tz))
+// Timezone of the connection
+func (c *MySQLDB) Location() (*time.Location, error) {
+	if c.TZ == "" {
+		return time.FixedZone("Asia/Tokyo", 9*60*60), nil
 	}
-	return loc
+	return time.LoadLocation(c.TZ)
 }
 
 // Build mysql.Config
-func MySQLConfig() *mysql.Config {
+func (c *MySQLDB) mysqlConfig() *mysql.Config {
 	cfg := mysql.NewConfig()
 
 	cfg.ParseTime = true
-	cfg.Loc = MySQL.Location()
-	if host := MySQL.Host(); host != "" {
+	// validated on load
+	cfg.Loc, _ = c.Location()
+	if c.Host != "" {
 		cfg.Net = "tcp"
-		cfg.Addr = host
+		cfg.Addr = c.Host
 	}
-	cfg.User = MySQL.User()
-	cfg.Passwd = MySQL.Password()
-	cfg.DBName = MySQL.Database()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.DBName = c.Database
 
 	return cfg
 }
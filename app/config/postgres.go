@@ -0,0 +1,30 @@
+package config
+
+import (
+	"net/url"
+)
+
+// Settings to connect to PostgreSQL
+type PostgresDB struct {
+	Host     string `yaml:"host" env:"POSTGRES_HOST"`
+	User     string `yaml:"user" env:"POSTGRES_USER"`
+	Password string `yaml:"password" env:"POSTGRES_PASSWORD" secret:"true"`
+	Database string `yaml:"database" env:"POSTGRES_DATABASE"`
+	SSLMode  string `yaml:"sslmode" env:"POSTGRES_SSLMODE"`
+}
+
+func (*PostgresDB) DriverName() string {
+	return DriverPostgres
+}
+
+// Format as postgres:// URL
+func (c *PostgresDB) FormatDSN() string {
+	u := &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     c.Host,
+		Path:     "/" + c.Database,
+		RawQuery: url.Values{"sslmode": []string{c.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"net/url"
+)
+
+// Settings to open an embedded SQLite database
+type SQLiteDB struct {
+	// Path of the database file
+	Path string `yaml:"path" env:"SQLITE_PATH"`
+}
+
+func (*SQLiteDB) DriverName() string {
+	return DriverSQLite
+}
+
+// Format as file: URI.
+// SQLite disables foreign keys by default, so they are enabled on every connection.
+func (c *SQLiteDB) FormatDSN() string {
+	query := url.Values{
+		"_pragma":      []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+		"_time_format": []string{"sqlite"},
+	}
+	return "file:" + c.Path + "?" + query.Encode()
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/secret"
+	"yatter-backend-go/app/snowflake"
+	"yatter-backend-go/app/tracing"
+)
+
+// Invalid settings found at once
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid config:\n\t" + strings.Join(msgs, "\n\t")
+}
+
+// Check all settings, returning Errors of the invalid ones
+func (c *Config) Validate() error {
+	var errs Errors
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	s := c.Server
+	check(s.Port > 0 && s.Port < 1<<16, "server.port should be in range [1, 65535]")
+	check(s.ReadHeaderTimeout > 0, "server.read_header_timeout should be positive")
+	check(s.ReadTimeout > 0, "server.read_timeout should be positive")
+	check(s.WriteTimeout > 0, "server.write_timeout should be positive")
+	check(s.IdleTimeout > 0, "server.idle_timeout should be positive")
+	check(s.MaxHeaderBytes > 0, "server.max_header_bytes should be positive")
+	check(s.ShutdownTimeout > 0, "server.shutdown_timeout should be positive")
+	check(s.Instances > 0, "server.instances should be positive")
+	for _, p := range s.TrustedProxies {
+		_, err := parseNet(p)
+		check(err == nil, fmt.Sprintf("server.trusted_proxies should be addresses or CIDR ranges, not %q", p))
+	}
+	if s.AdminAddr != "" {
+		_, port, err := net.SplitHostPort(s.AdminAddr)
+		check(err == nil && port != "" && port != strconv.Itoa(s.Port), "server.admin_addr should be host:port apart from server.port")
+	}
+
+	db := c.Database
+	switch db.Driver {
+	case DriverMySQL:
+		check(db.MySQL.Host != "", "database.mysql.host is required")
+		check(db.MySQL.User != "", "database.mysql.user is required")
+		check(db.MySQL.Password != "", "database.mysql.password is required")
+		check(db.MySQL.Database != "", "database.mysql.database is required")
+		_, err := db.MySQL.Location()
+		check(err == nil, "database.mysql.tz should be a timezone like Asia/Tokyo")
+	case DriverPostgres:
+		check(db.Postgres.Host != "", "database.postgres.host is required")
+		check(db.Postgres.User != "", "database.postgres.user is required")
+		check(db.Postgres.Password != "", "database.postgres.password is required")
+		check(db.Postgres.Database != "", "database.postgres.database is required")
+	case DriverSQLite:
+		check(db.SQLite.Path != "", "database.sqlite.path is required")
+	default:
+		check(false, "database.driver should be mysql, postgres or sqlite")
+	}
+	check(db.MaxOpenConns >= 0, "database.max_open_conns should not be negative")
+	check(db.MaxIdleConns >= 0, "database.max_idle_conns should not be negative")
+	check(db.ConnMaxLifetime >= 0, "database.conn_max_lifetime should not be negative")
+
+	if c.Redis.URL != "" {
+		u, err := url.Parse(c.Redis.URL)
+		check(err == nil && (u.Scheme == "redis" || u.Scheme == "rediss"), "redis.url should be redis:// or rediss:// URL")
+	}
+	check(c.Feed.HomeSize > 0, "feed.home_size should be positive")
+	// メモリのフィードは他のインスタンスの投稿を受け取れない
+	check(s.Instances == 1 || c.Redis.URL != "", "redis.url is required for the home feed when server.instances is more than 1")
+
+	check(c.Media.MaxUploadBytes > 0, "media.max_upload_bytes should be positive")
+	check(c.Media.GCInterval > 0, "media.gc_interval should be positive")
+	check(c.Media.MaxAge > 0, "media.max_age should be positive")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || isOrigin(origin), "cors.allowed_origins should be * or origins like https://example.com, not "+origin)
+		check(origin != "*" || !c.CORS.AllowCredentials, "cors.allowed_origins should not have * when cors.allow_credentials is true")
+	}
+	for _, header := range c.CORS.AllowedHeaders {
+		check(header == "*" || isToken(header), "cors.allowed_headers should be * or header names, not "+header)
+	}
+	check(len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods is required")
+	for _, method := range c.CORS.AllowedMethods {
+		check(isToken(method) && method == strings.ToUpper(method), "cors.allowed_methods should be methods in upper case, not "+method)
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age should not be negative")
+
+	switch c.Security.ReferrerPolicy {
+	case "", "no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+		"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url":
+	default:
+		check(false, "security.referrer_policy should be a policy like no-referrer, not "+c.Security.ReferrerPolicy)
+	}
+	check(!strings.ContainsAny(c.Security.ContentSecurityPolicy, "\r\n"), "security.content_security_policy should be a line")
+	check(c.Security.HSTSMaxAge >= 0, "security.hsts_max_age should not be negative")
+
+	switch c.RateLimit.Store {
+	case RateLimitMemory:
+	case RateLimitRedis:
+		check(c.Redis.URL != "", "redis.url is required for rate_limit.store redis")
+	default:
+		check(false, "rate_limit.store should be memory or redis")
+	}
+	rules := []struct {
+		name string
+		RateLimitRule
+	}{
+		{"account_creation", c.RateLimit.AccountCreation},
+		{"post", c.RateLimit.Post},
+		{"read", c.RateLimit.Read},
+		{"login", c.RateLimit.Login},
+		{"login_code", c.RateLimit.LoginCode},
+	}
+	for _, rule := range rules {
+		check(rule.Requests >= 0, "rate_limit."+rule.name+".requests should not be negative")
+		check(rule.Requests == 0 || rule.Per > 0, "rate_limit."+rule.name+".per should be positive")
+	}
+
+	switch c.Registrations.Mode {
+	case RegistrationsOpen, RegistrationsApproval, RegistrationsClosed:
+	default:
+		check(false, "registrations.mode should be open, approval or closed")
+	}
+	check(c.Registrations.ConfirmationTTL > 0, "registrations.confirmation_ttl should be positive")
+
+	check(c.Accounts.PasswordResetTTL > 0, "accounts.password_reset_ttl should be positive")
+	check(c.Accounts.PurgeInterval > 0, "accounts.purge_interval should be positive")
+	check(c.Accounts.AccessTokenTTL > 0, "accounts.access_token_ttl should be positive")
+
+	if c.TwoFactor.EncryptionKey != "" {
+		_, err := secret.ParseKey(c.TwoFactor.EncryptionKey)
+		check(err == nil, "two_factor.encryption_key should be 32 bytes encoded in base64")
+	}
+	// otpauth URIはラベルを "issuer:account" で区切る
+	check(c.TwoFactor.Issuer != "" && !strings.Contains(c.TwoFactor.Issuer, ":"), "two_factor.issuer should be a name without colons")
+
+	switch c.Mail.Driver {
+	case MailSMTP:
+		check(c.Mail.SMTP.Host != "", "mail.smtp.host is required for mail.driver smtp")
+		check(c.Mail.SMTP.Port > 0 && c.Mail.SMTP.Port < 1<<16, "mail.smtp.port should be in range [1, 65535]")
+	case MailFile:
+		check(c.Mail.Dir != "", "mail.dir is required for mail.driver file")
+	case MailLog:
+	default:
+		check(false, "mail.driver should be smtp, file or log")
+	}
+	_, err := mail.ParseAddress(c.Mail.From)
+	check(err == nil, "mail.from should be an email address")
+
+	_, err = logger.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level should be debug, info, warn or error")
+	check(c.Log.Format == string(logger.FormatJSON) || c.Log.Format == string(logger.FormatLogfmt), "log.format should be json or logfmt")
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		check(false, "tracing.exporter should be otlp or stdout")
+	}
+
+	if c.Snowflake.Node == NodeUnset {
+		check(c.Server.Instances == 1, "snowflake.node is required when server.instances is more than 1")
+	} else {
+		check(c.Snowflake.Node >= 0 && c.Snowflake.Node <= snowflake.MaxNode, fmt.Sprintf("snowflake.node should be in range [0, %d]", snowflake.MaxNode))
+	}
+
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "public_url should be http:// or https:// URL")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Whether s is a token of HTTP, like a header name or a method
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether s is an origin, scheme and host without path
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == ""
+}
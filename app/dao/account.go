@@ -14,90 +14,69 @@ import (
 type (
 	// Implementation for repository.Account
 	account struct {
-		db *sqlx.DB
+		db handle
+
+		// database for read-only queries, a replica or db itself
+		replica handle
 	}
 )
 
 // Create accout repository
 func NewAccount(db *sqlx.DB) repository.Account {
-	return &account{db: db}
+	return &account{db: db, replica: db}
+}
+
+// Condition on accounts of alias excluding ones deleted by their owners, which stay until purged
+func notDeleted(alias string) string {
+	return alias + ".state <> '" + string(object.AccountDeleted) + "'"
 }
 
 // FindByUsername : ユーザ名からユーザを取得
 func (r *account) FindByUsername(ctx context.Context, username string) (*object.Account, error) {
+	return r.findOne(ctx, "username = ?", username)
+}
+
+// idからユーザを取得
+func (r *account) FindByID(ctx context.Context, id object.AccountID) (*object.Account, error) {
+	return r.findOne(ctx, "id = ?", id)
+}
+
+// メールアドレスからユーザを取得
+func (r *account) FindByEmail(ctx context.Context, email string) (*object.Account, error) {
+	return r.findOne(ctx, "email = ?", email)
+}
+
+// condに一致するユーザを1人取得 (削除済みは除く)
+func (r *account) findOne(ctx context.Context, cond string, arg interface{}) (*object.Account, error) {
 	entity := new(object.Account)
-	const query = `
+	query := `
 	SELECT
 		id,
 		username,
+		password_hash,
+		email,
+		state,
+		email_confirmed_at,
+		EXISTS (
+			SELECT * FROM two_factor AS tf WHERE tf.account_id = account.id AND tf.enabled_at IS NOT NULL
+		) AS "two_factor_enabled",
 		display_name,
 		avatar,
 		header,
 		note,
 		create_at,
-		CASE
-			WHEN NOT EXISTS (
-				SELECT
-					*
-				FROM
-					relation AS r
-					INNER JOIN account AS a ON r.following_id = a.id
-				WHERE
-					a.username = ?
-			) THEN 0
-			ELSE (
-				SELECT
-					COUNT(*)
-				FROM
-					relation
-				WHERE
-					following_id = (
-						SELECT
-							id
-						FROM
-							account
-						WHERE
-							username = ?
-					)
-				GROUP BY
-					following_id
-			)
-		END AS followingcount,
-		CASE
-			WHEN NOT EXISTS (
-				SELECT
-					*
-				FROM
-					relation AS r
-					INNER JOIN account AS a ON r.follower_id = a.id
-				WHERE
-					a.username = ?
-			) THEN 0
-			ELSE (
-				SELECT
-					COUNT(*)
-				FROM
-					relation
-				WHERE
-					follower_id = (
-						SELECT
-							id
-						FROM
-							account
-						WHERE
-							username = ?
-					)
-				GROUP BY
-					follower_id
-			)
-		END AS followerscount
+		COALESCE(st.following_count, 0) AS "followingcount",
+		COALESCE(st.followers_count, 0) AS "followerscount",
+		COALESCE(st.statuses_count, 0) AS "statusescount",
+		st.last_status_at AS "last_status_at"
 	FROM
 		account
+		LEFT JOIN account_stats AS st ON st.account_id = account.id
 	WHERE
-		username = ?
-	`
+		` + notDeleted("account") + `
+		AND ` + cond
 
-	err := r.db.QueryRowxContext(ctx, query, username, username, username, username, username).StructScan(entity)
+	err := r.replica.QueryRowxContext(ctx, r.replica.Rebind(query), arg).StructScan(entity)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -108,41 +87,295 @@ func (r *account) FindByUsername(ctx context.Context, username string) (*object.
 	return entity, nil
 }
 
+// idの一覧からユーザをまとめて取得 (削除済みは除く)
+func (r *account) FindAccountsByIDs(ctx context.Context, ids []object.AccountID) (map[object.AccountID]*object.Account, error) {
+	found := make(map[object.AccountID]*object.Account, len(ids))
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	var accounts []object.Account
+	query, args, err := sqlx.In(`
+	SELECT
+		id,
+		username,
+		display_name,
+		avatar,
+		header,
+		note,
+		create_at,
+		COALESCE(st.following_count, 0) AS "followingcount",
+		COALESCE(st.followers_count, 0) AS "followerscount",
+		COALESCE(st.statuses_count, 0) AS "statusescount",
+		st.last_status_at AS "last_status_at"
+	FROM
+		account
+		LEFT JOIN account_stats AS st ON st.account_id = account.id
+	WHERE
+		id IN (?)
+		AND `+notDeleted("account")+`
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if err := r.replica.SelectContext(ctx, &accounts, r.replica.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	for i := range accounts {
+		found[accounts[i].ID] = &accounts[i]
+	}
+	return found, nil
+}
+
 // アカウントを作成
 func (r *account) Insert(ctx context.Context, a object.Account) (object.AccountID, error) {
 	const query = `
 	INSERT INTO account
-	(username, password_hash, display_name, avatar, header, note)
-	VALUES (?, ?, ?, ?, ?, ?)
+	(username, email, state, password_hash, display_name, avatar, header, note)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	row, err := r.db.ExecContext(ctx, query, a.Username, a.PasswordHash, a.DisplayName, a.Avatar, a.Header, a.Note)
+	var id object.AccountID
+	err := transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		var err error
+		id, err = insert(ctx, tx, query, a.Username, a.Email, a.State, a.PasswordHash, a.DisplayName, a.Avatar, a.Header, a.Note)
+		if err != nil {
+			return err
+		}
+
+		const stats = "INSERT INTO account_stats (account_id) VALUES (?)"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(stats), id); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return -1, fmt.Errorf("%w", err)
+		return -1, err
 	}
-	id, err := row.LastInsertId()
+	return id, nil
+}
+
+func (r *account) Update(ctx context.Context, a object.Account) ([]string, error) {
+	var replaced []string
+	err := transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		// 行ロックを取って前の画像を読み、同時の更新が同じ画像を二重に返さないようにする
+		// SQLiteは書き込みがデータベースごと排他になる
+		find := "SELECT avatar, header FROM account WHERE username = ?"
+		if !isSQLite(tx) {
+			find += " FOR UPDATE"
+		}
+		var old object.Account
+		if err := tx.GetContext(ctx, &old, tx.Rebind(find), a.Username); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("%w", err)
+		}
+
+		const query = `
+		UPDATE
+			account
+		SET
+			display_name = ?,
+			note = ?,
+			avatar = ?,
+			header = ?
+		WHERE
+			username = ?
+		`
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), a.DisplayName, a.Note, a.Avatar, a.Header, a.Username); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		for _, url := range []*string{old.Avatar, old.Header} {
+			if url != nil {
+				replaced = append(replaced, *url)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
+	return replaced, nil
+}
 
-	return id, nil
+// メールアドレスを確認済みにし、承認が不要か承認済みなら有効にする
+func (r *account) ConfirmEmail(ctx context.Context, id object.AccountID, approvalRequired bool) error {
+	state := object.AccountConfirmed
+	if approvalRequired {
+		state = object.AccountPending
+	}
+	const query = `
+	UPDATE
+		account
+	SET
+		email_confirmed_at = CURRENT_TIMESTAMP,
+		state = CASE WHEN approved_at IS NULL THEN ? ELSE ? END
+	WHERE
+		id = ?
+	`
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), state, object.AccountConfirmed, id)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
 }
 
-func (r *account) Update(ctx context.Context, a object.Account) error {
+// 承認済みにし、メールアドレスが確認済みなら有効にする
+func (r *account) Approve(ctx context.Context, id object.AccountID) error {
 	const query = `
 	UPDATE
 		account
 	SET
-		display_name = ?,
-		note = ?,
-		avatar = ?,
-		header = ?
+		approved_at = CURRENT_TIMESTAMP,
+		state = CASE WHEN email IS NULL OR email_confirmed_at IS NOT NULL THEN ? ELSE state END
 	WHERE
-		username = ?
+		id = ?
 	`
-	_, err := r.db.ExecContext(ctx, query, a.DisplayName, a.Note, a.Avatar, a.Header, a.Username)
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), object.AccountConfirmed, id)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// パスワードを変更
+func (r *account) UpdatePassword(ctx context.Context, id object.AccountID, hash object.PasswordHash) error {
+	const query = "UPDATE account SET password_hash = ? WHERE id = ?"
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), hash, id)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w", err)
 	}
 	return nil
 }
+
+// 削除済みにする (データはPurgeで消す)
+func (r *account) MarkDeleted(ctx context.Context, id object.AccountID) error {
+	const query = "UPDATE account SET state = ? WHERE id = ?"
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), object.AccountDeleted, id)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// avatarとheaderのうちurlのものを外し、外した数を返す
+func (r *account) UnsetImage(ctx context.Context, id object.AccountID, url string) (int, error) {
+	var n int
+	err := transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		for _, query := range []string{
+			"UPDATE account SET avatar = NULL WHERE id = ? AND avatar = ?",
+			"UPDATE account SET header = NULL WHERE id = ? AND header = ?",
+		} {
+			result, err := tx.ExecContext(ctx, tx.Rebind(query), id, url)
+			if err != nil {
+				return fmt.Errorf("%w", err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("%w", err)
+			}
+			n += int(affected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// 削除済みのユーザを取得
+func (r *account) FindDeleted(ctx context.Context, limit int) ([]object.Account, error) {
+	var accounts []object.Account
+	const query = `
+	SELECT
+		id,
+		username,
+		state,
+		avatar,
+		header,
+		create_at
+	FROM
+		account
+	WHERE
+		state = ?
+	ORDER BY
+		id
+	LIMIT
+		?
+	`
+
+	// 消した直後に再び見つからないようにプライマリから読む
+	err := r.db.SelectContext(ctx, &accounts, r.db.Rebind(query), object.AccountDeleted, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return accounts, nil
+}
+
+// ユーザと、その投稿・フォロー・attachment・トークン・二要素認証を消す
+func (r *account) Purge(ctx context.Context, id object.AccountID) error {
+	return transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		queries := []string{
+			// フォローしていた相手のフォロワー数と、フォローされていた相手のフォロー数を減らす
+			`UPDATE account_stats SET followers_count = followers_count - 1
+			WHERE account_id IN (SELECT follower_id FROM relation WHERE following_id = ?)`,
+			`UPDATE account_stats SET following_count = following_count - 1
+			WHERE account_id IN (SELECT following_id FROM relation WHERE follower_id = ?)`,
+			"DELETE FROM relation WHERE following_id = ?",
+			"DELETE FROM relation WHERE follower_id = ?",
+			"DELETE FROM status_contain_attachment WHERE status_id IN (SELECT id FROM status WHERE account_id = ?)",
+			"DELETE FROM attachment WHERE account_id = ?",
+			"DELETE FROM status WHERE account_id = ?",
+			"DELETE FROM account_stats WHERE account_id = ?",
+			"DELETE FROM confirmation_token WHERE account_id = ?",
+			"DELETE FROM recovery_code WHERE account_id = ?",
+			"DELETE FROM two_factor WHERE account_id = ?",
+			"DELETE FROM account WHERE id = ?",
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, tx.Rebind(query), id); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// 全アカウントの集計値をstatusとrelationから数え直す
+func (r *account) RecountStats(ctx context.Context) (int64, error) {
+	const query = `
+	INSERT INTO account_stats (account_id, following_count, followers_count, statuses_count, last_status_at)
+	SELECT
+		a.id,
+		(SELECT COUNT(*) FROM relation WHERE following_id = a.id),
+		(SELECT COUNT(*) FROM relation WHERE follower_id = a.id),
+		(SELECT COUNT(*) FROM status WHERE account_id = a.id),
+		(SELECT MAX(create_at) FROM status WHERE account_id = a.id)
+	FROM
+		account AS a
+	`
+
+	var n int64
+	err := transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM account_stats"); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		result, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		if n, err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/domain/repository"
 
@@ -12,7 +13,7 @@ import (
 )
 
 type attachment struct {
-	db *sqlx.DB
+	db handle
 }
 
 func NewAttachment(db *sqlx.DB) repository.Attachment {
@@ -20,16 +21,8 @@ func NewAttachment(db *sqlx.DB) repository.Attachment {
 }
 
 func (r *attachment) Insert(ctx context.Context, a object.Attachment) (object.AttachmentID, error) {
-	const query = `INSERT INTO attachment (type, url, description) VALUES(?, ?, ?)`
-	result, err := r.db.ExecContext(ctx, query, a.MediaType, a.URL, a.Description)
-	if err != nil {
-		return -1, fmt.Errorf("%w", err)
-	}
-	id, err := result.LastInsertId()
-	if err != nil {
-		return -1, fmt.Errorf("%w", err)
-	}
-	return id, nil
+	const query = `INSERT INTO attachment (account_id, type, url, blob_hash, description) VALUES(?, ?, ?, ?, ?)`
+	return insert(ctx, r.db, query, a.AccountID, a.MediaType, a.URL, a.BlobHash, a.Description)
 }
 
 func (r *attachment) FindByStatusID(ctx context.Context, id object.StatusID) ([]object.Attachment, error) {
@@ -37,8 +30,10 @@ func (r *attachment) FindByStatusID(ctx context.Context, id object.StatusID) ([]
 	const query = `
 	SELECT
 		id,
+		account_id,
 		type,
 		url,
+		blob_hash,
 		description
 	FROM
 		attachment A
@@ -47,7 +42,7 @@ func (r *attachment) FindByStatusID(ctx context.Context, id object.StatusID) ([]
 	WHERE status_id = ?
 	`
 
-	err := r.db.SelectContext(ctx, &attachments, query, id)
+	err := r.db.SelectContext(ctx, &attachments, r.db.Rebind(query), id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -57,19 +52,205 @@ func (r *attachment) FindByStatusID(ctx context.Context, id object.StatusID) ([]
 	return attachments, nil
 }
 
-func (r *attachment) HasAttachmentIDs(ctx context.Context, ids []object.AttachmentID) (bool, error) {
+func (r *attachment) FindByStatusIDs(ctx context.Context, ids []object.StatusID) (map[object.StatusID][]object.Attachment, error) {
+	found := make(map[object.StatusID][]object.Attachment, len(ids))
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	var rows []struct {
+		StatusID object.StatusID `db:"status_id"`
+		object.Attachment
+	}
+	query, args, err := sqlx.In(`
+	SELECT
+		S.status_id,
+		A.id,
+		A.account_id,
+		A.type,
+		A.url,
+		A.blob_hash,
+		A.description
+	FROM
+		attachment A
+		INNER JOIN status_contain_attachment S
+		ON S.attachment_id = A.id
+	WHERE
+		S.status_id IN (?)
+	ORDER BY
+		A.id
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	for _, row := range rows {
+		found[row.StatusID] = append(found[row.StatusID], row.Attachment)
+	}
+	return found, nil
+}
+
+func (r *attachment) IsAttachable(ctx context.Context, accountID object.AccountID, ids []object.AttachmentID) (bool, error) {
 	var attachments []object.Attachment
-	query, args, err := sqlx.In("SELECT id FROM attachment WHERE id IN (?)", ids)
+	const query = `
+	SELECT
+		id
+	FROM
+		attachment A
+	WHERE
+		id IN (?)
+		AND account_id = ?
+		AND detached_at IS NULL
+		AND NOT EXISTS (
+			SELECT
+				*
+			FROM
+				status_contain_attachment S
+			WHERE
+				S.attachment_id = A.id
+		)
+	`
+	q, args, err := sqlx.In(query, ids, accountID)
 	if err != nil {
 		return false, err
 	}
 
-	query = r.db.Rebind(query)
-	err = r.db.SelectContext(ctx, &attachments, r.db.Rebind(query), args...)
+	err = r.db.SelectContext(ctx, &attachments, r.db.Rebind(q), args...)
+	if err != nil {
+		return false, err
+	}
+
+	// 同じIDが重複していても、異なるIDの数と比べる
+	distinct := make(map[object.AttachmentID]bool, len(ids))
+	for _, id := range ids {
+		distinct[id] = true
+	}
+	return (len(attachments) == len(distinct)), nil
+}
+
+// アカウントがアップロードした全てのattachmentを取得
+func (r *attachment) FindByAccountID(ctx context.Context, id object.AccountID) ([]object.Attachment, error) {
+	var attachments []object.Attachment
+	const query = `
+	SELECT
+		id,
+		account_id,
+		type,
+		url,
+		blob_hash,
+		description,
+		create_at
+	FROM
+		attachment
+	WHERE
+		account_id = ?
+	`
+
+	err := r.db.SelectContext(ctx, &attachments, r.db.Rebind(query), id)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return attachments, nil
+}
+
+func (r *attachment) FindOrphans(ctx context.Context, before time.Time, after object.AttachmentID, limit int) ([]object.Attachment, error) {
+	var attachments []object.Attachment
+	// 移行前の投稿者の分からないattachmentはaccount_idがない
+	const query = `
+	SELECT
+		id,
+		COALESCE(account_id, 0) AS account_id,
+		type,
+		url,
+		blob_hash,
+		description,
+		create_at
+	FROM
+		attachment
+	WHERE
+		id > ?
+		AND (` + orphan + `)
+	ORDER BY
+		id
+	LIMIT
+		?
+	`
+
+	err := r.db.SelectContext(ctx, &attachments, r.db.Rebind(query), after, orphanBefore(r.db, before), limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w", err)
+	}
+	return attachments, nil
+}
+
+// 投稿から外されたか、古くなっても使われていないattachment
+const orphan = `
+		detached_at IS NOT NULL
+		OR (
+			create_at < ?
+			AND NOT EXISTS (
+				SELECT
+					*
+				FROM
+					status_contain_attachment S
+				WHERE
+					S.attachment_id = attachment.id
+			)
+		)`
 
+func orphanBefore(db handle, before time.Time) time.Time {
+	if isSQLite(db) {
+		// SQLite stores CURRENT_TIMESTAMP as UTC text and compares it as a string
+		return before.UTC()
+	}
+	return before
+}
+
+func (r *attachment) DeleteOrphan(ctx context.Context, id object.AttachmentID, before time.Time) (bool, error) {
+	// 見つけた後に投稿されていれば消さない
+	const query = `
+	DELETE FROM
+		attachment
+	WHERE
+		id = ?
+		AND (` + orphan + `)
+	`
+	return deleted(ctx, r.db, query, id, orphanBefore(r.db, before))
+}
+
+func (r *attachment) Delete(ctx context.Context, id object.AttachmentID) (bool, error) {
+	var ok bool
+	err := transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		const unlink = "DELETE FROM status_contain_attachment WHERE attachment_id = ?"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(unlink), id); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		var err error
+		ok, err = deleted(ctx, tx, "DELETE FROM attachment WHERE id = ?", id)
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
+	return ok, nil
+}
 
-	return (len(attachments) == len(ids)), nil
+// Run the DELETE query, returning whether any row was deleted
+func deleted(ctx context.Context, db handle, query string, args ...interface{}) (bool, error) {
+	result, err := db.ExecContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	return n > 0, nil
 }
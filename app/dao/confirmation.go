@@ -0,0 +1,82 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// Implementation for repository.Confirmation
+	confirmation struct {
+		db handle
+	}
+)
+
+// Create confirmation token repository
+func NewConfirmation(db *sqlx.DB) repository.Confirmation {
+	return &confirmation{db: db}
+}
+
+func (r *confirmation) Insert(ctx context.Context, t object.ConfirmationToken) error {
+	const query = "INSERT INTO confirmation_token (token_hash, purpose, account_id, expires_at) VALUES (?, ?, ?, ?)"
+
+	// 期限はUTCで保存して比較する (SQLiteは文字列として比較するため)
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), t.Hash, t.Purpose, t.AccountID, t.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (r *confirmation) FindValid(ctx context.Context, purpose object.TokenPurpose, hash string, now time.Time) (*object.ConfirmationToken, error) {
+	entity := new(object.ConfirmationToken)
+	const query = `
+	SELECT
+		token_hash,
+		purpose,
+		account_id,
+		expires_at
+	FROM
+		confirmation_token
+	WHERE
+		token_hash = ?
+		AND purpose = ?
+		AND expires_at > ?
+	`
+
+	err := r.db.QueryRowxContext(ctx, r.db.Rebind(query), hash, purpose, now.UTC()).StructScan(entity)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w", err)
+	}
+	return entity, nil
+}
+
+func (r *confirmation) Delete(ctx context.Context, hash string) error {
+	const query = "DELETE FROM confirmation_token WHERE token_hash = ?"
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), hash)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (r *confirmation) DeleteByAccountID(ctx context.Context, purpose object.TokenPurpose, id object.AccountID) error {
+	const query = "DELETE FROM confirmation_token WHERE account_id = ? AND purpose = ?"
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), id, purpose)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package dao
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/snowflake"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -24,60 +27,207 @@ type (
 		// Get attachment repository
 		Attachment() repository.Attachment
 
+		// Get media blob repository
+		MediaBlob() repository.MediaBlob
+
+		// Get confirmation token repository
+		Confirmation() repository.Confirmation
+
+		// Get two-factor repository
+		TwoFactor() repository.TwoFactor
+
+		// Get DAO reading from the primary database,
+		// for reads which must see writes made just before
+		Primary() Dao
+
+		// Run f in a transaction with a DAO whose repositories all share it.
+		// The transaction commits if f returns nil, and rolls back if f returns an error or panics.
+		// Calling WithTx on a DAO given to f joins the same transaction.
+		WithTx(ctx context.Context, f func(Dao) error) error
+
 		// Clear all data in DB
 		InitAll() error
+
+		// Check connections to the primary database and the replica
+		Ping(ctx context.Context) error
+
+		// Close connections to the databases.
+		// DAOs given by Primary and WithTx share them and are not to be closed.
+		Close() error
+	}
+
+	// Settings of connection pools
+	PoolConfig struct {
+		// Maximum number of open connections, unlimited if 0
+		MaxOpenConns int
+
+		// Maximum number of idle connections
+		MaxIdleConns int
+
+		// Maximum time a connection may be reused, forever if 0
+		ConnMaxLifetime time.Duration
 	}
 
 	// Implementation for DAO
 	dao struct {
-		db *sqlx.DB
+		db handle
+
+		// database for read-only queries, a replica or db itself
+		replica handle
+
+		// generator of status IDs
+		ids *snowflake.Generator
 	}
 )
 
-// Create DAO
-func New(config DBConfig) (Dao, error) {
-	db, err := initDb(config)
+// Create DAO.
+// Read-only queries go to replica if given, or to the primary database otherwise.
+// Status IDs are generated by ids.
+func New(config DBConfig, replica DBConfig, pool PoolConfig, ids *snowflake.Generator) (Dao, error) {
+	db, err := Open(config)
 	if err != nil {
 		return nil, err
 	}
-	const connections = 10
-	db.SetMaxIdleConns(connections)
-	db.SetMaxOpenConns(connections)
-	db.SetConnMaxLifetime(connections * time.Second)
+	pool.apply(db)
 
-	return &dao{db: db}, nil
+	d := &dao{db: db, replica: db, ids: ids}
+	if replica != nil {
+		r, err := Open(replica)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		pool.apply(r)
+		d.replica = r
+	}
+	return d, nil
+}
+
+func (p PoolConfig) apply(db *sqlx.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
 }
 
 func (d *dao) Account() repository.Account {
-	return NewAccount(d.db)
+	return &account{db: d.db, replica: d.replica}
 }
 
 func (d *dao) Status() repository.Status {
-	return NewStatus(d.db)
+	return &status{db: d.db, replica: d.replica, ids: d.ids}
 }
 
 func (d *dao) Relation() repository.Relation {
-	return NewRelation(d.db)
+	return &relation{db: d.db, replica: d.replica}
 }
 
 func (d *dao) Attachment() repository.Attachment {
-	return NewAttachment(d.db)
+	return &attachment{db: d.db}
+}
+
+func (d *dao) MediaBlob() repository.MediaBlob {
+	return &mediaBlob{db: d.db}
+}
+
+func (d *dao) Confirmation() repository.Confirmation {
+	return &confirmation{db: d.db}
+}
+
+func (d *dao) TwoFactor() repository.TwoFactor {
+	return &twoFactor{db: d.db}
+}
+
+func (d *dao) Primary() Dao {
+	return &dao{db: d.db, replica: d.db, ids: d.ids}
+}
+
+func (d *dao) WithTx(ctx context.Context, f func(Dao) error) error {
+	return transact(ctx, d.db, func(tx *sqlx.Tx) error {
+		// reads inside the transaction must see its own writes
+		return f(&dao{db: tx, replica: tx, ids: d.ids})
+	})
+}
+
+func (d *dao) Ping(ctx context.Context) error {
+	for _, h := range []handle{d.db, d.replica} {
+		db, ok := h.(*sqlx.DB)
+		if !ok {
+			continue
+		}
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+	return nil
+}
+
+func (d *dao) Close() error {
+	db, ok := d.db.(*sqlx.DB)
+	if !ok {
+		return nil
+	}
+	err := db.Close()
+	if r, ok := d.replica.(*sqlx.DB); ok && r != db {
+		if rerr := r.Close(); err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
 }
 
 func (d *dao) InitAll() error {
-	if err := d.exec("SET FOREIGN_KEY_CHECKS=0"); err != nil {
+	tables := []string{"account", "account_stats", "status", "relation", "media_blob", "attachment", "status_contain_attachment", "confirmation_token", "two_factor", "recovery_code"}
+
+	if isPostgres(d.db) {
+		if err := d.exec("TRUNCATE TABLE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE"); err != nil {
+			return fmt.Errorf("Can't truncate tables: %w", err)
+		}
+		return nil
+	}
+
+	if isSQLite(d.db) {
+		// SQLite has no TRUNCATE, so delete rows from referencing tables first
+		// and reset AUTOINCREMENT counters
+		for i := len(tables) - 1; i >= 0; i-- {
+			if err := d.exec("DELETE FROM " + tables[i]); err != nil {
+				return fmt.Errorf("Can't delete from table "+tables[i]+": %w", err)
+			}
+		}
+		if err := d.exec("DELETE FROM sqlite_sequence"); err != nil {
+			return fmt.Errorf("Can't reset sequences: %w", err)
+		}
+		return nil
+	}
+
+	// FOREIGN_KEY_CHECKS is a session variable, so disabling and restoring it
+	// must happen on the same connection as the TRUNCATEs
+	ctx := context.Background()
+	var conn sqlx.ExecerContext = d.db
+	if db, ok := d.db.(*sqlx.DB); ok {
+		c, err := db.Connx(ctx)
+		if err != nil {
+			return fmt.Errorf("can't get connection: %w", err)
+		}
+		defer c.Close()
+		conn = c
+	}
+
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=0"); err != nil {
 		return fmt.Errorf("can't disable FOREIGN_KEY_CHECKS: %w", err)
 	}
 
 	defer func() {
-		err := d.exec("SET FOREIGN_KEY_CHECKS=0")
+		_, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=1")
 		if err != nil {
 			log.Printf("Can't restore FOREIGN_KEY_CHECKS: %+v", err)
 		}
 	}()
 
-	for _, table := range []string{"account", "status", "relation", "attachment"} {
-		if err := d.exec("TRUNCATE TABLE " + table); err != nil {
+	for _, table := range tables {
+		if _, err := conn.ExecContext(ctx, "TRUNCATE TABLE "+table); err != nil {
 			return fmt.Errorf("Can't truncate table "+table+": %w", err)
 		}
 	}
@@ -86,6 +236,6 @@ func (d *dao) InitAll() error {
 }
 
 func (d *dao) exec(query string, args ...interface{}) error {
-	_, err := d.db.Exec(query, args...)
+	_, err := d.db.ExecContext(context.Background(), query, args...)
 	return err
 }
@@ -2,20 +2,28 @@ package dao_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
+	"yatter-backend-go/app/config"
 	"yatter-backend-go/app/dao"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/domain/repository"
 	"yatter-backend-go/app/handler/parameters"
+	"yatter-backend-go/app/migration"
+	"yatter-backend-go/app/snowflake"
+	"yatter-backend-go/ddl"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,6 +38,23 @@ var preparedStatus = &object.Status{
 
 const notExistingUser = "notexist"
 
+// statusのIDを生成する
+var statusIDs, _ = snowflake.New(0)
+
+// SQLiteのDBファイルを置く一時ディレクトリ
+var sqliteDir string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "yatter-dao-test")
+	if err != nil {
+		panic(err)
+	}
+	sqliteDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 type mockdao struct {
 	db *sqlx.DB
 }
@@ -39,7 +64,7 @@ func (m *mockdao) Account() repository.Account {
 }
 
 func (m *mockdao) Status() repository.Status {
-	return dao.NewStatus(m.db)
+	return dao.NewStatus(m.db, statusIDs)
 }
 
 func (m *mockdao) Relation() repository.Relation {
@@ -50,9 +75,20 @@ func (m *mockdao) Attachment() repository.Attachment {
 	return dao.NewAttachment(m.db)
 }
 
+func (m *mockdao) MediaBlob() repository.MediaBlob {
+	return dao.NewMediaBlob(m.db)
+}
+
+func (m *mockdao) Confirmation() repository.Confirmation {
+	return dao.NewConfirmation(m.db)
+}
+
+func (m *mockdao) TwoFactor() repository.TwoFactor {
+	return dao.NewTwoFactor(m.db)
+}
+
 func initMockDB(config dao.DBConfig) (*sqlx.DB, error) {
-	driverName := "mysql"
-	db, err := sqlx.Open(driverName, config.FormatDSN())
+	db, err := sqlx.Open(config.DriverName(), config.FormatDSN())
 	if err != nil {
 		return nil, fmt.Errorf("sqlx.Open failed: %w", err)
 	}
@@ -61,18 +97,27 @@ func initMockDB(config dao.DBConfig) (*sqlx.DB, error) {
 }
 
 func setupDB() (*mockdao, *sqlx.Tx, error) {
-	daoCfg := testMySQLConfig()
+	daoCfg := testDBConfig()
 	db, err := initMockDB(daoCfg)
 	if err != nil {
 		return nil, nil, err
 	}
-	// トランザクション開始
-	tx, _ := db.Beginx()
-	// テーブルリセット
-	if _, err := db.Exec("SET FOREIGN_KEY_CHECKS=0"); err != nil {
+	// スキーマを最新にする
+	migrations, err := ddl.Migrations(daoCfg.DriverName())
+	if err != nil {
 		return nil, nil, err
 	}
-	for _, table := range []string{"account", "status", "relation", "attachment", "status_contain_attachment"} {
+	m, err := migration.New(db, migrations)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	// トランザクション開始
+	tx, _ := db.Beginx()
+	// テーブルリセット (外部キーで参照している側から消す)
+	for _, table := range []string{"recovery_code", "two_factor", "confirmation_token", "status_contain_attachment", "attachment", "media_blob", "relation", "status", "account_stats", "account"} {
 		if _, err := db.Exec("DELETE FROM " + table); err != nil {
 			return nil, nil, err
 		}
@@ -103,6 +148,10 @@ func TestFindByUsername(t *testing.T) {
 	repo := m.Account()
 	ctx := context.Background()
 
+	// 共有のfixtureは書き換えず、準備したstatusの分を数えた写しと比べる
+	expect := *preparedAccount
+	expect.StatusesCount = 1
+
 	tests := []struct {
 		name          string
 		userName      string
@@ -116,7 +165,7 @@ func TestFindByUsername(t *testing.T) {
 		{
 			name:          "ExistingUser",
 			userName:      preparedAccount.Username,
-			expectAccount: preparedAccount,
+			expectAccount: &expect,
 		},
 	}
 
@@ -129,7 +178,7 @@ func TestFindByUsername(t *testing.T) {
 			if actual == nil && actual == tt.expectAccount {
 				return
 			}
-			opt := cmpopts.IgnoreFields(object.Account{}, "CreateAt")
+			opt := cmpopts.IgnoreFields(object.Account{}, "CreateAt", "LastStatusAt")
 			if d := cmp.Diff(actual, tt.expectAccount, opt); len(d) != 0 {
 				t.Fatalf("differs: (-got +want)\n%s", d)
 			}
@@ -137,6 +186,29 @@ func TestFindByUsername(t *testing.T) {
 	}
 }
 
+func TestIsDuplicate(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	// 同じユーザー名のアカウントは一意制約で弾かれる
+	_, err = m.Account().Insert(ctx, object.Account{Username: preparedAccount.Username})
+	assert.True(t, dao.IsDuplicate(err), "%v", err)
+
+	_, err = m.Account().FindByUsername(ctx, notExistingUser)
+	assert.False(t, dao.IsDuplicate(err))
+
+	// 他のドライバーのエラー
+	assert.True(t, dao.IsDuplicate(fmt.Errorf("%w", &mysql.MySQLError{Number: 1062})))
+	assert.False(t, dao.IsDuplicate(&mysql.MySQLError{Number: 1452}))
+	assert.True(t, dao.IsDuplicate(fmt.Errorf("%w", &pq.Error{Code: "23505"})))
+	assert.False(t, dao.IsDuplicate(&pq.Error{Code: "23503"}))
+}
+
 func TestAccountUpdate(t *testing.T) {
 	m, tx, err := setupDB()
 	if err != nil {
@@ -150,29 +222,54 @@ func TestAccountUpdate(t *testing.T) {
 
 	displayName := "Mike"
 	note := "note"
+	avatar, header, replacement := "attachments/avatar", "attachments/header", "attachments/replacement"
 
 	tests := []struct {
-		name          string
-		account       *object.Account
-		expectErr     bool
-		expectAccount *object.Account
+		name           string
+		account        *object.Account
+		expectErr      bool
+		expectAccount  *object.Account
+		expectReplaced []string
 	}{
 		{
 			name: "Update",
 			account: &object.Account{
-				ID:          preparedAccount.ID,
-				Username:    preparedAccount.Username,
-				DisplayName: &displayName,
-				Note:        &note,
+				ID:            preparedAccount.ID,
+				Username:      preparedAccount.Username,
+				DisplayName:   &displayName,
+				Note:          &note,
+				StatusesCount: 1,
 			},
 			expectErr: false,
 		},
+		{
+			name: "SetImages",
+			account: &object.Account{
+				ID:            preparedAccount.ID,
+				Username:      preparedAccount.Username,
+				Avatar:        &avatar,
+				Header:        &header,
+				StatusesCount: 1,
+			},
+		},
+		{
+			// 置き換えたり外したりした前の画像を返す
+			name: "ReplaceImages",
+			account: &object.Account{
+				ID:            preparedAccount.ID,
+				Username:      preparedAccount.Username,
+				Avatar:        &replacement,
+				StatusesCount: 1,
+			},
+			expectReplaced: []string{avatar, header},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var gotErr bool
-			err := repo.Update(ctx, *tt.account)
+			replaced, err := repo.Update(ctx, *tt.account)
+			assert.Equal(t, tt.expectReplaced, replaced)
 
 			if err != nil {
 				gotErr = true
@@ -189,7 +286,7 @@ func TestAccountUpdate(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			opt := cmpopts.IgnoreFields(object.Account{}, "CreateAt")
+			opt := cmpopts.IgnoreFields(object.Account{}, "CreateAt", "LastStatusAt")
 			if d := cmp.Diff(updated, tt.account, opt); len(d) != 0 {
 				tx.Rollback()
 				t.Fatalf("differs: (-got +want)\n%s", d)
@@ -198,7 +295,7 @@ func TestAccountUpdate(t *testing.T) {
 	}
 }
 
-func TestStatusFindByID(t *testing.T) {
+func TestConfirmEmail(t *testing.T) {
 	m, tx, err := setupDB()
 	if err != nil {
 		t.Fatal(err)
@@ -206,82 +303,64 @@ func TestStatusFindByID(t *testing.T) {
 	defer tx.Rollback()
 	defer m.db.Close()
 
-	repo := m.Status()
+	repo := m.Account()
 	ctx := context.Background()
 
 	tests := []struct {
-		name         string
-		id           object.StatusID
-		expectStatus *object.Status
+		name             string
+		approvalRequired bool
+		approve          bool
+		expectState      object.AccountState
 	}{
 		{
-			name:         "FindNotExistingID",
-			id:           -100,
-			expectStatus: nil,
+			name:        "Open",
+			expectState: object.AccountConfirmed,
 		},
 		{
-			name:         "FindPreparedStatus",
-			id:           preparedStatus.ID,
-			expectStatus: preparedStatus,
+			name:             "WaitingApproval",
+			approvalRequired: true,
+			expectState:      object.AccountPending,
+		},
+		{
+			name:             "Approved",
+			approvalRequired: true,
+			approve:          true,
+			expectState:      object.AccountConfirmed,
 		},
 	}
-
-	for _, tt := range tests {
+	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := repo.FindByID(ctx, tt.id)
+			email := fmt.Sprintf("user%d@example.com", i)
+			id, err := repo.Insert(ctx, object.Account{Username: fmt.Sprintf("user%d", i), Email: &email, State: object.AccountPending})
 			if err != nil {
 				t.Fatal(err)
 			}
-			if actual == nil && actual == tt.expectStatus {
-				return
+			// 承認だけではメールアドレスの確認を待つ
+			if tt.approve {
+				if err := repo.Approve(ctx, id); err != nil {
+					t.Fatal(err)
+				}
+				a, err := repo.FindByEmail(ctx, email)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, object.AccountPending, a.State)
 			}
-			opt := cmpopts.IgnoreFields(object.Status{}, "CreateAt", "Account")
-			if d := cmp.Diff(actual, tt.expectStatus, opt); len(d) != 0 {
-				t.Fatalf("differs: (-got +want)\n%s", d)
+			if err := repo.ConfirmEmail(ctx, id, tt.approvalRequired); err != nil {
+				t.Fatal(err)
 			}
-		})
-	}
-}
-
-func TestStatusDelete(t *testing.T) {
-	m, tx, err := setupDB()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer tx.Rollback()
-	defer m.db.Close()
-
-	repo := m.Status()
-	ctx := context.Background()
-
-	tests := []struct {
-		name        string
-		id          object.StatusID
-		expectIsErr bool
-	}{
-		{
-			name:        "delete",
-			id:          preparedStatus.ID,
-			expectIsErr: false,
-		},
-		{
-			name:        "deleteNotExist",
-			id:          preparedStatus.ID,
-			expectIsErr: true,
-		},
-	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := repo.Delete(ctx, tt.id)
-			if tt.expectIsErr == false && err != nil {
+			a, err := repo.FindByEmail(ctx, email)
+			if err != nil {
 				t.Fatal(err)
 			}
+			assert.Equal(t, tt.expectState, a.State)
+			assert.NotNil(t, a.EmailConfirmedAt)
 		})
 	}
 }
 
-func TestStatusPublicTimeline(t *testing.T) {
+func TestConfirmation(t *testing.T) {
 	m, tx, err := setupDB()
 	if err != nil {
 		t.Fatal(err)
@@ -289,178 +368,753 @@ func TestStatusPublicTimeline(t *testing.T) {
 	defer tx.Rollback()
 	defer m.db.Close()
 
-	timeline := object.Timelines{
-		{
-			Account: preparedAccount,
-			Content: "5000兆円欲しい",
-		},
-		{
-			Account: preparedAccount,
-			Content: "5億年ぶりに焼肉食べた",
-		},
-		{
-			Account: preparedAccount,
-			Content: "スタバわず",
-		},
-		{
-			Account: preparedAccount,
-			Content: "駆け出しエンジニアと繋がりたい",
-		},
-	}
+	repo := m.Confirmation()
 	ctx := context.Background()
-	repo := m.Status()
-	repo.Delete(ctx, preparedStatus.ID)
-	for i, s := range timeline {
-		timeline[i].ID, err = repo.Insert(ctx, s, nil)
-		if err != nil {
-			panic(err)
-		}
+	now := time.Now()
+
+	token := object.ConfirmationToken{Hash: "hash", Purpose: object.PurposeEmail, AccountID: preparedAccount.ID, ExpiresAt: now.Add(time.Hour)}
+	if err := repo.Insert(ctx, token); err != nil {
+		t.Fatal(err)
 	}
 
 	tests := []struct {
-		name           string
-		expectTimeline object.Timelines
-		parameter      *object.Parameters
+		name    string
+		purpose object.TokenPurpose
+		hash    string
+		now     time.Time
+		expect  bool
 	}{
 		{
-			name:           "Fetch",
-			expectTimeline: timeline,
-			parameter:      parameters.Default(),
-		},
-		{
-			name:           "Limit",
-			expectTimeline: timeline[0:1],
-			parameter: &object.Parameters{
-				MaxID:   math.MaxInt64,
-				SinceID: 0,
-				Limit:   1,
-			},
+			name:    "Valid",
+			purpose: object.PurposeEmail,
+			hash:    "hash",
+			now:     now,
+			expect:  true,
 		},
 		{
-			name:           "MaxID",
-			expectTimeline: timeline[0:3],
-			parameter: &object.Parameters{
-				MaxID:   timeline[len(timeline)-1].ID,
-				SinceID: 0,
-				Limit:   80,
-			},
+			name:    "Expired",
+			purpose: object.PurposeEmail,
+			hash:    "hash",
+			now:     now.Add(2 * time.Hour),
 		},
 		{
-			name:           "SinceID",
-			expectTimeline: timeline[1:],
-			parameter: &object.Parameters{
-				MaxID:   math.MaxInt64,
-				SinceID: timeline[0].ID,
-				Limit:   80,
-			},
+			name:    "NotExisting",
+			purpose: object.PurposeEmail,
+			hash:    "other",
+			now:     now,
 		},
 		{
-			name:           "OnlyMedia",
-			expectTimeline: nil,
-			parameter: &object.Parameters{
-				OnlyMedia: true,
-				MaxID:     math.MaxInt64,
-				SinceID:   timeline[0].ID,
-				Limit:     40,
-			},
+			// メールアドレスの確認用のトークンでパスワードは再設定できない
+			name:    "OtherPurpose",
+			purpose: object.PurposePasswordReset,
+			hash:    "hash",
+			now:     now,
 		},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := repo.PublicTimeline(ctx, *tt.parameter)
+			actual, err := repo.FindValid(ctx, tt.purpose, tt.hash, tt.now)
 			if err != nil {
 				t.Fatal(err)
 			}
-			opt := cmpopts.IgnoreTypes(object.DateTime{}, object.StatusID(1))
-			if d := cmp.Diff(actual, tt.expectTimeline, opt); len(d) != 0 {
-				t.Fatalf("differs: (-got +want)\n%s", d)
+			if !tt.expect {
+				assert.Nil(t, actual)
+				return
+			}
+			if assert.NotNil(t, actual) {
+				assert.Equal(t, preparedAccount.ID, actual.AccountID)
 			}
 		})
 	}
-}
 
-func TestFollow(t *testing.T) {
-	m, tx, err := setupDB()
-	if err != nil {
+	// 他の目的のトークンは消さない
+	if err := repo.DeleteByAccountID(ctx, object.PurposePasswordReset, preparedAccount.ID); err != nil {
 		t.Fatal(err)
 	}
-	defer tx.Rollback()
-	defer m.db.Close()
-	ctx := context.Background()
-	target := &object.Account{
-		Username: "john",
+	actual, err := repo.FindValid(ctx, object.PurposeEmail, "hash", now)
+	if err != nil {
+		t.Fatal(err)
 	}
-	m.Account().Insert(ctx, *target)
+	assert.NotNil(t, actual)
 
-	tests := []struct {
-		name   string
-		f      func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao)
-		expect bool
-	}{
-		{
-			name:   "IsFllowingExpectFalse",
-			f:      func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao) {},
-			expect: false,
-		},
-		{
-			name: "Follow",
-			f: func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao) {
-				m.Relation().Follow(ctx, lID, tID)
-			},
-			expect: true,
-		},
-		{
-			name: "UnFollow",
-			f: func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao) {
-				m.Relation().Unfollow(ctx, lID, tID)
-			},
-			expect: false,
-		},
+	if err := repo.DeleteByAccountID(ctx, object.PurposeEmail, preparedAccount.ID); err != nil {
+		t.Fatal(err)
+	}
+	actual, err = repo.FindValid(ctx, object.PurposeEmail, "hash", now)
+	if err != nil {
+		t.Fatal(err)
 	}
+	assert.Nil(t, actual)
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.f(ctx, preparedAccount.ID, target.ID, m)
-			actual, err := m.Relation().IsFollowing(ctx, preparedAccount.ID, target.ID)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expect, actual)
-		})
+	// ハッシュを指定して1つだけ消す
+	for _, hash := range []string{"access1", "access2"} {
+		if err := repo.Insert(ctx, object.ConfirmationToken{Hash: hash, Purpose: object.PurposeAccess, AccountID: preparedAccount.ID, ExpiresAt: now.Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(ctx, "access1"); err != nil {
+		t.Fatal(err)
+	}
+	actual, err = repo.FindValid(ctx, object.PurposeAccess, "access1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, actual)
+	actual, err = repo.FindValid(ctx, object.PurposeAccess, "access2", now)
+	if err != nil {
+		t.Fatal(err)
 	}
+	assert.NotNil(t, actual)
 }
 
-func TestFollowingAndFollowers(t *testing.T) {
+func TestTwoFactor(t *testing.T) {
 	m, tx, err := setupDB()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer tx.Rollback()
 	defer m.db.Close()
+
+	repo := m.TwoFactor()
 	ctx := context.Background()
+	id := preparedAccount.ID
 
-	accounts := []object.Account{
-		{
-			Username:       "user1",
-			FollowingCount: 3,
-			FollowersCount: 0,
-		},
-		{
-			Username:       "user2",
-			FollowingCount: 1,
-			FollowersCount: 1,
-		},
-		{
-			Username:       "user3",
-			FollowingCount: 0,
-			FollowersCount: 2,
-		},
-		{
-			Username:       "user4",
-			FollowingCount: 0,
-			FollowersCount: 1,
-		},
+	findAccount := func() *object.Account {
+		a, err := m.Account().FindByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	// 登録途中は置き換えられ、アカウントには有効と見えない
+	for _, secret := range []string{"first", "second"} {
+		if err := repo.SavePending(ctx, object.TwoFactor{AccountID: id, Secret: secret}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tf, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, tf) {
+		assert.Equal(t, "second", tf.Secret)
+		assert.False(t, tf.IsEnabled())
+	}
+	assert.False(t, findAccount().TwoFactorEnabled)
+
+	if err := repo.Enable(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	tf, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, tf.IsEnabled())
+	assert.True(t, findAccount().TwoFactorEnabled)
+
+	// 有効な秘密鍵は登録し直しても置き換わらない
+	assert.Error(t, repo.SavePending(ctx, object.TwoFactor{AccountID: id, Secret: "third"}))
+
+	// 同じか前の時刻のコードは使えない
+	for _, tt := range []struct {
+		step   int64
+		expect bool
+	}{{100, true}, {100, false}, {99, false}, {101, true}} {
+		ok, err := repo.UseStep(ctx, id, tt.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tt.expect, ok, "step %d", tt.step)
+	}
+
+	// リカバリーコードは一度だけ使え、作り直すと古いものは使えない
+	if err := repo.ReplaceRecoveryCodes(ctx, id, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		hash   string
+		expect bool
+	}{{"a", true}, {"a", false}, {"c", false}} {
+		ok, err := repo.UseRecoveryCode(ctx, id, tt.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tt.expect, ok, "code %s", tt.hash)
+	}
+	if err := repo.ReplaceRecoveryCodes(ctx, id, []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := repo.UseRecoveryCode(ctx, id, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, ok)
+
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	tf, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, tf)
+	assert.False(t, findAccount().TwoFactorEnabled)
+	ok, err = repo.UseRecoveryCode(ctx, id, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, ok)
+}
+
+func TestAccountPurge(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	other := &object.Account{Username: "john"}
+	other.ID, err = m.Account().Insert(ctx, *other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Relation().Follow(ctx, preparedAccount.ID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Relation().Follow(ctx, other.ID, preparedAccount.ID); err != nil {
+		t.Fatal(err)
+	}
+	attachmentID, err := m.Attachment().Insert(ctx, object.Attachment{AccountID: preparedAccount.ID, MediaType: "image", URL: "a/purged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Status().Insert(ctx, *preparedStatus, []object.AttachmentID{attachmentID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Confirmation().Insert(ctx, object.ConfirmationToken{Hash: "hash", Purpose: object.PurposeEmail, AccountID: preparedAccount.ID, ExpiresAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.TwoFactor().SavePending(ctx, object.TwoFactor{AccountID: preparedAccount.ID, Secret: "sealed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.TwoFactor().ReplaceRecoveryCodes(ctx, preparedAccount.ID, []string{"code"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Account().MarkDeleted(ctx, preparedAccount.ID); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := m.Account().FindDeleted(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, preparedAccount.ID, deleted[0].ID)
+	}
+
+	if err := m.Account().Purge(ctx, preparedAccount.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := m.Account().FindByUsername(ctx, preparedAccount.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a)
+	s, err := m.Status().FindByID(ctx, preparedStatus.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, s)
+	attachments, err := m.Attachment().FindByAccountID(ctx, preparedAccount.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, attachments)
+	tf, err := m.TwoFactor().Find(ctx, preparedAccount.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, tf)
+
+	// 相手の集計値からも消える
+	o, err := m.Account().FindByUsername(ctx, other.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, o.FollowersCount)
+	assert.Equal(t, 0, o.FollowingCount)
+}
+
+func TestDeletedAccountHidden(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	other := &object.Account{Username: "john"}
+	other.ID, err = m.Account().Insert(ctx, *other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Relation().Follow(ctx, other.ID, preparedAccount.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Account().MarkDeleted(ctx, preparedAccount.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 消されるまでの間も、アカウントと投稿は見えない
+	a, err := m.Account().FindByUsername(ctx, preparedAccount.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a)
+	a, err = m.Account().FindByID(ctx, preparedAccount.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a)
+	accounts, err := m.Account().FindAccountsByIDs(ctx, []object.AccountID{preparedAccount.ID, other.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, accounts, 1)
+	assert.Contains(t, accounts, other.ID)
+
+	s, err := m.Status().FindByID(ctx, preparedStatus.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, s)
+	statuses, err := m.Status().FindByIDs(ctx, []object.StatusID{preparedStatus.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, statuses)
+	statuses, err = m.Status().PublicTimeline(ctx, *parameters.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, statuses)
+	statuses, err = m.Status().HomeTimeline(ctx, other.ID, *parameters.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, statuses)
+	ids, err := m.Status().HomeStatusIDs(ctx, other.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, ids)
+	follows, err := m.Relation().Following(ctx, other.ID, *parameters.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, follows)
+}
+
+func TestReleaseOnce(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	// 2度目の削除では何も消えない
+	attachmentID, err := m.Attachment().Insert(ctx, object.Attachment{AccountID: preparedAccount.ID, MediaType: "image", URL: "a/released"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Status().Insert(ctx, *preparedStatus, []object.AttachmentID{attachmentID}); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := m.Attachment().Delete(ctx, attachmentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, deleted)
+	deleted, err = m.Attachment().Delete(ctx, attachmentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, deleted)
+
+	// アイコンとヘッダーが同じ画像なら2つ外れ、2度目は外れない
+	image := "attachments/image"
+	account := *preparedAccount
+	account.Avatar, account.Header = &image, &image
+	if _, err := m.Account().Update(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+	n, err := m.Account().UnsetImage(ctx, preparedAccount.ID, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, n)
+	n, err = m.Account().UnsetImage(ctx, preparedAccount.ID, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, n)
+	a, err := m.Account().FindByID(ctx, preparedAccount.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a.Avatar)
+	assert.Nil(t, a.Header)
+}
+
+func TestStatusFindByID(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+
+	repo := m.Status()
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		id           object.StatusID
+		expectStatus *object.Status
+	}{
+		{
+			name:         "FindNotExistingID",
+			id:           -100,
+			expectStatus: nil,
+		},
+		{
+			name:         "FindPreparedStatus",
+			id:           preparedStatus.ID,
+			expectStatus: preparedStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := repo.FindByID(ctx, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual == nil && actual == tt.expectStatus {
+				return
+			}
+			opt := cmpopts.IgnoreFields(object.Status{}, "CreateAt", "Account")
+			if d := cmp.Diff(actual, tt.expectStatus, opt); len(d) != 0 {
+				t.Fatalf("differs: (-got +want)\n%s", d)
+			}
+		})
+	}
+}
+
+// statusの投稿者のフォロー数とフォロワー数を取り違えない
+func TestStatusAccountCounts(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	target := &object.Account{Username: "john"}
+	target.ID, err = m.Account().Insert(ctx, *target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Relation().Follow(ctx, preparedAccount.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+	targetStatus, err := m.Status().Insert(ctx, object.Status{Account: target, Content: "c"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T) {
+		follower, err := m.Status().FindByID(ctx, preparedStatus.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, follower.Account.FollowingCount)
+		assert.Equal(t, 0, follower.Account.FollowersCount)
+
+		followed, err := m.Status().FindByID(ctx, targetStatus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 0, followed.Account.FollowingCount)
+		assert.Equal(t, 1, followed.Account.FollowersCount)
+	}
+
+	t.Run("Maintained", check)
+
+	// 数え直しても同じ
+	if _, err := m.Account().RecountStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Recounted", check)
+}
+
+func TestStatusDelete(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+
+	repo := m.Status()
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		id          object.StatusID
+		expectIsErr bool
+	}{
+		{
+			name:        "delete",
+			id:          preparedStatus.ID,
+			expectIsErr: false,
+		},
+		{
+			name:        "deleteNotExist",
+			id:          preparedStatus.ID,
+			expectIsErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := repo.Delete(ctx, tt.id)
+			if tt.expectIsErr == false && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestStatusPublicTimeline(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+
+	// 投稿数を書き換えるので、共有のfixtureではなく写しを使う
+	author := *preparedAccount
+	timeline := object.Timelines{
+		{
+			Account: &author,
+			Content: "5000兆円欲しい",
+		},
+		{
+			Account: &author,
+			Content: "5億年ぶりに焼肉食べた",
+		},
+		{
+			Account: &author,
+			Content: "スタバわず",
+		},
+		{
+			Account: &author,
+			Content: "駆け出しエンジニアと繋がりたい",
+		},
+	}
+	ctx := context.Background()
+	repo := m.Status()
+	repo.Delete(ctx, preparedStatus.ID)
+	for i, s := range timeline {
+		timeline[i].ID, err = repo.Insert(ctx, s, nil)
+		if err != nil {
+			panic(err)
+		}
+	}
+	author.StatusesCount = len(timeline)
+	// 新しい順
+	newest := make(object.Timelines, len(timeline))
+	for i := range timeline {
+		newest[len(timeline)-1-i] = timeline[i]
+	}
+
+	tests := []struct {
+		name           string
+		expectTimeline object.Timelines
+		parameter      *object.Parameters
+	}{
+		{
+			name:           "Fetch",
+			expectTimeline: newest,
+			parameter:      parameters.Default(),
+		},
+		{
+			name:           "Limit",
+			expectTimeline: newest[0:1],
+			parameter: &object.Parameters{
+				MaxID:   math.MaxInt64,
+				SinceID: 0,
+				Limit:   1,
+			},
+		},
+		{
+			name:           "MaxID",
+			expectTimeline: newest[1:],
+			parameter: &object.Parameters{
+				MaxID:   int64(timeline[len(timeline)-1].ID),
+				SinceID: 0,
+				Limit:   80,
+			},
+		},
+		{
+			name:           "SinceID",
+			expectTimeline: newest[:3],
+			parameter: &object.Parameters{
+				MaxID:   math.MaxInt64,
+				SinceID: int64(timeline[0].ID),
+				Limit:   80,
+			},
+		},
+		{
+			// min_idの直後から数えて、新しい順に返す
+			name:           "MinID",
+			expectTimeline: object.Timelines{timeline[2], timeline[1]},
+			parameter: &object.Parameters{
+				MaxID: math.MaxInt64,
+				MinID: int64(timeline[0].ID),
+				Limit: 2,
+			},
+		},
+		{
+			// IDは投稿時刻の順に並ぶので、時刻から求めたIDで絞り込める
+			name:           "Time",
+			expectTimeline: newest,
+			parameter: &object.Parameters{
+				MaxID: snowflake.FromTime(time.Now().Add(time.Minute)),
+				MinID: snowflake.FromTime(time.Now().Add(-time.Minute)),
+				Limit: 80,
+			},
+		},
+		{
+			name:           "OnlyMedia",
+			expectTimeline: nil,
+			parameter: &object.Parameters{
+				OnlyMedia: true,
+				MaxID:     math.MaxInt64,
+				SinceID:   int64(timeline[0].ID),
+				Limit:     40,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := repo.PublicTimeline(ctx, *tt.parameter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opt := cmpopts.IgnoreTypes(object.DateTime{}, &object.DateTime{}, object.StatusID(1))
+			if d := cmp.Diff(actual, tt.expectTimeline, opt); len(d) != 0 {
+				t.Fatalf("differs: (-got +want)\n%s", d)
+			}
+		})
+	}
+}
+
+func TestFollow(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+	target := &object.Account{
+		Username: "john",
+	}
+	target.ID, err = m.Account().Insert(ctx, *target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		f      func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao)
+		expect bool
+	}{
+		{
+			name:   "IsFllowingExpectFalse",
+			f:      func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao) {},
+			expect: false,
+		},
+		{
+			name: "Follow",
+			f: func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao) {
+				m.Relation().Follow(ctx, lID, tID)
+			},
+			expect: true,
+		},
+		{
+			name: "UnFollow",
+			f: func(ctx context.Context, lID object.AccountID, tID object.AccountID, m *mockdao) {
+				m.Relation().Unfollow(ctx, lID, tID)
+			},
+			expect: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(ctx, preparedAccount.ID, target.ID, m)
+			actual, err := m.Relation().IsFollowing(ctx, preparedAccount.ID, target.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.expect, actual)
+		})
+	}
+}
+
+func TestFollowingAndFollowers(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	accounts := []object.Account{
+		{
+			Username:       "user1",
+			FollowingCount: 3,
+			FollowersCount: 0,
+		},
+		{
+			Username:       "user2",
+			FollowingCount: 1,
+			FollowersCount: 1,
+		},
+		{
+			Username:       "user3",
+			FollowingCount: 0,
+			FollowersCount: 2,
+		},
+		{
+			Username:       "user4",
+			FollowingCount: 0,
+			FollowersCount: 1,
+		},
 	}
 	for i, a := range accounts {
 		accounts[i].ID, err = m.Account().Insert(ctx, a)
@@ -470,16 +1124,24 @@ func TestFollowingAndFollowers(t *testing.T) {
 	}
 
 	/*
-		user1 -> user2
+		フォローした順で、アカウントIDの順とは違う
 		user1 -> user3
 		user1 -> user4
+		user1 -> user2
 		user2 -> user3
 	*/
-	m.Relation().Follow(ctx, accounts[0].ID, accounts[1].ID)
 	m.Relation().Follow(ctx, accounts[0].ID, accounts[2].ID)
 	m.Relation().Follow(ctx, accounts[0].ID, accounts[3].ID)
+	m.Relation().Follow(ctx, accounts[0].ID, accounts[1].ID)
 	m.Relation().Follow(ctx, accounts[1].ID, accounts[2].ID)
 
+	all, err := m.Relation().Following(ctx, accounts[0].ID, *parameters.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// user1 -> user3 のフォローのID
+	oldest := all[len(all)-1].ID
+
 	tests := []struct {
 		name            string
 		id              object.AccountID
@@ -490,14 +1152,14 @@ func TestFollowingAndFollowers(t *testing.T) {
 		{
 			name:            "user1",
 			id:              accounts[0].ID,
-			expectFollowing: accounts[1:4],
+			expectFollowing: []object.Account{accounts[1], accounts[3], accounts[2]},
 			expectFollowers: nil,
 			parameter:       parameters.Default(),
 		},
 		{
 			name:            "user1Limit",
 			id:              accounts[0].ID,
-			expectFollowing: accounts[1:3],
+			expectFollowing: []object.Account{accounts[1], accounts[3]},
 			expectFollowers: nil,
 			parameter: &object.Parameters{
 				MaxID:   math.MaxInt64,
@@ -505,11 +1167,22 @@ func TestFollowingAndFollowers(t *testing.T) {
 				Limit:   2,
 			},
 		},
+		{
+			name:            "user1MinID",
+			id:              accounts[0].ID,
+			expectFollowing: []object.Account{accounts[3]},
+			expectFollowers: nil,
+			parameter: &object.Parameters{
+				MaxID: math.MaxInt64,
+				MinID: oldest,
+				Limit: 1,
+			},
+		},
 		{
 			name:            "user3",
 			id:              accounts[2].ID,
 			expectFollowing: nil,
-			expectFollowers: accounts[0:2],
+			expectFollowers: []object.Account{accounts[1], accounts[0]},
 			parameter:       parameters.Default(),
 		},
 	}
@@ -521,7 +1194,7 @@ func TestFollowingAndFollowers(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			if d := cmp.Diff(actualFollowing, tt.expectFollowing, opt); len(d) != 0 {
+			if d := cmp.Diff(followed(t, actualFollowing), tt.expectFollowing, opt); len(d) != 0 {
 				t.Fatalf("following differs: (-got +want)\n%s", d)
 			}
 
@@ -530,13 +1203,25 @@ func TestFollowingAndFollowers(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			if d := cmp.Diff(actualFollowers, tt.expectFollowers, opt); len(d) != 0 {
+			if d := cmp.Diff(followed(t, actualFollowers), tt.expectFollowers, opt); len(d) != 0 {
 				t.Fatalf("followers differs: (-got +want)\n%s", d)
 			}
 		})
 	}
 }
 
+// Accounts of follows, checking that the newest follow comes first
+func followed(t *testing.T, follows []object.Follow) []object.Account {
+	var accounts []object.Account
+	for i, f := range follows {
+		if i > 0 && follows[i-1].ID <= f.ID {
+			t.Errorf("follow %d is not older than %d", f.ID, follows[i-1].ID)
+		}
+		accounts = append(accounts, f.Account)
+	}
+	return accounts
+}
+
 func TestHomeTimeline(t *testing.T) {
 	m, tx, err := setupDB()
 	if err != nil {
@@ -556,16 +1241,19 @@ func TestHomeTimeline(t *testing.T) {
 			Username:       "user2",
 			FollowingCount: 1,
 			FollowersCount: 1,
+			StatusesCount:  1,
 		},
 		{
 			Username:       "user3",
 			FollowingCount: 0,
 			FollowersCount: 2,
+			StatusesCount:  1,
 		},
 		{
 			Username:       "user4",
 			FollowingCount: 0,
 			FollowersCount: 1,
+			StatusesCount:  1,
 		},
 		{
 			Username: "user5",
@@ -618,13 +1306,13 @@ func TestHomeTimeline(t *testing.T) {
 		{
 			name:      "Home",
 			id:        accounts[1].ID,
-			expect:    timeline[0:2],
+			expect:    object.Timelines{timeline[1], timeline[0]},
 			parameter: *parameters.Default(),
 		},
 		{
 			name:   "LimitHome",
 			id:     accounts[0].ID,
-			expect: timeline[0:2],
+			expect: object.Timelines{timeline[2], timeline[1]},
 			parameter: object.Parameters{
 				MaxID:   math.MaxInt64,
 				SinceID: 0,
@@ -646,20 +1334,189 @@ func TestHomeTimeline(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := m.Status().HomeTimeline(ctx, tt.id, tt.parameter)
+			actual, err := m.Status().HomeTimeline(ctx, tt.id, tt.parameter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opt := cmpopts.IgnoreTypes(object.DateTime{}, &object.DateTime{})
+			if d := cmp.Diff(actual, tt.expect, opt); len(d) != 0 {
+				t.Fatalf("differs: (-got +want)\n%s", d)
+			}
+		})
+	}
+}
+
+func TestAccountStats(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	target := &object.Account{Username: "john"}
+	target.ID, err = m.Account().Insert(ctx, *target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := func(username string) object.Account {
+		a, err := m.Account().FindByUsername(ctx, username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *a
+	}
+
+	// 作成直後は全て0
+	a := stats(target.Username)
+	assert.Equal(t, 0, a.StatusesCount)
+	assert.Nil(t, a.LastStatusAt)
+
+	if err := m.Relation().Follow(ctx, preparedAccount.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Status().Insert(ctx, object.Status{Account: target, Content: "c"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = stats(target.Username)
+	assert.Equal(t, 1, a.FollowersCount)
+	assert.Equal(t, 1, a.StatusesCount)
+	assert.NotNil(t, a.LastStatusAt)
+	assert.Equal(t, 1, stats(preparedAccount.Username).FollowingCount)
+
+	// フォローしていない相手のフォロー解除では数が変わらない
+	for i := 0; i < 2; i++ {
+		if err := m.Relation().Unfollow(ctx, preparedAccount.ID, target.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Status().Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	a = stats(target.Username)
+	assert.Equal(t, 0, a.FollowersCount)
+	assert.Equal(t, 0, a.StatusesCount)
+	assert.Nil(t, a.LastStatusAt)
+	assert.Equal(t, 0, stats(preparedAccount.Username).FollowingCount)
+
+	// 壊れた集計値を数え直す
+	if _, err := m.db.Exec("UPDATE account_stats SET statuses_count = 10, followers_count = 5"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := m.Account().RecountStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(2), n)
+	a = stats(preparedAccount.Username)
+	assert.Equal(t, 1, a.StatusesCount)
+	assert.Equal(t, 0, a.FollowersCount)
+	assert.NotNil(t, a.LastStatusAt)
+}
+
+func TestIsAttachable(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	description := "description"
+	attachments := []object.Attachment{
+		{
+			AccountID:   preparedAccount.ID,
+			MediaType:   "image",
+			URL:         "a/a",
+			Description: &description,
+		},
+		{
+			AccountID:   preparedAccount.ID,
+			MediaType:   "image",
+			URL:         "a/b",
+			Description: &description,
+		},
+		{
+			AccountID:   preparedAccount.ID,
+			MediaType:   "image",
+			URL:         "a/c",
+			Description: &description,
+		},
+	}
+
+	var attachmentsIDs []object.AttachmentID
+	for i, a := range attachments {
+		attachments[i].ID, err = m.Attachment().Insert(ctx, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attachmentsIDs = append(attachmentsIDs, attachments[i].ID)
+	}
+	// 3つ目は既にstatusに添付済み
+	if _, err := m.Status().Insert(ctx, *preparedStatus, attachmentsIDs[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	other := object.Account{Username: "other"}
+	other.ID, err = m.Account().Insert(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		accountID object.AccountID
+		ids       []object.AttachmentID
+		expect    bool
+	}{
+		{
+			name:      "ExpectTrue",
+			accountID: preparedAccount.ID,
+			ids:       attachmentsIDs[:2],
+			expect:    true,
+		},
+		{
+			name:      "Duplicated",
+			accountID: preparedAccount.ID,
+			ids:       []object.AttachmentID{attachmentsIDs[0], attachmentsIDs[0]},
+			expect:    true,
+		},
+		{
+			name:      "NotExisting",
+			accountID: preparedAccount.ID,
+			ids:       append(attachmentsIDs[:2:2], -10),
+			expect:    false,
+		},
+		{
+			name:      "OtherAccount",
+			accountID: other.ID,
+			ids:       attachmentsIDs[:2],
+			expect:    false,
+		},
+		{
+			name:      "AlreadyUsed",
+			accountID: preparedAccount.ID,
+			ids:       attachmentsIDs,
+			expect:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := m.Attachment().IsAttachable(ctx, tt.accountID, tt.ids)
 			if err != nil {
 				t.Fatal(err)
 			}
-
-			opt := cmpopts.IgnoreTypes(object.DateTime{})
-			if d := cmp.Diff(actual, tt.expect, opt); len(d) != 0 {
-				t.Fatalf("differs: (-got +want)\n%s", d)
-			}
+			assert.Equal(t, tt.expect, actual)
 		})
 	}
 }
 
-func TestHasAttachmentIDs(t *testing.T) {
+func TestFindOrphans(t *testing.T) {
 	m, tx, err := setupDB()
 	if err != nil {
 		t.Fatal(err)
@@ -668,56 +1525,131 @@ func TestHasAttachmentIDs(t *testing.T) {
 	defer m.db.Close()
 	ctx := context.Background()
 
-	description := "description"
 	attachments := []object.Attachment{
 		{
-			MediaType:   "image",
-			URL:         "a/a",
-			Description: &description,
+			AccountID: preparedAccount.ID,
+			MediaType: "image",
+			URL:       "a/unused",
 		},
 		{
-			MediaType:   "image",
-			URL:         "a/b",
-			Description: &description,
+			AccountID: preparedAccount.ID,
+			MediaType: "image",
+			URL:       "a/used",
+		},
+		{
+			AccountID: preparedAccount.ID,
+			MediaType: "image",
+			URL:       "a/deleted",
 		},
 	}
-
-	var attachmentsIDs []object.AttachmentID
 	for i, a := range attachments {
 		attachments[i].ID, err = m.Attachment().Insert(ctx, a)
 		if err != nil {
 			t.Fatal(err)
 		}
-		attachmentsIDs = append(attachmentsIDs, attachments[i].ID)
+	}
+	if _, err := m.Status().Insert(ctx, *preparedStatus, []object.AttachmentID{attachments[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := m.Status().Insert(ctx, *preparedStatus, []object.AttachmentID{attachments[2].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Status().Delete(ctx, deleted); err != nil {
+		t.Fatal(err)
 	}
 
 	tests := []struct {
 		name   string
-		ids    []object.AttachmentID
-		expect bool
+		before time.Time
+		expect []string
 	}{
 		{
-			name:   "ExpectTrue",
-			ids:    attachmentsIDs,
-			expect: true,
+			name:   "OnlyDeletedStatus",
+			before: time.Now().Add(-time.Hour),
+			expect: []string{"a/deleted"},
 		},
 		{
-			name:   "ExpectFalse",
-			ids:    append(attachmentsIDs, -10),
-			expect: false,
+			name:   "ExpiredUnused",
+			before: time.Now().Add(time.Hour),
+			expect: []string{"a/unused", "a/deleted"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := m.Attachment().HasAttachmentIDs(ctx, tt.ids)
-			if err != nil {
-				t.Fatal(err)
+			// 1件ずつ続きを取得する
+			var urls []string
+			var after object.AttachmentID
+			for {
+				actual, err := m.Attachment().FindOrphans(ctx, tt.before, after, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(actual) == 0 {
+					break
+				}
+				after = actual[0].ID
+				urls = append(urls, actual[0].URL)
 			}
-			assert.Equal(t, tt.expect, actual)
+			assert.Equal(t, tt.expect, urls)
 		})
 	}
 }
 
+func TestDeleteOrphan(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	var ids []object.AttachmentID
+	for _, url := range []string{"a/posted", "a/unused"} {
+		id, err := m.Attachment().Insert(ctx, object.Attachment{AccountID: preparedAccount.ID, MediaType: "image", URL: url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	before := time.Now().Add(time.Hour)
+	orphans, err := m.Attachment().FindOrphans(ctx, before, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, orphans, 2)
+
+	// 見つけた後に投稿されたattachmentは消さない
+	statusID, err := m.Status().Insert(ctx, *preparedStatus, []object.AttachmentID{ids[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := m.Attachment().DeleteOrphan(ctx, ids[0], before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, deleted)
+	attachments, err := m.Attachment().FindByStatusID(ctx, statusID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, attachments, 1) {
+		assert.Equal(t, "a/posted", attachments[0].URL)
+	}
+
+	deleted, err = m.Attachment().DeleteOrphan(ctx, ids[1], before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, deleted)
+	deleted, err = m.Attachment().DeleteOrphan(ctx, ids[1], before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, deleted)
+}
+
 func TestFindByStatusID(t *testing.T) {
 	m, tx, err := setupDB()
 	if err != nil {
@@ -730,11 +1662,13 @@ func TestFindByStatusID(t *testing.T) {
 	description := "description"
 	attachments := []object.Attachment{
 		{
+			AccountID:   preparedAccount.ID,
 			MediaType:   "image",
 			URL:         "a/a",
 			Description: &description,
 		},
 		{
+			AccountID:   preparedAccount.ID,
 			MediaType:   "image",
 			URL:         "a/b",
 			Description: &description,
@@ -796,46 +1730,330 @@ func TestFindByStatusID(t *testing.T) {
 	}
 }
 
-func getString(key string) (string, error) {
-	v := os.Getenv(key)
-	if v == "" {
-		return "", fmt.Errorf("[%s] not found", key)
+func TestBatchLoad(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
 	}
-	return v, nil
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	other := &object.Account{Username: "john"}
+	other.ID, err = m.Account().Insert(ctx, *other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachment := object.Attachment{AccountID: other.ID, MediaType: "image", URL: "a/a"}
+	attachment.ID, err = m.Attachment().Insert(ctx, attachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Status().Insert(ctx, object.Status{Account: other, Content: "c"}, []object.AttachmentID{attachment.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status().FindByIDs(ctx, []object.StatusID{id, preparedStatus.ID, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, id, statuses[0].ID)
+		assert.Equal(t, other.ID, statuses[0].Account.ID)
+		assert.Equal(t, preparedStatus.ID, statuses[1].ID)
+		assert.Equal(t, preparedAccount.ID, statuses[1].Account.ID)
+	}
+
+	accounts, err := m.Account().FindAccountsByIDs(ctx, []object.AccountID{preparedAccount.ID, other.ID, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, accounts, 2)
+	assert.Equal(t, preparedAccount.Username, accounts[preparedAccount.ID].Username)
+	assert.Equal(t, 1, accounts[other.ID].StatusesCount)
+
+	attachments, err := m.Attachment().FindByStatusIDs(ctx, []object.StatusID{id, preparedStatus.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[object.StatusID][]object.Attachment{id: {attachment}}, attachments)
+
+	// 空の一覧ではクエリを発行しない
+	empty, err := m.Attachment().FindByStatusIDs(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, empty)
 }
 
-func host() string {
-	v, err := getString("TEST_MYSQL_HOST")
+func TestMediaBlob(t *testing.T) {
+	m, tx, err := setupDB()
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	defer m.db.Close()
+	ctx := context.Background()
+
+	blob := object.MediaBlob{Hash: "hash", Size: 5}
+	for i := 0; i < 2; i++ {
+		if err := m.MediaBlob().Acquire(ctx, blob); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		removeErr error
+		expect    bool
+		removed   bool
+	}{
+		{
+			name:    "StillReferenced",
+			expect:  false,
+			removed: false,
+		},
+		{
+			// ファイルを消せなければ参照は残る
+			name:      "RemoveFailed",
+			removeErr: errors.New("remove failed"),
+			expect:    false,
+			removed:   true,
+		},
+		{
+			name:    "LastReference",
+			expect:  true,
+			removed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed := false
+			actual, err := m.MediaBlob().Release(ctx, blob.Hash, func() error {
+				removed = true
+				return tt.removeErr
+			})
+			if tt.removeErr != nil {
+				assert.ErrorIs(t, err, tt.removeErr)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.expect, actual)
+			assert.Equal(t, tt.removed, removed)
+		})
 	}
-	return v
 }
 
-func user() string {
-	v, err := getString("TEST_MYSQL_USER")
+// 読み取りはレプリカ、書き込みとPrimary()経由の読み取りはプライマリに向かう
+func TestReplicaRouting(t *testing.T) {
+	dir := t.TempDir()
+	primaryCfg := &config.SQLiteDB{Path: filepath.Join(dir, "primary.db")}
+	replicaCfg := &config.SQLiteDB{Path: filepath.Join(dir, "replica.db")}
+	for _, cfg := range []dao.DBConfig{primaryCfg, replicaCfg} {
+		db, err := dao.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrations, err := ddl.Migrations(cfg.DriverName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := migration.New(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+	}
+
+	d, err := dao.New(primaryCfg, replicaCfg, dao.PoolConfig{MaxOpenConns: 2, MaxIdleConns: 2}, statusIDs)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	return v
+	ctx := context.Background()
+
+	if _, err := d.Account().Insert(ctx, object.Account{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+	// レプリカには複製されていない
+	a, err := d.Account().FindByUsername(ctx, "john")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a)
+
+	a, err = d.Primary().Account().FindByUsername(ctx, "john")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, a)
+
+	// 閉じるとプライマリもレプリカも使えない
+	assert.NoError(t, d.Close())
+	_, err = d.Account().FindByUsername(ctx, "john")
+	assert.Error(t, err)
+	_, err = d.Primary().Account().FindByUsername(ctx, "john")
+	assert.Error(t, err)
 }
 
-func password() string {
-	v, err := getString("TEST_MYSQL_PASSWORD")
+func TestWithTx(t *testing.T) {
+	m, tx, err := setupDB()
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	return v
+	defer tx.Rollback()
+	m.db.Close()
+
+	d, err := dao.New(testDBConfig(), nil, dao.PoolConfig{MaxOpenConns: 2, MaxIdleConns: 2}, statusIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	// アカウントとstatusを作成し、トランザクション内で読めることを確かめる
+	insert := func(tx dao.Dao, username string) error {
+		id, err := tx.Account().Insert(ctx, object.Account{Username: username})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Status().Insert(ctx, object.Status{Account: &object.Account{ID: id}, Content: "in tx"}, nil); err != nil {
+			return err
+		}
+		a, err := tx.Account().FindByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+		assert.NotNil(t, a)
+		assert.Equal(t, 1, a.StatusesCount)
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		f        func(tx dao.Dao) error
+		wantErr  error
+		panics   bool
+		exists   bool
+	}{
+		{
+			name:     "Commit",
+			username: "committed",
+			f:        func(tx dao.Dao) error { return insert(tx, "committed") },
+			exists:   true,
+		},
+		{
+			name:     "RollbackOnError",
+			username: "failed",
+			f: func(tx dao.Dao) error {
+				if err := insert(tx, "failed"); err != nil {
+					return err
+				}
+				return errAbort
+			},
+			wantErr: errAbort,
+		},
+		{
+			name:     "RollbackOnPanic",
+			username: "panicked",
+			f: func(tx dao.Dao) error {
+				if err := insert(tx, "panicked"); err != nil {
+					return err
+				}
+				panic("abort")
+			},
+			panics: true,
+		},
+		{
+			name:     "Nested",
+			username: "nested",
+			f: func(tx dao.Dao) error {
+				// 内側のWithTxは外側のトランザクションに参加する
+				if err := tx.WithTx(ctx, func(inner dao.Dao) error { return insert(inner, "nested") }); err != nil {
+					return err
+				}
+				return errAbort
+			},
+			wantErr: errAbort,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.panics {
+				assert.Panics(t, func() { d.WithTx(ctx, tt.f) })
+			} else {
+				err := d.WithTx(ctx, tt.f)
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+
+			a, err := d.Account().FindByUsername(ctx, tt.username)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.exists, a != nil)
+		})
+	}
+
+	// ロールバックされた投稿は残らない
+	timeline, err := d.Status().PublicTimeline(ctx, object.Parameters{MaxID: math.MaxInt64, Limit: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, timeline, 2)
+}
+
+// DBの接続情報
+type testConfig struct {
+	driver string
+	dsn    string
+}
+
+func (c *testConfig) DriverName() string {
+	return c.driver
+}
+
+func (c *testConfig) FormatDSN() string {
+	return c.dsn
+}
+
+func getString(key string) (string, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return "", fmt.Errorf("[%s] not found", key)
+	}
+	return v, nil
 }
 
-func database() string {
-	v, err := getString("TEST_MYSQL_DATABASE")
+func mustGetString(key string) string {
+	v, err := getString(key)
 	if err != nil {
 		panic(err)
 	}
 	return v
 }
 
+// TEST_DB_DRIVERで接続するDBを選ぶ (mysql, postgres or sqlite, デフォルトはsqlite)
+func testDBConfig() dao.DBConfig {
+	driver, err := getString("TEST_DB_DRIVER")
+	if err != nil {
+		driver = "sqlite"
+	}
+	switch driver {
+	case "sqlite":
+		return &config.SQLiteDB{Path: filepath.Join(sqliteDir, "test.db")}
+	case "mysql":
+		return &testConfig{driver: driver, dsn: testMySQLConfig().FormatDSN()}
+	case "postgres":
+		return &testConfig{driver: driver, dsn: testPostgresDSN()}
+	}
+	panic(fmt.Sprintf("unknown TEST_DB_DRIVER %q", driver))
+}
+
 func location() *time.Location {
 	tz, err := getString("MYSQL_TZ")
 	if err != nil {
@@ -853,13 +2071,56 @@ func testMySQLConfig() *mysql.Config {
 
 	cfg.ParseTime = true
 	cfg.Loc = location()
-	if host := host(); host != "" {
+	if host := mustGetString("TEST_MYSQL_HOST"); host != "" {
 		cfg.Net = "tcp"
 		cfg.Addr = host
 	}
-	cfg.User = user()
-	cfg.Passwd = password()
-	cfg.DBName = database()
+	cfg.User = mustGetString("TEST_MYSQL_USER")
+	cfg.Passwd = mustGetString("TEST_MYSQL_PASSWORD")
+	cfg.DBName = mustGetString("TEST_MYSQL_DATABASE")
 
 	return cfg
 }
+
+func testPostgresDSN() string {
+	u := &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(mustGetString("TEST_POSTGRES_USER"), mustGetString("TEST_POSTGRES_PASSWORD")),
+		Host:     mustGetString("TEST_POSTGRES_HOST"),
+		Path:     "/" + mustGetString("TEST_POSTGRES_DATABASE"),
+		RawQuery: "sslmode=disable",
+	}
+	return u.String()
+}
+
+// 全て消した後も外部キーの制約は効いている
+func TestInitAll(t *testing.T) {
+	m, tx, err := setupDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	m.db.Close()
+
+	// MySQLのセッション変数は接続ごとなので、複数の接続を使わせる
+	d, err := dao.New(testDBConfig(), nil, dao.PoolConfig{MaxOpenConns: 4, MaxIdleConns: 4}, statusIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	ctx := context.Background()
+
+	if err := d.InitAll(); err != nil {
+		t.Fatal(err)
+	}
+	a, err := d.Account().FindByUsername(ctx, preparedAccount.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, a)
+
+	for i := 0; i < 4; i++ {
+		_, err := d.Status().Insert(ctx, object.Status{Account: &object.Account{ID: -1}, Content: "orphan"}, nil)
+		assert.Error(t, err)
+	}
+}
@@ -1,23 +1,123 @@
 package dao
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"yatter-backend-go/app/tracing"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 // Interface of configureation
 type DBConfig interface {
+	// Name of database/sql driver, "mysql", "postgres" or "sqlite"
+	DriverName() string
+
 	FormatDSN() string
 }
 
-// Prepare sqlx.DB
-func initDb(config DBConfig) (*sqlx.DB, error) {
-	driverName := "mysql"
-	db, err := sqlx.Open(driverName, config.FormatDSN())
+// Prepare sqlx.DB, recording a span of each statement
+func Open(config DBConfig) (*sqlx.DB, error) {
+	// sql.Open only looks up the driver without connecting
+	raw, err := sql.Open(config.DriverName(), config.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open failed: %w", err)
+	}
+	drv := raw.Driver()
+	raw.Close()
+
+	connector, err := tracing.Connector(drv, config.DriverName(), config.FormatDSN())
 	if err != nil {
-		return nil, fmt.Errorf("sqlx.Open failed: %w", err)
+		return nil, fmt.Errorf("%w", err)
+	}
+	return sqlx.NewDb(sql.OpenDB(connector), config.DriverName()), nil
+}
+
+// Database handle used by repositories.
+// It is *sqlx.DB, or *sqlx.Tx for repositories created inside Dao.WithTx
+type handle interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// Run f in a transaction, committing if it succeeds and rolling back on error or panic.
+// If db is already a transaction, f joins it and the outermost caller commits.
+func transact(ctx context.Context, db handle, f func(tx *sqlx.Tx) error) (err error) {
+	if tx, ok := db.(*sqlx.Tx); ok {
+		return f(tx)
+	}
+
+	tx, err := db.(*sqlx.DB).BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w", err)
 	}
+	return nil
+}
+
+// Whether err is a violation of a unique key, like a row inserted concurrently with the same username.
+// MySQL reports it as error 1062, PostgreSQL as SQLSTATE 23505 and SQLite only by the message.
+func IsDuplicate(err error) bool {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		return me.Number == 1062
+	}
+	var pe *pq.Error
+	if errors.As(err, &pe) {
+		return pe.Code == "23505"
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// Whether the database is PostgreSQL
+func isPostgres(db sqlx.ExtContext) bool {
+	return db.DriverName() == "postgres"
+}
 
-	return db, nil
+// Whether the database is SQLite
+func isSQLite(db sqlx.ExtContext) bool {
+	return db.DriverName() == "sqlite"
+}
+
+// Execute INSERT statement and return id of the inserted row.
+// PostgreSQL has no LastInsertId, so the id is read with RETURNING.
+func insert(ctx context.Context, db sqlx.ExtContext, query string, args ...interface{}) (int64, error) {
+	if isPostgres(db) {
+		var id int64
+		err := db.QueryRowxContext(ctx, db.Rebind(query+" RETURNING id"), args...).Scan(&id)
+		if err != nil {
+			return -1, fmt.Errorf("%w", err)
+		}
+		return id, nil
+	}
+
+	result, err := db.ExecContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return -1, fmt.Errorf("%w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("%w", err)
+	}
+	return id, nil
 }
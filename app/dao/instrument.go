@@ -0,0 +1,412 @@
+package dao
+
+import (
+	"context"
+	"time"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/metrics"
+	"yatter-backend-go/app/tracing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+type (
+	// DAO observing durations of repository methods in metrics and spans
+	instrumented struct {
+		Dao
+	}
+
+	instrumentedAccount struct {
+		repo repository.Account
+	}
+
+	instrumentedStatus struct {
+		repo repository.Status
+	}
+
+	instrumentedRelation struct {
+		repo repository.Relation
+	}
+
+	instrumentedAttachment struct {
+		repo repository.Attachment
+	}
+
+	instrumentedMediaBlob struct {
+		repo repository.MediaBlob
+	}
+
+	instrumentedConfirmation struct {
+		repo repository.Confirmation
+	}
+
+	instrumentedTwoFactor struct {
+		repo repository.TwoFactor
+	}
+)
+
+// Create DAO observing durations of every repository method of d
+func Instrument(d Dao) Dao {
+	return &instrumented{Dao: d}
+}
+
+// Start observing a repository method, returning the context for it
+// and a function to call with its error on return
+func observe(ctx context.Context, table string, method string) (context.Context, func(*error)) {
+	observeQuery := metrics.ObserveQuery(table, method)
+	ctx, span := tracing.StartQuery(ctx, table, method)
+	return ctx, func(err *error) {
+		observeQuery(err)
+		tracing.End(span, *err)
+	}
+}
+
+// Collectors of connection pool statistics of the databases used by d
+func Collectors(d Dao) []prometheus.Collector {
+	if i, ok := d.(*instrumented); ok {
+		d = i.Dao
+	}
+	impl, ok := d.(*dao)
+	if !ok {
+		return nil
+	}
+
+	// databases in a transaction have no pool of their own
+	var cs []prometheus.Collector
+	if db, ok := impl.db.(*sqlx.DB); ok {
+		cs = append(cs, collectors.NewDBStatsCollector(db.DB, "primary"))
+	}
+	if db, ok := impl.replica.(*sqlx.DB); ok && impl.replica != impl.db {
+		cs = append(cs, collectors.NewDBStatsCollector(db.DB, "replica"))
+	}
+	return cs
+}
+
+func (i *instrumented) Account() repository.Account {
+	return &instrumentedAccount{repo: i.Dao.Account()}
+}
+
+func (i *instrumented) Status() repository.Status {
+	return &instrumentedStatus{repo: i.Dao.Status()}
+}
+
+func (i *instrumented) Relation() repository.Relation {
+	return &instrumentedRelation{repo: i.Dao.Relation()}
+}
+
+func (i *instrumented) Attachment() repository.Attachment {
+	return &instrumentedAttachment{repo: i.Dao.Attachment()}
+}
+
+func (i *instrumented) MediaBlob() repository.MediaBlob {
+	return &instrumentedMediaBlob{repo: i.Dao.MediaBlob()}
+}
+
+func (i *instrumented) Confirmation() repository.Confirmation {
+	return &instrumentedConfirmation{repo: i.Dao.Confirmation()}
+}
+
+func (i *instrumented) TwoFactor() repository.TwoFactor {
+	return &instrumentedTwoFactor{repo: i.Dao.TwoFactor()}
+}
+
+func (i *instrumented) Primary() Dao {
+	return &instrumented{Dao: i.Dao.Primary()}
+}
+
+func (i *instrumented) WithTx(ctx context.Context, f func(Dao) error) error {
+	return i.Dao.WithTx(ctx, func(tx Dao) error {
+		return f(&instrumented{Dao: tx})
+	})
+}
+
+func (a *instrumentedAccount) FindByUsername(ctx context.Context, username string) (_ *object.Account, err error) {
+	ctx, done := observe(ctx, "account", "FindByUsername")
+	defer done(&err)
+	return a.repo.FindByUsername(ctx, username)
+}
+
+func (a *instrumentedAccount) FindByID(ctx context.Context, id object.AccountID) (_ *object.Account, err error) {
+	ctx, done := observe(ctx, "account", "FindByID")
+	defer done(&err)
+	return a.repo.FindByID(ctx, id)
+}
+
+func (a *instrumentedAccount) FindByEmail(ctx context.Context, email string) (_ *object.Account, err error) {
+	ctx, done := observe(ctx, "account", "FindByEmail")
+	defer done(&err)
+	return a.repo.FindByEmail(ctx, email)
+}
+
+func (a *instrumentedAccount) FindAccountsByIDs(ctx context.Context, ids []object.AccountID) (_ map[object.AccountID]*object.Account, err error) {
+	ctx, done := observe(ctx, "account", "FindAccountsByIDs")
+	defer done(&err)
+	return a.repo.FindAccountsByIDs(ctx, ids)
+}
+
+func (a *instrumentedAccount) Insert(ctx context.Context, account object.Account) (_ object.AccountID, err error) {
+	ctx, done := observe(ctx, "account", "Insert")
+	defer done(&err)
+	return a.repo.Insert(ctx, account)
+}
+
+func (a *instrumentedAccount) Update(ctx context.Context, account object.Account) (_ []string, err error) {
+	ctx, done := observe(ctx, "account", "Update")
+	defer done(&err)
+	return a.repo.Update(ctx, account)
+}
+
+func (a *instrumentedAccount) ConfirmEmail(ctx context.Context, id object.AccountID, approvalRequired bool) (err error) {
+	ctx, done := observe(ctx, "account", "ConfirmEmail")
+	defer done(&err)
+	return a.repo.ConfirmEmail(ctx, id, approvalRequired)
+}
+
+func (a *instrumentedAccount) Approve(ctx context.Context, id object.AccountID) (err error) {
+	ctx, done := observe(ctx, "account", "Approve")
+	defer done(&err)
+	return a.repo.Approve(ctx, id)
+}
+
+func (a *instrumentedAccount) UpdatePassword(ctx context.Context, id object.AccountID, hash object.PasswordHash) (err error) {
+	ctx, done := observe(ctx, "account", "UpdatePassword")
+	defer done(&err)
+	return a.repo.UpdatePassword(ctx, id, hash)
+}
+
+func (a *instrumentedAccount) MarkDeleted(ctx context.Context, id object.AccountID) (err error) {
+	ctx, done := observe(ctx, "account", "MarkDeleted")
+	defer done(&err)
+	return a.repo.MarkDeleted(ctx, id)
+}
+
+func (a *instrumentedAccount) UnsetImage(ctx context.Context, id object.AccountID, url string) (_ int, err error) {
+	ctx, done := observe(ctx, "account", "UnsetImage")
+	defer done(&err)
+	return a.repo.UnsetImage(ctx, id, url)
+}
+
+func (a *instrumentedAccount) FindDeleted(ctx context.Context, limit int) (_ []object.Account, err error) {
+	ctx, done := observe(ctx, "account", "FindDeleted")
+	defer done(&err)
+	return a.repo.FindDeleted(ctx, limit)
+}
+
+func (a *instrumentedAccount) Purge(ctx context.Context, id object.AccountID) (err error) {
+	ctx, done := observe(ctx, "account", "Purge")
+	defer done(&err)
+	return a.repo.Purge(ctx, id)
+}
+
+func (a *instrumentedAccount) RecountStats(ctx context.Context) (_ int64, err error) {
+	ctx, done := observe(ctx, "account", "RecountStats")
+	defer done(&err)
+	return a.repo.RecountStats(ctx)
+}
+
+func (s *instrumentedStatus) Insert(ctx context.Context, status object.Status, mediaIDs []object.AttachmentID) (_ object.StatusID, err error) {
+	ctx, done := observe(ctx, "status", "Insert")
+	defer done(&err)
+	return s.repo.Insert(ctx, status, mediaIDs)
+}
+
+func (s *instrumentedStatus) FindByID(ctx context.Context, id object.StatusID) (_ *object.Status, err error) {
+	ctx, done := observe(ctx, "status", "FindByID")
+	defer done(&err)
+	return s.repo.FindByID(ctx, id)
+}
+
+func (s *instrumentedStatus) FindByIDs(ctx context.Context, ids []object.StatusID) (_ object.Timelines, err error) {
+	ctx, done := observe(ctx, "status", "FindByIDs")
+	defer done(&err)
+	return s.repo.FindByIDs(ctx, ids)
+}
+
+func (s *instrumentedStatus) Delete(ctx context.Context, id object.StatusID) (err error) {
+	ctx, done := observe(ctx, "status", "Delete")
+	defer done(&err)
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *instrumentedStatus) PublicTimeline(ctx context.Context, p object.Parameters) (_ object.Timelines, err error) {
+	ctx, done := observe(ctx, "status", "PublicTimeline")
+	defer done(&err)
+	return s.repo.PublicTimeline(ctx, p)
+}
+
+func (s *instrumentedStatus) HomeTimeline(ctx context.Context, loginID object.AccountID, p object.Parameters) (_ object.Timelines, err error) {
+	ctx, done := observe(ctx, "status", "HomeTimeline")
+	defer done(&err)
+	return s.repo.HomeTimeline(ctx, loginID, p)
+}
+
+func (s *instrumentedStatus) HomeStatusIDs(ctx context.Context, loginID object.AccountID, limit int) (_ []object.StatusID, err error) {
+	ctx, done := observe(ctx, "status", "HomeStatusIDs")
+	defer done(&err)
+	return s.repo.HomeStatusIDs(ctx, loginID, limit)
+}
+
+func (r *instrumentedRelation) Follow(ctx context.Context, loginID object.AccountID, targetID object.AccountID) (err error) {
+	ctx, done := observe(ctx, "relation", "Follow")
+	defer done(&err)
+	return r.repo.Follow(ctx, loginID, targetID)
+}
+
+func (r *instrumentedRelation) IsFollowing(ctx context.Context, accountID object.AccountID, targetID object.AccountID) (_ bool, err error) {
+	ctx, done := observe(ctx, "relation", "IsFollowing")
+	defer done(&err)
+	return r.repo.IsFollowing(ctx, accountID, targetID)
+}
+
+func (r *instrumentedRelation) Following(ctx context.Context, id object.AccountID, p object.Parameters) (_ []object.Follow, err error) {
+	ctx, done := observe(ctx, "relation", "Following")
+	defer done(&err)
+	return r.repo.Following(ctx, id, p)
+}
+
+func (r *instrumentedRelation) Followers(ctx context.Context, id object.AccountID, p object.Parameters) (_ []object.Follow, err error) {
+	ctx, done := observe(ctx, "relation", "Followers")
+	defer done(&err)
+	return r.repo.Followers(ctx, id, p)
+}
+
+func (r *instrumentedRelation) FollowerIDs(ctx context.Context, id object.AccountID) (_ []object.AccountID, err error) {
+	ctx, done := observe(ctx, "relation", "FollowerIDs")
+	defer done(&err)
+	return r.repo.FollowerIDs(ctx, id)
+}
+
+func (r *instrumentedRelation) Unfollow(ctx context.Context, loginID object.AccountID, targetID object.AccountID) (err error) {
+	ctx, done := observe(ctx, "relation", "Unfollow")
+	defer done(&err)
+	return r.repo.Unfollow(ctx, loginID, targetID)
+}
+
+func (a *instrumentedAttachment) Insert(ctx context.Context, attachment object.Attachment) (_ object.AttachmentID, err error) {
+	ctx, done := observe(ctx, "attachment", "Insert")
+	defer done(&err)
+	return a.repo.Insert(ctx, attachment)
+}
+
+func (a *instrumentedAttachment) FindByStatusID(ctx context.Context, id object.StatusID) (_ []object.Attachment, err error) {
+	ctx, done := observe(ctx, "attachment", "FindByStatusID")
+	defer done(&err)
+	return a.repo.FindByStatusID(ctx, id)
+}
+
+func (a *instrumentedAttachment) FindByStatusIDs(ctx context.Context, ids []object.StatusID) (_ map[object.StatusID][]object.Attachment, err error) {
+	ctx, done := observe(ctx, "attachment", "FindByStatusIDs")
+	defer done(&err)
+	return a.repo.FindByStatusIDs(ctx, ids)
+}
+
+func (a *instrumentedAttachment) IsAttachable(ctx context.Context, accountID object.AccountID, ids []object.AttachmentID) (_ bool, err error) {
+	ctx, done := observe(ctx, "attachment", "IsAttachable")
+	defer done(&err)
+	return a.repo.IsAttachable(ctx, accountID, ids)
+}
+
+func (a *instrumentedAttachment) FindByAccountID(ctx context.Context, id object.AccountID) (_ []object.Attachment, err error) {
+	ctx, done := observe(ctx, "attachment", "FindByAccountID")
+	defer done(&err)
+	return a.repo.FindByAccountID(ctx, id)
+}
+
+func (a *instrumentedAttachment) FindOrphans(ctx context.Context, before time.Time, after object.AttachmentID, limit int) (_ []object.Attachment, err error) {
+	ctx, done := observe(ctx, "attachment", "FindOrphans")
+	defer done(&err)
+	return a.repo.FindOrphans(ctx, before, after, limit)
+}
+
+func (a *instrumentedAttachment) DeleteOrphan(ctx context.Context, id object.AttachmentID, before time.Time) (_ bool, err error) {
+	ctx, done := observe(ctx, "attachment", "DeleteOrphan")
+	defer done(&err)
+	return a.repo.DeleteOrphan(ctx, id, before)
+}
+
+func (a *instrumentedAttachment) Delete(ctx context.Context, id object.AttachmentID) (_ bool, err error) {
+	ctx, done := observe(ctx, "attachment", "Delete")
+	defer done(&err)
+	return a.repo.Delete(ctx, id)
+}
+
+func (m *instrumentedMediaBlob) Acquire(ctx context.Context, blob object.MediaBlob) (err error) {
+	ctx, done := observe(ctx, "media_blob", "Acquire")
+	defer done(&err)
+	return m.repo.Acquire(ctx, blob)
+}
+
+func (m *instrumentedMediaBlob) Release(ctx context.Context, hash string, remove func() error) (_ bool, err error) {
+	ctx, done := observe(ctx, "media_blob", "Release")
+	defer done(&err)
+	return m.repo.Release(ctx, hash, remove)
+}
+
+func (c *instrumentedConfirmation) Insert(ctx context.Context, token object.ConfirmationToken) (err error) {
+	ctx, done := observe(ctx, "confirmation_token", "Insert")
+	defer done(&err)
+	return c.repo.Insert(ctx, token)
+}
+
+func (c *instrumentedConfirmation) FindValid(ctx context.Context, purpose object.TokenPurpose, hash string, now time.Time) (_ *object.ConfirmationToken, err error) {
+	ctx, done := observe(ctx, "confirmation_token", "FindValid")
+	defer done(&err)
+	return c.repo.FindValid(ctx, purpose, hash, now)
+}
+
+func (c *instrumentedConfirmation) Delete(ctx context.Context, hash string) (err error) {
+	ctx, done := observe(ctx, "confirmation_token", "Delete")
+	defer done(&err)
+	return c.repo.Delete(ctx, hash)
+}
+
+func (c *instrumentedConfirmation) DeleteByAccountID(ctx context.Context, purpose object.TokenPurpose, id object.AccountID) (err error) {
+	ctx, done := observe(ctx, "confirmation_token", "DeleteByAccountID")
+	defer done(&err)
+	return c.repo.DeleteByAccountID(ctx, purpose, id)
+}
+
+func (t *instrumentedTwoFactor) Find(ctx context.Context, id object.AccountID) (_ *object.TwoFactor, err error) {
+	ctx, done := observe(ctx, "two_factor", "Find")
+	defer done(&err)
+	return t.repo.Find(ctx, id)
+}
+
+func (t *instrumentedTwoFactor) SavePending(ctx context.Context, tf object.TwoFactor) (err error) {
+	ctx, done := observe(ctx, "two_factor", "SavePending")
+	defer done(&err)
+	return t.repo.SavePending(ctx, tf)
+}
+
+func (t *instrumentedTwoFactor) Enable(ctx context.Context, id object.AccountID) (err error) {
+	ctx, done := observe(ctx, "two_factor", "Enable")
+	defer done(&err)
+	return t.repo.Enable(ctx, id)
+}
+
+func (t *instrumentedTwoFactor) UseStep(ctx context.Context, id object.AccountID, step int64) (_ bool, err error) {
+	ctx, done := observe(ctx, "two_factor", "UseStep")
+	defer done(&err)
+	return t.repo.UseStep(ctx, id, step)
+}
+
+func (t *instrumentedTwoFactor) ReplaceRecoveryCodes(ctx context.Context, id object.AccountID, hashes []string) (err error) {
+	ctx, done := observe(ctx, "recovery_code", "ReplaceRecoveryCodes")
+	defer done(&err)
+	return t.repo.ReplaceRecoveryCodes(ctx, id, hashes)
+}
+
+func (t *instrumentedTwoFactor) UseRecoveryCode(ctx context.Context, id object.AccountID, hash string) (_ bool, err error) {
+	ctx, done := observe(ctx, "recovery_code", "UseRecoveryCode")
+	defer done(&err)
+	return t.repo.UseRecoveryCode(ctx, id, hash)
+}
+
+func (t *instrumentedTwoFactor) Delete(ctx context.Context, id object.AccountID) (err error) {
+	ctx, done := observe(ctx, "two_factor", "Delete")
+	defer done(&err)
+	return t.repo.Delete(ctx, id)
+}
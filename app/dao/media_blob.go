@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// Implementation for repository.MediaBlob
+	mediaBlob struct {
+		db handle
+	}
+)
+
+// Create media blob repository
+func NewMediaBlob(db *sqlx.DB) repository.MediaBlob {
+	return &mediaBlob{db: db}
+}
+
+func (r *mediaBlob) Acquire(ctx context.Context, b object.MediaBlob) error {
+	query := `
+	INSERT INTO media_blob (hash, size, ref_count) VALUES(?, ?, 1)
+	ON DUPLICATE KEY UPDATE ref_count = ref_count + 1
+	`
+	if isPostgres(r.db) || isSQLite(r.db) {
+		query = `
+		INSERT INTO media_blob (hash, size, ref_count) VALUES(?, ?, 1)
+		ON CONFLICT (hash) DO UPDATE SET ref_count = media_blob.ref_count + 1
+		`
+	}
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), b.Hash, b.Size)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (r *mediaBlob) Release(ctx context.Context, hash string, remove func() error) (bool, error) {
+	var removed bool
+	err := transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		// UPDATEで行ロックを取り、コミットまで同じ内容のAcquireを待たせる
+		const decrement = "UPDATE media_blob SET ref_count = ref_count - 1 WHERE hash = ?"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(decrement), hash); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		// ロックを持ったまま数え直す
+		var count int
+		const find = "SELECT ref_count FROM media_blob WHERE hash = ?"
+		if err := tx.GetContext(ctx, &count, tx.Rebind(find), hash); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("%w", err)
+		}
+		if count > 0 {
+			return nil
+		}
+
+		const deleteBlob = "DELETE FROM media_blob WHERE hash = ?"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(deleteBlob), hash); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		// ファイルを消せなければ参照を戻して、次の回収でやり直す
+		if remove != nil {
+			if err := remove(); err != nil {
+				return err
+			}
+		}
+		removed = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return removed, nil
+}
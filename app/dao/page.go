@@ -0,0 +1,26 @@
+package dao
+
+import (
+	"reflect"
+	"yatter-backend-go/app/domain/object"
+)
+
+// SQL condition and order selecting the page of p by column, with args of the condition.
+// Rows read upward (p.Upward) come in ascending order and must be reversed by the caller.
+func page(column string, p object.Parameters) (cond string, order string, args []interface{}) {
+	cond = column + " < ? AND " + column + " > ?"
+	args = []interface{}{p.MaxID, p.After()}
+	order = column + " DESC"
+	if p.Upward() {
+		order = column
+	}
+	return cond, order, args
+}
+
+// Reverse the slice rows in place
+func reverse(rows interface{}) {
+	swap := reflect.Swapper(rows)
+	for i, j := 0, reflect.ValueOf(rows).Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
@@ -12,24 +12,27 @@ import (
 )
 
 type (
-	// Implementation for repository.Account
+	// Implementation for repository.Relation
 	relation struct {
-		db *sqlx.DB
+		db handle
+
+		// database for read-only queries, a replica or db itself
+		replica handle
 	}
 )
 
 func NewRelation(db *sqlx.DB) repository.Relation {
-	return &relation{db: db}
+	return &relation{db: db, replica: db}
 }
 
 func (r *relation) Follow(ctx context.Context, loginID object.AccountID, targetID object.AccountID) error {
-	const query = "INSERT INTO relation (following_id, follower_id) VALUES(?, ?)"
-
-	_, err := r.db.ExecContext(ctx, query, loginID, targetID)
-	if err != nil {
-		return fmt.Errorf("%w", err)
-	}
-	return nil
+	return transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		const query = "INSERT INTO relation (following_id, follower_id) VALUES(?, ?)"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), loginID, targetID); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		return updateFollowCounts(ctx, tx, loginID, targetID, 1)
+	})
 }
 
 func (r *relation) IsFollowing(ctx context.Context, accountID object.AccountID, targetID object.AccountID) (bool, error) {
@@ -38,188 +41,133 @@ func (r *relation) IsFollowing(ctx context.Context, accountID object.AccountID,
 	ex := struct {
 		Exist bool `db:"existing"`
 	}{}
-	err := r.db.QueryRowxContext(ctx, query, accountID, targetID).StructScan(&ex)
+	err := r.db.QueryRowxContext(ctx, r.db.Rebind(query), accountID, targetID).StructScan(&ex)
 	if err != nil {
 		return false, fmt.Errorf("%w", err)
 	}
 	return ex.Exist, nil
 }
 
-func (r *relation) Following(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Account, error) {
-	var entity []object.Account
-	const query = `
+func (r *relation) Following(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Follow, error) {
+	var entity []object.Follow
+	cond, order, args := page("relation.id", p)
+	query := fmt.Sprintf(`
 SELECT
+	relation.id AS "follow_id",
 	account.id,
 	account.username,
 	account.create_at,
-    CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.following_id = a.id
-			WHERE
-				a.id = account.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				following_id = (
-					SELECT
-						a.id
-					from
-						account a
-					WHERE
-						a.id = account.id
-				)
-			GROUP BY
-				following_id
-		)
-	END AS "followingcount",
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.follower_id = a.id
-			WHERE
-				account.id = a.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				follower_id = (
-					SELECT
-						a.id
-					FROM
-						account a
-					WHERE
-						account.id = a.id
-				)
-			GROUP BY
-				follower_id
-		)
-	END AS "followerscount"
+	COALESCE(st.following_count, 0) AS "followingcount",
+	COALESCE(st.followers_count, 0) AS "followerscount",
+	COALESCE(st.statuses_count, 0) AS "statusescount",
+	st.last_status_at AS "last_status_at"
 FROM
 	account
 	JOIN relation ON account.id = relation.follower_id
+	LEFT JOIN account_stats AS st ON st.account_id = account.id
 WHERE
 	relation.following_id = ?
+	AND %s
+	AND %s
 ORDER BY
-	account.id
+	%s
 LIMIT
 	?
-	`
+	`, notDeleted("account"), cond, order)
 
-	err := r.db.SelectContext(ctx, &entity, query, id, p.Limit)
+	args = append([]interface{}{id}, append(args, p.Limit)...)
+	err := r.replica.SelectContext(ctx, &entity, r.replica.Rebind(query), args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("%w", err)
 	}
+	if p.Upward() {
+		reverse(entity)
+	}
 	return entity, nil
 }
 
-func (r *relation) Followers(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Account, error) {
-	var entity []object.Account
-	const query = `
+func (r *relation) Followers(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Follow, error) {
+	var entity []object.Follow
+	cond, order, args := page("relation.id", p)
+	query := fmt.Sprintf(`
 SELECT
+	relation.id AS "follow_id",
 	account.id,
 	account.username,
 	account.create_at,
-    CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.following_id = a.id
-			WHERE
-				a.id = account.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				following_id = (
-					SELECT
-						a.id
-					from
-						account a
-					WHERE
-						a.id = account.id
-				)
-			GROUP BY
-				following_id
-		)
-	END AS "followingcount",
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.follower_id = a.id
-			WHERE
-				account.id = a.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				follower_id = (
-					SELECT
-						a.id
-					FROM
-						account a
-					WHERE
-						account.id = a.id
-				)
-			GROUP BY
-				follower_id
-		)
-	END AS "followerscount"
+	COALESCE(st.following_count, 0) AS "followingcount",
+	COALESCE(st.followers_count, 0) AS "followerscount",
+	COALESCE(st.statuses_count, 0) AS "statusescount",
+	st.last_status_at AS "last_status_at"
 FROM
 	account
 	JOIN relation ON account.id = relation.following_id
+	LEFT JOIN account_stats AS st ON st.account_id = account.id
 WHERE
 	relation.follower_id = ?
-	AND account.id < ?
-	AND account.id > ?
+	AND %s
+	AND %s
 ORDER BY
-	account.id
+	%s
 LIMIT
 	?
-`
+`, notDeleted("account"), cond, order)
 
-	err := r.db.SelectContext(ctx, &entity, query, id, p.MaxID, p.SinceID, p.Limit)
+	args = append([]interface{}{id}, append(args, p.Limit)...)
+	err := r.replica.SelectContext(ctx, &entity, r.replica.Rebind(query), args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("%w", err)
 	}
+	if p.Upward() {
+		reverse(entity)
+	}
 	return entity, nil
 }
 
-func (r *relation) Unfollow(ctx context.Context, loginID object.AccountID, targetID object.AccountID) error {
-	const query = "DELETE FROM relation WHERE following_id = ? AND follower_id = ?"
+func (r *relation) FollowerIDs(ctx context.Context, id object.AccountID) ([]object.AccountID, error) {
+	var ids []object.AccountID
+	const query = "SELECT following_id FROM relation WHERE follower_id = ?"
 
-	_, err := r.db.ExecContext(ctx, query, loginID, targetID)
+	err := r.db.SelectContext(ctx, &ids, r.db.Rebind(query), id)
 	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return ids, nil
+}
+
+func (r *relation) Unfollow(ctx context.Context, loginID object.AccountID, targetID object.AccountID) error {
+	return transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		const query = "DELETE FROM relation WHERE following_id = ? AND follower_id = ?"
+		result, err := tx.ExecContext(ctx, tx.Rebind(query), loginID, targetID)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		// フォローしていなかった場合は数を変えない
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		if n > 0 {
+			return updateFollowCounts(ctx, tx, loginID, targetID, -1)
+		}
+		return nil
+	})
+}
+
+// Add delta to following_count of loginID and followers_count of targetID
+func updateFollowCounts(ctx context.Context, tx *sqlx.Tx, loginID object.AccountID, targetID object.AccountID, delta int) error {
+	const following = "UPDATE account_stats SET following_count = following_count + ? WHERE account_id = ?"
+	if _, err := tx.ExecContext(ctx, tx.Rebind(following), delta, loginID); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	const followers = "UPDATE account_stats SET followers_count = followers_count + ? WHERE account_id = ?"
+	if _, err := tx.ExecContext(ctx, tx.Rebind(followers), delta, targetID); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 	return nil
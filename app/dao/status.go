@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/snowflake"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -14,49 +15,58 @@ import (
 type (
 	// Implementation for repository.Status
 	status struct {
-		db *sqlx.DB
+		db handle
+
+		// database for read-only queries, a replica or db itself
+		replica handle
+
+		// generator of status IDs
+		ids *snowflake.Generator
 	}
 )
 
 // Create status repository
-func NewStatus(db *sqlx.DB) repository.Status {
-	return &status{db: db}
+func NewStatus(db *sqlx.DB, ids *snowflake.Generator) repository.Status {
+	return &status{db: db, replica: db, ids: ids}
 }
 
 // statusを投稿
 func (r *status) Insert(ctx context.Context, status object.Status, mediaIDs []object.AttachmentID) (object.StatusID, error) {
-	tx, err := r.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return -1, fmt.Errorf("%w", err)
-	}
-
-	query := "INSERT INTO status (content, account_id) VALUES(?, ?)"
-	row, err := tx.ExecContext(ctx, query, status.Content, status.Account.ID)
-	if err != nil {
-		return -1, fmt.Errorf("%w", err)
-	}
+	statusID := object.StatusID(r.ids.Next())
+	err := transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		query := "INSERT INTO status (id, content, account_id) VALUES(?, ?, ?)"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), statusID, status.Content, status.Account.ID); err != nil {
+			return fmt.Errorf("%w", err)
+		}
 
-	statusID, err := row.LastInsertId()
-	if err != nil {
-		return -1, fmt.Errorf("%w", err)
-	}
+		for _, mediaID := range mediaIDs {
+			query = "INSERT INTO status_contain_attachment (status_id, attachment_id) VALUES(?, ?)"
+			if _, err := tx.ExecContext(ctx, tx.Rebind(query), statusID, mediaID); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
 
-	for _, mediaID := range mediaIDs {
-		query = "INSERT INTO status_contain_attachment (status_id, attachment_id) VALUES(?, ?)"
-		_, err := tx.ExecContext(ctx, query, statusID, mediaID)
-		if err != nil {
-			tx.Rollback()
-			return -1, err
+		query = `
+		UPDATE account_stats SET
+			statuses_count = statuses_count + 1,
+			last_status_at = (SELECT create_at FROM status WHERE id = ?)
+		WHERE account_id = ?
+		`
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), statusID, status.Account.ID); err != nil {
+			return fmt.Errorf("%w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
 	}
-	err = tx.Commit()
-	return statusID, err
+	return statusID, nil
 }
 
 // idからstatusを取得
 func (r *status) FindByID(ctx context.Context, id object.StatusID) (*object.Status, error) {
 	entity := new(object.Status)
-	const query = `
+	query := `
 SELECT
 	s.id,
 	s.content,
@@ -64,75 +74,25 @@ SELECT
 	a.id AS "account.id",
 	a.username AS "account.username",
 	a.password_hash AS "account.password_hash",
+	a.display_name AS "account.display_name",
+	a.avatar AS "account.avatar",
+	a.header AS "account.header",
+	a.note AS "account.note",
 	a.create_at AS "account.create_at",
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.following_id = a.id
-				INNER JOIN status AS s ON s.account_id = a.id
-			WHERE
-				s.id = ?
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				following_id = (
-					SELECT
-						a.id
-					from
-						account a
-						INNER JOIN status s ON s.account_id = a.id
-					WHERE
-						s.id = ?
-				)
-			GROUP BY
-				following_id
-		)
-	END AS "account.followingcount",
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.follower_id = a.id
-				INNER JOIN status AS s ON s.account_id = a.id
-			WHERE
-				s.id = ?
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				follower_id = (
-					SELECT
-						a.id
-					from
-						account a
-						INNER JOIN status s ON s.account_id = a.id
-					WHERE
-						s.id = ?
-				)
-			GROUP BY
-				following_id
-		)
-	END AS "account.followerscount"
+	COALESCE(st.following_count, 0) AS "account.followingcount",
+	COALESCE(st.followers_count, 0) AS "account.followerscount",
+	COALESCE(st.statuses_count, 0) AS "account.statusescount",
+	st.last_status_at AS "account.last_status_at"
 FROM
 	status AS s
 	JOIN account AS a ON s.account_id = a.id
+	LEFT JOIN account_stats AS st ON st.account_id = a.id
 WHERE
 	s.id = ?
+	AND ` + notDeleted("a") + `
 	`
 
-	err := r.db.QueryRowxContext(ctx, query, id, id, id, id, id).StructScan(entity)
+	err := r.replica.QueryRowxContext(ctx, r.replica.Rebind(query), id).StructScan(entity)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -142,18 +102,74 @@ WHERE
 	return entity, nil
 }
 
+// idの一覧からstatusをまとめて取得
+func (r *status) FindByIDs(ctx context.Context, ids []object.StatusID) (object.Timelines, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var statuses object.Timelines
+	query, args, err := sqlx.In(`
+	SELECT
+		s.id,
+		s.content,
+		s.create_at,
+		s.account_id AS "account.id"
+	FROM
+		status AS s
+		JOIN account AS a ON s.account_id = a.id
+	WHERE
+		s.id IN (?)
+		AND `+notDeleted("a")+`
+	ORDER BY
+		s.id DESC
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if err := r.replica.SelectContext(ctx, &statuses, r.replica.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return statuses, nil
+}
+
 // idで指定したstatusを削除
+// 添付されていたattachmentは削除済みとして印を付け、ファイルごと後で回収する
 func (r *status) Delete(ctx context.Context, id object.StatusID) error {
-	const query = "DELETE FROM status WHERE id = ?"
+	return transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		var accountID object.AccountID
+		err := tx.QueryRowxContext(ctx, tx.Rebind("SELECT account_id FROM status WHERE id = ?"), id).Scan(&accountID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("%w", err)
+		}
 
-	_, err := r.db.ExecContext(ctx, query, id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil
+		queries := []string{
+			`UPDATE attachment SET detached_at = CURRENT_TIMESTAMP
+			WHERE id IN (SELECT attachment_id FROM status_contain_attachment WHERE status_id = ?)`,
+			"DELETE FROM status_contain_attachment WHERE status_id = ?",
+			"DELETE FROM status WHERE id = ?",
 		}
-		return fmt.Errorf("%w", err)
-	}
-	return nil
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, tx.Rebind(query), id); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+
+		const stats = `
+		UPDATE account_stats SET
+			statuses_count = statuses_count - 1,
+			last_status_at = (SELECT MAX(create_at) FROM status WHERE account_id = ?)
+		WHERE account_id = ?
+		`
+		if _, err := tx.ExecContext(ctx, tx.Rebind(stats), accountID, accountID); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		return nil
+	})
 }
 
 // public timelineを取得
@@ -164,94 +180,48 @@ func (r *status) PublicTimeline(ctx context.Context, p object.Parameters) (objec
 		onlyMedia = "AND EXISTS(SELECT * FROM status_contain_attachment sca WHERE sca.status_id = s.id)"
 	}
 
+	cond, order, args := page("s.id", p)
 	query := fmt.Sprintf(`
 SELECT
-	s.id AS 'id',
-	s.account_id AS 'account.id',
-	s.create_at AS 'create_at',
-	s.content AS 'content',
-	a.username AS 'account.username',
-	a.create_at AS 'account.create_at',
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.following_id = a.id
-				INNER JOIN status ON status.account_id = a.id
-			WHERE
-				status.id = s.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				following_id = (
-					SELECT
-						a.id
-					from
-						account a
-						INNER JOIN status ON status.account_id = a.id
-					WHERE
-						status.id = s.id
-				)
-			GROUP BY
-				following_id
-		)
-	END AS "account.followingcount",
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.follower_id = a.id
-				INNER JOIN status ON status.account_id = a.id
-			WHERE
-				status.id = s.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				follower_id = (
-					SELECT
-						a.id
-					FROM
-						account a
-						INNER JOIN status ON status.account_id = a.id
-					WHERE
-						status.id = s.id
-				)
-			GROUP BY
-				follower_id
-		)
-	END AS "account.followerscount"
+	s.id AS "id",
+	s.account_id AS "account.id",
+	s.create_at AS "create_at",
+	s.content AS "content",
+	a.username AS "account.username",
+	a.display_name AS "account.display_name",
+	a.avatar AS "account.avatar",
+	a.header AS "account.header",
+	a.note AS "account.note",
+	a.create_at AS "account.create_at",
+	COALESCE(st.following_count, 0) AS "account.followingcount",
+	COALESCE(st.followers_count, 0) AS "account.followerscount",
+	COALESCE(st.statuses_count, 0) AS "account.statusescount",
+	st.last_status_at AS "account.last_status_at"
 FROM
 	status AS s
 	JOIN account AS a ON s.account_id = a.id
+	LEFT JOIN account_stats AS st ON st.account_id = a.id
 WHERE
-	s.id < ?
-	AND s.id > ?
+	%s
+	AND %s
 	%s
 ORDER BY
-	s.id
+	%s
 LIMIT
 	?
-	`, onlyMedia)
+	`, notDeleted("a"), cond, onlyMedia, order)
 
-	err := r.db.SelectContext(ctx, &public, query, p.MaxID, p.SinceID, p.Limit)
+	args = append(args, p.Limit)
+	err := r.replica.SelectContext(ctx, &public, r.replica.Rebind(query), args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("%w", err)
 	}
+	if p.Upward() {
+		reverse(public)
+	}
 
 	return public, nil
 }
@@ -264,6 +234,7 @@ func (r *status) HomeTimeline(ctx context.Context, loginID object.AccountID, p o
 		onlyMedia = "AND EXISTS(SELECT * FROM status_contain_attachment sca WHERE sca.status_id = s.id)"
 	}
 
+	cond, order, args := page("s.id", p)
 	query := fmt.Sprintf(`
 SELECT
 	s.id,
@@ -271,67 +242,15 @@ SELECT
 	s.create_at,
 	a.id AS "account.id",
 	a.username AS "account.username",
+	a.display_name AS "account.display_name",
+	a.avatar AS "account.avatar",
+	a.header AS "account.header",
+	a.note AS "account.note",
 	a.create_at AS "account.create_at",
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.following_id = a.id
-				INNER JOIN status ON status.account_id = a.id
-			WHERE
-				status.id = s.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				following_id = (
-					SELECT
-						a.id
-					from
-						account a
-						INNER JOIN status ON status.account_id = a.id
-					WHERE
-						status.id = s.id
-				)
-			GROUP BY
-				following_id
-		)
-	END AS "account.followingcount",
-	CASE
-		WHEN NOT EXISTS (
-			SELECT
-				*
-			FROM
-				relation AS r
-				INNER JOIN account AS a ON r.follower_id = a.id
-				INNER JOIN status ON status.account_id = a.id
-			WHERE
-				status.id = s.id
-		) THEN 0
-		ELSE (
-			SELECT
-				COUNT(*)
-			FROM
-				relation
-			WHERE
-				follower_id = (
-					SELECT
-						a.id
-					FROM
-						account a
-						INNER JOIN status ON status.account_id = a.id
-					WHERE
-						status.id = s.id
-				)
-			GROUP BY
-				follower_id
-		)
-	END AS "account.followerscount"
+	COALESCE(st.following_count, 0) AS "account.followingcount",
+	COALESCE(st.followers_count, 0) AS "account.followerscount",
+	COALESCE(st.statuses_count, 0) AS "account.statusescount",
+	st.last_status_at AS "account.last_status_at"
 FROM
 	status AS s
 	INNER JOIN (
@@ -339,6 +258,7 @@ FROM
 			account.id,
 			account.username,
 			account.display_name,
+			account.avatar,
 			account.header,
 			account.note,
 			account.create_at
@@ -346,28 +266,66 @@ FROM
 			account
 			LEFT OUTER JOIN relation ON account.id = relation.follower_id
 		WHERE
-			account.id = ?
-			OR relation.following_id = ?
+			(account.id = ? OR relation.following_id = ?)
+			AND %s
 		GROUP BY
 			account.id
 	) AS a ON a.id = s.account_id
+	LEFT JOIN account_stats AS st ON st.account_id = a.id
 WHERE
-	s.id > ?
-	AND s.id < ?
+	%s
 	%s
 ORDER BY
-	s.id
+	%s
 LIMIT
 	?
-	`, onlyMedia)
+	`, notDeleted("account"), cond, onlyMedia, order)
 
-	err := r.db.SelectContext(ctx, &home, query, loginID, loginID, p.SinceID, p.MaxID, p.Limit)
+	args = append([]interface{}{loginID, loginID}, append(args, p.Limit)...)
+	err := r.replica.SelectContext(ctx, &home, r.replica.Rebind(query), args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("%w", err)
 	}
+	if p.Upward() {
+		reverse(home)
+	}
 
 	return home, nil
 }
+
+func (r *status) HomeStatusIDs(ctx context.Context, loginID object.AccountID, limit int) ([]object.StatusID, error) {
+	var ids []object.StatusID
+	query := `
+SELECT
+	s.id
+FROM
+	status AS s
+	JOIN account AS a ON s.account_id = a.id
+WHERE
+	(
+		s.account_id = ?
+		OR s.account_id IN (
+			SELECT
+				follower_id
+			FROM
+				relation
+			WHERE
+				following_id = ?
+		)
+	)
+	AND ` + notDeleted("a") + `
+ORDER BY
+	s.id DESC
+LIMIT
+	?
+`
+
+	err := r.db.SelectContext(ctx, &ids, r.db.Rebind(query), loginID, loginID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return ids, nil
+}
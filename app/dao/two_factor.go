@@ -0,0 +1,135 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// Implementation for repository.TwoFactor
+	twoFactor struct {
+		db handle
+	}
+)
+
+// Create two-factor repository
+func NewTwoFactor(db *sqlx.DB) repository.TwoFactor {
+	return &twoFactor{db: db}
+}
+
+func (r *twoFactor) Find(ctx context.Context, id object.AccountID) (*object.TwoFactor, error) {
+	entity := new(object.TwoFactor)
+	const query = `
+	SELECT
+		account_id,
+		secret,
+		enabled_at,
+		last_used_step
+	FROM
+		two_factor
+	WHERE
+		account_id = ?
+	`
+
+	// 使ったコードの記録を確実に見るためプライマリから読む
+	err := r.db.QueryRowxContext(ctx, r.db.Rebind(query), id).StructScan(entity)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w", err)
+	}
+	return entity, nil
+}
+
+// 登録途中の秘密鍵を置き換える (有効なものは消さない)
+func (r *twoFactor) SavePending(ctx context.Context, t object.TwoFactor) error {
+	return transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		const del = "DELETE FROM two_factor WHERE account_id = ? AND enabled_at IS NULL"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(del), t.AccountID); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		const query = "INSERT INTO two_factor (account_id, secret) VALUES (?, ?)"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), t.AccountID, t.Secret); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		return nil
+	})
+}
+
+func (r *twoFactor) Enable(ctx context.Context, id object.AccountID) error {
+	const query = "UPDATE two_factor SET enabled_at = CURRENT_TIMESTAMP WHERE account_id = ?"
+
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(query), id)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// 同時に同じコードが使われても、一方だけが記録できる
+func (r *twoFactor) UseStep(ctx context.Context, id object.AccountID, step int64) (bool, error) {
+	const query = "UPDATE two_factor SET last_used_step = ? WHERE account_id = ? AND last_used_step < ?"
+
+	result, err := r.db.ExecContext(ctx, r.db.Rebind(query), step, id, step)
+	if err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *twoFactor) ReplaceRecoveryCodes(ctx context.Context, id object.AccountID, hashes []string) error {
+	return transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		const del = "DELETE FROM recovery_code WHERE account_id = ?"
+		if _, err := tx.ExecContext(ctx, tx.Rebind(del), id); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		const query = "INSERT INTO recovery_code (account_id, code_hash) VALUES (?, ?)"
+		for _, hash := range hashes {
+			if _, err := tx.ExecContext(ctx, tx.Rebind(query), id, hash); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *twoFactor) UseRecoveryCode(ctx context.Context, id object.AccountID, hash string) (bool, error) {
+	const query = "DELETE FROM recovery_code WHERE account_id = ? AND code_hash = ?"
+
+	result, err := r.db.ExecContext(ctx, r.db.Rebind(query), id, hash)
+	if err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *twoFactor) Delete(ctx context.Context, id object.AccountID) error {
+	return transact(ctx, r.db, func(tx *sqlx.Tx) error {
+		for _, query := range []string{
+			"DELETE FROM recovery_code WHERE account_id = ?",
+			"DELETE FROM two_factor WHERE account_id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, tx.Rebind(query), id); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+// Package errs defines errors of the domain, which handlers return
+// and package httperror maps to HTTP responses.
+// Messages of these errors are shown to clients, so they must not contain internal details.
+package errs
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Request which can't be understood, like malformed JSON or parameters
+	BadRequestError struct {
+		Message string
+	}
+
+	// Request without valid credentials
+	UnauthorizedError struct {
+		Message string
+	}
+
+	// Request which the account is not allowed to do
+	ForbiddenError struct {
+		Message string
+	}
+
+	// Resource which does not exist
+	NotFoundError struct {
+		// kind of the resource, like "account"
+		Resource string
+	}
+
+	// Request conflicting with the current state, like a taken username
+	ConflictError struct {
+		Message string
+	}
+
+	// Request with a body larger than accepted
+	PayloadTooLargeError struct {
+		Message string
+	}
+
+	// Request exceeding the rate limit of the client
+	TooManyRequestsError struct {
+		Message string
+	}
+
+	// Request with invalid values of fields
+	ValidationError struct {
+		Fields []FieldError
+	}
+
+	// Invalid value of a field
+	FieldError struct {
+		// name of the field in the request
+		Field string `json:"field"`
+
+		// machine-readable reason, like "too_long"
+		Code string `json:"code"`
+
+		// human-readable reason
+		Message string `json:"message"`
+	}
+)
+
+// Create BadRequestError with formatted message
+func BadRequest(format string, a ...interface{}) error {
+	return &BadRequestError{Message: fmt.Sprintf(format, a...)}
+}
+
+// Create UnauthorizedError with formatted message
+func Unauthorized(format string, a ...interface{}) error {
+	return &UnauthorizedError{Message: fmt.Sprintf(format, a...)}
+}
+
+// Create ForbiddenError with formatted message
+func Forbidden(format string, a ...interface{}) error {
+	return &ForbiddenError{Message: fmt.Sprintf(format, a...)}
+}
+
+// Create NotFoundError of resource
+func NotFound(resource string) error {
+	return &NotFoundError{Resource: resource}
+}
+
+// Create ConflictError with formatted message
+func Conflict(format string, a ...interface{}) error {
+	return &ConflictError{Message: fmt.Sprintf(format, a...)}
+}
+
+// Create PayloadTooLargeError with formatted message
+func PayloadTooLarge(format string, a ...interface{}) error {
+	return &PayloadTooLargeError{Message: fmt.Sprintf(format, a...)}
+}
+
+// Create TooManyRequestsError with formatted message
+func TooManyRequests(format string, a ...interface{}) error {
+	return &TooManyRequestsError{Message: fmt.Sprintf(format, a...)}
+}
+
+// Create ValidationError of a field
+func Invalid(field string, code string, message string) *ValidationError {
+	return new(ValidationError).Add(field, code, message)
+}
+
+func (e *BadRequestError) Error() string {
+	return e.Message
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.Message
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " not found"
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return e.Message
+}
+
+func (e *TooManyRequestsError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
+
+// Add an invalid field and return e
+func (e *ValidationError) Add(field string, code string, message string) *ValidationError {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+	return e
+}
+
+// e as an error, or nil if no field is invalid
+func (e *ValidationError) Err() error {
+	if e == nil || len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -7,10 +7,25 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// States of accounts
+const (
+	// Waiting for the email to be confirmed, or for approval if required
+	AccountPending AccountState = "pending"
+
+	// Able to use the service
+	AccountConfirmed AccountState = "confirmed"
+
+	// Deleted by the owner, waiting for its data to be purged
+	AccountDeleted AccountState = "deleted"
+)
+
 type (
 	AccountID    = int64
 	PasswordHash = string
 
+	// Whether an account can use the service
+	AccountState string
+
 	// Account account
 	Account struct {
 		// The internal ID of the account
@@ -22,6 +37,18 @@ type (
 		// The username of the account
 		PasswordHash string `json:"-" db:"password_hash"`
 
+		// Email address of the account, nil for accounts created before emails were required
+		Email *string `json:"-"`
+
+		// Whether the account can use the service
+		State AccountState `json:"-"`
+
+		// The time the email was confirmed
+		EmailConfirmedAt *DateTime `json:"-" db:"email_confirmed_at"`
+
+		// Whether logging in needs a TOTP code or a recovery code besides the password
+		TwoFactorEnabled bool `json:"-" db:"two_factor_enabled"`
+
 		// The account's display name
 		DisplayName *string `json:"display_name,omitempty" db:"display_name"`
 
@@ -42,9 +69,25 @@ type (
 
 		// The number of accounts the given account is following
 		FollowingCount int `json:"following_count"`
+
+		// The number of statuses posted by the account
+		StatusesCount int `json:"statuses_count"`
+
+		// The time the account posted the latest status
+		LastStatusAt *DateTime `json:"last_status_at" db:"last_status_at"`
 	}
 )
 
+// Whether the account has been deleted by the owner
+func (a *Account) IsDeleted() bool {
+	return a.State == AccountDeleted
+}
+
+// Whether the account can use the service
+func (a *Account) IsConfirmed() bool {
+	return a.State == AccountConfirmed
+}
+
 // Check if given password is match to account's password
 func (a *Account) CheckPassword(pass string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(pass)) == nil
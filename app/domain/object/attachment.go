@@ -7,13 +7,23 @@ type (
 		// ID of the attachment
 		ID AttachmentID `json:"id"`
 
+		// The internal ID of the account which uploaded the attachment,
+		// or 0 for orphans uploaded before owners were recorded
+		AccountID AccountID `json:"-" db:"account_id"`
+
 		// One of: "image", "video", "gifv", "unknown"
 		MediaType string `json:"type" db:"type"`
 
 		// URL of the image
 		URL string `json:"url"`
 
+		// Hash of the stored content, or null for media uploaded before deduplication
+		BlobHash *string `json:"-" db:"blob_hash"`
+
 		// A description of the image for the visually impaired (maximum 420 characters), or null if none provided
 		Description *string `json:"desctiption"`
+
+		// The time the attachment was uploaded
+		CreateAt DateTime `json:"-" db:"create_at"`
 	}
 )
@@ -0,0 +1,44 @@
+package object
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Purposes of confirmation tokens
+const (
+	// Confirming the email address of a new account
+	PurposeEmail TokenPurpose = "email"
+
+	// Resetting the forgotten password
+	PurposePasswordReset TokenPurpose = "password"
+
+	// Authenticating requests, issued by logging in
+	PurposeAccess TokenPurpose = "access"
+)
+
+type (
+	// What a confirmation token allows
+	TokenPurpose string
+
+	// Token given to the owner of an account, by email or by logging in
+	ConfirmationToken struct {
+		// SHA-256 of the token (hex encoded), as the token itself is a secret of the account
+		Hash string `db:"token_hash"`
+
+		Purpose TokenPurpose
+
+		// The account the token belongs to
+		AccountID AccountID `db:"account_id"`
+
+		// The time the token gets invalid
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+)
+
+// Hash of a token stored in the database, so that leaked rows cannot be used
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,15 @@
+package object
+
+type (
+	// Content of uploaded media, shared by every upload of the same bytes
+	MediaBlob struct {
+		// SHA-256 of the content (hex encoded)
+		Hash string `db:"hash"`
+
+		// Size of the content in bytes
+		Size int64 `db:"size"`
+
+		// The number of attachments and accounts referring to the content
+		RefCount int `db:"ref_count"`
+	}
+)
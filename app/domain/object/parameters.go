@@ -10,6 +10,23 @@ type Parameters struct {
 	// Get a list of followings with ID greater than this value
 	SinceID int64
 
+	// Get a list of followings with ID greater than this value, immediately after it
+	MinID int64
+
 	// Maximum number of followings to get (Default 40, Max 80)
 	Limit int
 }
+
+// Exclusive lower bound of IDs given by SinceID and MinID
+func (p Parameters) After() int64 {
+	if p.MinID > p.SinceID {
+		return p.MinID
+	}
+	return p.SinceID
+}
+
+// Whether the page is the items immediately after MinID, rather than the items immediately before MaxID.
+// Either way, items are returned in descending order of ID.
+func (p Parameters) Upward() bool {
+	return p.MinID > 0
+}
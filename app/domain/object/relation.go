@@ -3,6 +3,14 @@ package object
 type (
 	FollowID = int64
 
+	// Account in a list of follows, with the ID of the follow for paging by follow time
+	Follow struct {
+		// ID of the follow, not in JSON as clients page by the Link header
+		ID FollowID `json:"-" db:"follow_id"`
+
+		Account
+	}
+
 	// relationship with the target
 	RelationShip struct {
 		// Target account id
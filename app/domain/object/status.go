@@ -1,7 +1,15 @@
 package object
 
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
 type (
-	StatusID = int64
+	// ID of status, generated by package snowflake.
+	// It is serialized as a string in JSON, as it may exceed the safe integer range of JavaScript.
+	StatusID int64
 
 	Status struct {
 		// ID of the status
@@ -20,3 +28,18 @@ type (
 		MediaAttachments []Attachment `json:"media_attachments"`
 	}
 )
+
+// encoding/json/Marshaler
+func (id StatusID) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatInt(int64(id), 10) + `"`), nil
+}
+
+// encoding/json/Unmarshaler, accepting both a string and a number
+func (id *StatusID) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseInt(string(bytes.Trim(b, `"`)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid status id %s: %w", b, err)
+	}
+	*id = StatusID(n)
+	return nil
+}
@@ -0,0 +1,22 @@
+package object
+
+type (
+	// TOTP secret of an account, the second factor of logging in
+	TwoFactor struct {
+		AccountID AccountID `db:"account_id"`
+
+		// Secret in base32 encrypted by the key in settings, as it generates codes of the account
+		Secret string `db:"secret"`
+
+		// The time the account confirmed a code generated by the secret, nil while enrolling
+		EnabledAt *DateTime `db:"enabled_at"`
+
+		// The latest time step of TOTP codes used, so that a code cannot be used twice
+		LastUsedStep int64 `db:"last_used_step"`
+	}
+)
+
+// Whether the secret has been confirmed and is required to log in
+func (t *TwoFactor) IsEnabled() bool {
+	return t.EnabledAt != nil
+}
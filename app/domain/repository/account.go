@@ -7,12 +7,53 @@ import (
 )
 
 type Account interface {
-	// Fetch account which has specified username
+	// Fetch account which has specified username.
+	// Finders skip accounts marked as deleted, which stay until purged.
 	FindByUsername(ctx context.Context, username string) (*object.Account, error)
 
+	// Fetch account which has specified id
+	FindByID(ctx context.Context, id object.AccountID) (*object.Account, error)
+
+	// Fetch account which has specified email
+	FindByEmail(ctx context.Context, email string) (*object.Account, error)
+
+	// Fetch accounts which have specified ids at once, keyed by account ID
+	FindAccountsByIDs(ctx context.Context, ids []object.AccountID) (map[object.AccountID]*object.Account, error)
+
 	// Create account
 	Insert(ctx context.Context, account object.Account) (object.AccountID, error)
 
-	// Update account
-	Update(ctx context.Context, account object.Account) error
+	// Update account, returning URLs of the avatar and the header it had before.
+	// The row is locked while updated, so that each replaced image is returned to only one caller.
+	Update(ctx context.Context, account object.Account) ([]string, error)
+
+	// Mark the email of the account as confirmed.
+	// The account gets confirmed unless approvalRequired and it has not been approved.
+	ConfirmEmail(ctx context.Context, id object.AccountID, approvalRequired bool) error
+
+	// Mark the account as approved.
+	// The account gets confirmed if its email has been confirmed or it has no email.
+	Approve(ctx context.Context, id object.AccountID) error
+
+	// Replace the password hash of the account
+	UpdatePassword(ctx context.Context, id object.AccountID, hash object.PasswordHash) error
+
+	// Mark the account as deleted, to be purged later
+	MarkDeleted(ctx context.Context, id object.AccountID) error
+
+	// Unset the avatar and the header of the account which are url, returning how many were unset.
+	// Nothing is unset once they have been, so the caller releases the media blob of each only once.
+	UnsetImage(ctx context.Context, id object.AccountID, url string) (int, error)
+
+	// Fetch accounts marked as deleted, up to limit
+	FindDeleted(ctx context.Context, limit int) ([]object.Account, error)
+
+	// Delete the account with its statuses, relations, attachments, tokens and second factor.
+	// Counters of accounts related to it are updated, but media blobs and files are left to the caller,
+	// which releases them first by Attachment.Delete and UnsetImage.
+	Purge(ctx context.Context, id object.AccountID) error
+
+	// Recompute counters of every account from statuses and relations,
+	// and return the number of accounts recomputed
+	RecountStats(ctx context.Context) (int64, error)
 }
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 	"yatter-backend-go/app/domain/object"
 )
 
@@ -12,6 +13,24 @@ type Attachment interface {
 	// Fetch attachment which has specified statusID
 	FindByStatusID(ctx context.Context, id object.StatusID) ([]object.Attachment, error)
 
-	// Check if the attachment IDs exist
-	HasAttachmentIDs(ctx context.Context, id []object.AttachmentID) (bool, error)
+	// Fetch attachments of the statuses at once, keyed by status ID
+	FindByStatusIDs(ctx context.Context, ids []object.StatusID) (map[object.StatusID][]object.Attachment, error)
+
+	// Check if the attachments exist, belong to the account and are not used by any status
+	IsAttachable(ctx context.Context, accountID object.AccountID, ids []object.AttachmentID) (bool, error)
+
+	// Fetch up to limit attachments with IDs greater than after, in ID order,
+	// which are never used and uploaded before the given time, or attachments of deleted statuses
+	FindOrphans(ctx context.Context, before time.Time, after object.AttachmentID, limit int) ([]object.Attachment, error)
+
+	// Delete attachment only if it is still an orphan as FindOrphans finds, returning whether it was deleted.
+	// Links to statuses are never deleted, so that an attachment posted after it was found is kept.
+	DeleteOrphan(ctx context.Context, id object.AttachmentID, before time.Time) (bool, error)
+
+	// Fetch all attachments uploaded by the account
+	FindByAccountID(ctx context.Context, id object.AccountID) ([]object.Attachment, error)
+
+	// Delete attachment with its links to statuses, returning whether it existed.
+	// The caller releases its media blob only if it did, as the attachment may be deleted twice.
+	Delete(ctx context.Context, id object.AttachmentID) (bool, error)
 }
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"yatter-backend-go/app/domain/object"
+)
+
+type Confirmation interface {
+	// Save a token
+	Insert(ctx context.Context, token object.ConfirmationToken) error
+
+	// Fetch the token which has specified purpose and hash, and is valid at now
+	FindValid(ctx context.Context, purpose object.TokenPurpose, hash string, now time.Time) (*object.ConfirmationToken, error)
+
+	// Delete the token which has specified hash
+	Delete(ctx context.Context, hash string) error
+
+	// Delete all tokens of the account for the purpose
+	DeleteByAccountID(ctx context.Context, purpose object.TokenPurpose, id object.AccountID) error
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"yatter-backend-go/app/domain/object"
+)
+
+// Cache of status IDs on the home timeline of each account
+type HomeFeed interface {
+	// Add the status to the feeds of the accounts, skipping feeds which are not cached
+	Push(ctx context.Context, id object.StatusID, accountIDs []object.AccountID) error
+
+	// Fetch status IDs of the feed in the page of p in descending order.
+	// cached is false if the feed is not cached,
+	// and ok is false if it is not cached or p reaches statuses trimmed from the feed
+	Range(ctx context.Context, accountID object.AccountID, p object.Parameters) (ids []object.StatusID, cached bool, ok bool, err error)
+
+	// Start rebuilding the feed of the account before reading its statuses from the database.
+	// Statuses pushed from now on are kept for the following Store,
+	// so that those posted while the database is read are not lost
+	Prepare(ctx context.Context, accountID object.AccountID) error
+
+	// Replace the feed of the account with ids and the statuses pushed since Prepare.
+	// If no Prepare is pending, as another rebuild has stored first, ids are added to the feed.
+	// complete tells whether ids are all statuses on the home timeline
+	Store(ctx context.Context, accountID object.AccountID, ids []object.StatusID, complete bool) error
+
+	// Check the connection to the store of feeds
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"yatter-backend-go/app/domain/object"
+)
+
+type MediaBlob interface {
+	// Add a reference to the blob, creating it if it does not exist
+	Acquire(ctx context.Context, blob object.MediaBlob) error
+
+	// Remove a reference to the blob, and delete it when no one refers to it.
+	// remove, if not nil, is called to delete the file while the row is still locked in the same transaction,
+	// so a concurrent Acquire of the same content waits for it. If remove fails, the reference is kept.
+	// Returns true if the blob has been deleted
+	Release(ctx context.Context, hash string, remove func() error) (bool, error)
+}
@@ -12,11 +12,14 @@ type Relation interface {
 	// check if folloingID follows followeID
 	IsFollowing(ctx context.Context, accountID object.AccountID, targetID object.AccountID) (bool, error)
 
-	// Fetch accounts which the account of id follows
-	Following(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Account, error)
+	// Fetch accounts which the account of id follows, the newest follow first, paged by follow ID
+	Following(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Follow, error)
 
-	// Fetch accounts which follow the account of id
-	Followers(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Account, error)
+	// Fetch accounts which follow the account of id, the newest follow first, paged by follow ID
+	Followers(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Follow, error)
+
+	// Fetch IDs of all accounts which follow the account of id
+	FollowerIDs(ctx context.Context, id object.AccountID) ([]object.AccountID, error)
 
 	// unfollow the account of followerID
 	Unfollow(ctx context.Context, loginID object.AccountID, targetID object.AccountID) error
@@ -12,12 +12,19 @@ type Status interface {
 	// Fetch status which has specified id
 	FindByID(ctx context.Context, id object.StatusID) (*object.Status, error)
 
+	// Fetch statuses which have specified ids in descending order of ID.
+	// Account of each status only has its ID
+	FindByIDs(ctx context.Context, ids []object.StatusID) (object.Timelines, error)
+
 	// Delete status
 	Delete(ctx context.Context, id object.StatusID) error
 
-	// Fetch Public Timelines
+	// Fetch Public Timelines, newest first
 	PublicTimeline(ctx context.Context, p object.Parameters) (object.Timelines, error)
 
-	// Fetch Home Timelines
+	// Fetch Home Timelines, newest first
 	HomeTimeline(ctx context.Context, loginID object.AccountID, p object.Parameters) (object.Timelines, error)
+
+	// Fetch IDs of the latest statuses on the home timeline in descending order
+	HomeStatusIDs(ctx context.Context, loginID object.AccountID, limit int) ([]object.StatusID, error)
 }
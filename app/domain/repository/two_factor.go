@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"yatter-backend-go/app/domain/object"
+)
+
+type TwoFactor interface {
+	// Fetch the TOTP secret of the account, nil if it has none
+	Find(ctx context.Context, id object.AccountID) (*object.TwoFactor, error)
+
+	// Save a secret being enrolled, replacing one not enabled yet
+	SavePending(ctx context.Context, t object.TwoFactor) error
+
+	// Enable the secret of the account
+	Enable(ctx context.Context, id object.AccountID) error
+
+	// Record step as used if it is after the last used step, returning whether it was recorded
+	UseStep(ctx context.Context, id object.AccountID, step int64) (bool, error)
+
+	// Replace the recovery codes of the account with ones of the hashes
+	ReplaceRecoveryCodes(ctx context.Context, id object.AccountID, hashes []string) error
+
+	// Delete the recovery code of the hash, returning whether the account had it
+	UseRecoveryCode(ctx context.Context, id object.AccountID, hash string) (bool, error)
+
+	// Delete the secret and the recovery codes of the account
+	Delete(ctx context.Context, id object.AccountID) error
+}
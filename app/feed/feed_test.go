@@ -0,0 +1,305 @@
+package feed_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/feed"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const size = 3
+
+type (
+	mockdao struct {
+		dao.Dao
+		status *mockstatus
+	}
+
+	// ホームタイムラインが1から10のstatusからなるデータベース
+	mockstatus struct {
+		repository.Status
+		rebuilds int
+		reads    int
+	}
+)
+
+func (m *mockdao) Status() repository.Status {
+	return m.status
+}
+
+func (m *mockstatus) HomeStatusIDs(ctx context.Context, loginID object.AccountID, limit int) ([]object.StatusID, error) {
+	m.rebuilds++
+	var ids []object.StatusID
+	for id := object.StatusID(10); id > 0 && len(ids) < limit; id-- {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *mockstatus) FindByIDs(ctx context.Context, ids []object.StatusID) (object.Timelines, error) {
+	var statuses object.Timelines
+	for _, id := range ids {
+		statuses = append(statuses, object.Status{ID: id})
+	}
+	return statuses, nil
+}
+
+func (m *mockstatus) HomeTimeline(ctx context.Context, loginID object.AccountID, p object.Parameters) (object.Timelines, error) {
+	m.reads++
+	return nil, nil
+}
+
+func params(sinceID, maxID object.StatusID) object.Parameters {
+	return object.Parameters{SinceID: int64(sinceID), MaxID: int64(maxID), Limit: 40}
+}
+
+// 同じテストをメモリとRedisの実装で実行する
+func implementations(t *testing.T) map[string]repository.HomeFeed {
+	s := miniredis.RunT(t)
+	return map[string]repository.HomeFeed{
+		"Memory": feed.NewMemory(size),
+		"Redis":  feed.NewRedis(feed.NewRedisPool("redis://"+s.Addr()), size),
+	}
+}
+
+func TestHomeFeed(t *testing.T) {
+	ctx := context.Background()
+	all := params(0, math.MaxInt64)
+
+	for name, f := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			// キャッシュされていないフィードには追加しない
+			if err := f.Push(ctx, 1, []object.AccountID{1}); err != nil {
+				t.Fatal(err)
+			}
+			_, cached, ok, err := f.Range(ctx, 1, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.False(t, cached, "not cached")
+			assert.False(t, ok, "not cached")
+
+			// 空のフィードもキャッシュされる
+			if err := f.Store(ctx, 1, nil, true); err != nil {
+				t.Fatal(err)
+			}
+			ids, _, ok, err := f.Range(ctx, 1, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok, "empty feed")
+			assert.Empty(t, ids)
+
+			for _, id := range []object.StatusID{2, 3, 4} {
+				if err := f.Push(ctx, id, []object.AccountID{1, 2}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ids, _, ok, err = f.Range(ctx, 1, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{4, 3, 2}, ids)
+
+			// 新しい順に数える
+			ids, _, ok, err = f.Range(ctx, 1, object.Parameters{SinceID: 2, MaxID: math.MaxInt64, Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{4}, ids)
+
+			// min_idの直後から数えて、新しい順に返す
+			ids, _, ok, err = f.Range(ctx, 1, object.Parameters{MinID: 2, MaxID: math.MaxInt64, Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{3}, ids)
+
+			// sizeを超えたら古いものから捨て、捨てた範囲は答えない
+			if err := f.Push(ctx, 5, []object.AccountID{1}); err != nil {
+				t.Fatal(err)
+			}
+			_, cached, ok, err = f.Range(ctx, 1, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, cached, "trimmed")
+			assert.False(t, ok, "trimmed")
+			ids, _, ok, err = f.Range(ctx, 1, params(3, math.MaxInt64))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{5, 4}, ids)
+
+			// 捨てた範囲に届かないページは答える
+			ids, _, ok, err = f.Range(ctx, 1, object.Parameters{MaxID: math.MaxInt64, Limit: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{5, 4}, ids)
+			_, _, ok, err = f.Range(ctx, 1, object.Parameters{MinID: 1, MaxID: math.MaxInt64, Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.False(t, ok, "min_id in trimmed range")
+
+			// Storeで置き換える
+			if err := f.Prepare(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Store(ctx, 1, []object.StatusID{9, 7, 8}, false); err != nil {
+				t.Fatal(err)
+			}
+			ids, _, ok, err = f.Range(ctx, 1, params(7, math.MaxInt64))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{9, 8}, ids)
+			_, _, ok, err = f.Range(ctx, 1, params(6, math.MaxInt64))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.False(t, ok, "incomplete")
+		})
+	}
+}
+
+// 再構築中に追加されたstatusは、データベースから読んだ一覧と合わせて残る
+func TestHomeFeedRebuild(t *testing.T) {
+	ctx := context.Background()
+	all := params(0, math.MaxInt64)
+
+	for name, f := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := f.Store(ctx, 1, []object.StatusID{1, 2}, true); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.Prepare(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			// 再構築中もこれまでのフィードを読める
+			ids, _, ok, err := f.Range(ctx, 1, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{2, 1}, ids)
+
+			if err := f.Push(ctx, 4, []object.AccountID{1}); err != nil {
+				t.Fatal(err)
+			}
+			// フォローを外して2が消えた一覧
+			if err := f.Store(ctx, 1, []object.StatusID{1}, true); err != nil {
+				t.Fatal(err)
+			}
+			ids, _, ok, err = f.Range(ctx, 1, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{4, 1}, ids)
+
+			// 他の再構築が先に済んでいたら足すだけ
+			if err := f.Store(ctx, 1, []object.StatusID{3}, true); err != nil {
+				t.Fatal(err)
+			}
+			ids, _, ok, err = f.Range(ctx, 1, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{4, 3, 1}, ids)
+
+			// 再構築中に捨てるほど追加されたら、完全ではなくなる
+			if err := f.Prepare(ctx, 2); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []object.StatusID{5, 6, 7, 8} {
+				if err := f.Push(ctx, id, []object.AccountID{2}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Store(ctx, 2, nil, true); err != nil {
+				t.Fatal(err)
+			}
+			_, cached, ok, err := f.Range(ctx, 2, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, cached)
+			assert.False(t, ok, "trimmed while rebuilding")
+		})
+	}
+}
+
+// 64ビットのIDを丸めずに区別できる
+func TestHomeFeedLargeIDs(t *testing.T) {
+	ctx := context.Background()
+	base := object.StatusID(1) << 60
+	stored := []object.StatusID{base, base + 1, base + 2}
+
+	for name, f := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := f.Store(ctx, 1, stored, true); err != nil {
+				t.Fatal(err)
+			}
+			ids, _, ok, err := f.Range(ctx, 1, params(base, base+2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{base + 1}, ids)
+
+			ids, _, ok, err = f.Range(ctx, 1, object.Parameters{MinID: int64(base), MaxID: math.MaxInt64, Limit: 40})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, []object.StatusID{base + 2, base + 1}, ids)
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	for name, f := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, f.Ping(context.Background()))
+		})
+	}
+}
+
+// フィードが無いときだけ再構築し、捨てた範囲のページはデータベースから読む
+func TestHomeTimeline(t *testing.T) {
+	ctx := context.Background()
+	status := &mockstatus{}
+	home := feed.NewHome(&mockdao{status: status}, feed.NewMemory(size), size)
+
+	timeline, err := home.Timeline(ctx, 1, object.Parameters{MaxID: math.MaxInt64, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, timeline, 2)
+	assert.Equal(t, object.StatusID(10), timeline[0].ID)
+	assert.Equal(t, 1, status.rebuilds)
+
+	for i := 0; i < 2; i++ {
+		if _, err := home.Timeline(ctx, 1, object.Parameters{MaxID: 3, Limit: 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 1, status.rebuilds)
+	assert.Equal(t, 2, status.reads)
+}
@@ -0,0 +1,79 @@
+package feed
+
+import (
+	"context"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/logger"
+)
+
+// Home timelines written to the feed of each follower on post (fan-out on write).
+// The database stays the source of truth: feeds are rebuilt from it when missing,
+// and it is read directly whenever the feed can't answer or fails.
+type Home struct {
+	dao   dao.Dao
+	cache repository.HomeFeed
+	size  int
+}
+
+// Create home timelines cached in cache, holding up to size statuses per account
+func NewHome(d dao.Dao, cache repository.HomeFeed, size int) *Home {
+	return &Home{dao: d, cache: cache, size: size}
+}
+
+// Fetch home timeline of the account
+func (h *Home) Timeline(ctx context.Context, loginID object.AccountID, p object.Parameters) (object.Timelines, error) {
+	if !p.OnlyMedia {
+		// 再構築はフィードが無いときだけで、捨てた範囲のページはデータベースから読む
+		ids, cached, ok, err := h.cache.Range(ctx, loginID, p)
+		if err == nil && !cached {
+			if err = h.Rebuild(ctx, loginID); err == nil {
+				ids, _, ok, err = h.cache.Range(ctx, loginID, p)
+			}
+		}
+		if err != nil {
+			logger.FromContext(ctx).Warn("home feed falls back to database", "error", err)
+		} else if ok {
+			return h.load(ctx, ids)
+		}
+	}
+	return h.dao.Status().HomeTimeline(ctx, loginID, p)
+}
+
+// Add the status to the feeds of its author and followers
+func (h *Home) Fanout(ctx context.Context, status *object.Status) error {
+	followers, err := h.dao.Relation().FollowerIDs(ctx, status.Account.ID)
+	if err != nil {
+		return err
+	}
+	return h.cache.Push(ctx, status.ID, append(followers, status.Account.ID))
+}
+
+// Replace the feed of the account with the latest statuses in the database.
+// Statuses fanned out while it runs are kept.
+func (h *Home) Rebuild(ctx context.Context, accountID object.AccountID) error {
+	if err := h.cache.Prepare(ctx, accountID); err != nil {
+		return err
+	}
+	ids, err := h.dao.Status().HomeStatusIDs(ctx, accountID, h.size+1)
+	if err != nil {
+		return err
+	}
+	complete := len(ids) <= h.size
+	if !complete {
+		ids = ids[:h.size]
+	}
+	return h.cache.Store(ctx, accountID, ids, complete)
+}
+
+// Check the connection to the cache of feeds.
+// Timelines are read from the database while it fails.
+func (h *Home) Ping(ctx context.Context) error {
+	return h.cache.Ping(ctx)
+}
+
+// Read statuses of ids at once. Statuses deleted after pushed are missing
+func (h *Home) load(ctx context.Context, ids []object.StatusID) (object.Timelines, error) {
+	return h.dao.Status().FindByIDs(ctx, ids)
+}
@@ -0,0 +1,143 @@
+package feed
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+)
+
+type (
+	// Implementation of repository.HomeFeed in memory of the process
+	memory struct {
+		size int
+
+		mu    sync.Mutex
+		feeds map[object.AccountID]*memoryFeed
+
+		// statuses pushed to feeds being rebuilt, merged by Store
+		building map[object.AccountID]*memoryFeed
+	}
+
+	memoryFeed struct {
+		// status IDs in ascending order
+		ids []object.StatusID
+
+		// whether ids have not been trimmed
+		complete bool
+	}
+)
+
+// Create home feed kept in memory, holding up to size statuses per account
+func NewMemory(size int) repository.HomeFeed {
+	return &memory{
+		size:     size,
+		feeds:    make(map[object.AccountID]*memoryFeed),
+		building: make(map[object.AccountID]*memoryFeed),
+	}
+}
+
+func (m *memory) Push(ctx context.Context, id object.StatusID, accountIDs []object.AccountID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, accountID := range accountIDs {
+		if f, ok := m.feeds[accountID]; ok {
+			m.insert(f, id)
+		}
+		if f, ok := m.building[accountID]; ok {
+			m.insert(f, id)
+		}
+	}
+	return nil
+}
+
+func (m *memory) Range(ctx context.Context, accountID object.AccountID, p object.Parameters) ([]object.StatusID, bool, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.feeds[accountID]
+	if !ok {
+		return nil, false, false, nil
+	}
+	after, before := object.StatusID(p.After()), object.StatusID(p.MaxID)
+	var ids []object.StatusID
+	if p.Upward() {
+		for i := 0; i < len(f.ids) && len(ids) < p.Limit; i++ {
+			if id := f.ids[i]; id > after && id < before {
+				ids = append(ids, id)
+			}
+		}
+		reverseIDs(ids)
+	} else {
+		for i := len(f.ids) - 1; i >= 0 && len(ids) < p.Limit; i-- {
+			if id := f.ids[i]; id > after && id < before {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	oldest := object.StatusID(math.MaxInt64)
+	if len(f.ids) > 0 {
+		oldest = f.ids[0]
+	}
+	if !covers(f.complete, oldest, p, len(ids)) {
+		return nil, true, false, nil
+	}
+	return ids, true, true, nil
+}
+
+func (m *memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Prepare(ctx context.Context, accountID object.AccountID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.building[accountID]; !ok {
+		m.building[accountID] = &memoryFeed{complete: true}
+	}
+	return nil
+}
+
+func (m *memory) Store(ctx context.Context, accountID object.AccountID, ids []object.StatusID, complete bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 他の再構築が先に済ませていたら、そのフィードに足す
+	f, ok := m.building[accountID]
+	if ok {
+		delete(m.building, accountID)
+	} else if f, ok = m.feeds[accountID]; !ok {
+		f = &memoryFeed{complete: true}
+	}
+	for _, id := range ids {
+		m.insert(f, id)
+	}
+	f.complete = f.complete && complete
+	m.feeds[accountID] = f
+	return nil
+}
+
+// Add id to the feed keeping the order
+func (m *memory) insert(f *memoryFeed, id object.StatusID) {
+	i := sort.Search(len(f.ids), func(i int) bool { return f.ids[i] >= id })
+	if i < len(f.ids) && f.ids[i] == id {
+		return
+	}
+	f.ids = append(f.ids, 0)
+	copy(f.ids[i+1:], f.ids[i:])
+	f.ids[i] = id
+	m.trim(f)
+}
+
+// Drop the oldest statuses exceeding the size
+func (m *memory) trim(f *memoryFeed) {
+	if n := len(f.ids) - m.size; n > 0 {
+		f.ids = append([]object.StatusID(nil), f.ids[n:]...)
+		f.complete = false
+	}
+}
@@ -0,0 +1,23 @@
+package feed
+
+import "yatter-backend-go/app/domain/object"
+
+// Whether n IDs in the page of p read from a feed, whose oldest status is oldest,
+// are the same as the page read from the database
+func covers(complete bool, oldest object.StatusID, p object.Parameters, n int) bool {
+	if complete {
+		return true
+	}
+	// the feed holds every status newer than its oldest one,
+	// so a full page read downward can't miss trimmed statuses
+	if !p.Upward() && n >= p.Limit {
+		return true
+	}
+	return object.StatusID(p.After()) >= oldest
+}
+
+func reverseIDs(ids []object.StatusID) {
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+}
@@ -0,0 +1,236 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Member marking a feed which has not been trimmed.
+// As it sorts before any status, it is the first member dropped by trimming.
+// It also keeps the key of an empty feed existing.
+const completeMarker = "0"
+
+// Status IDs are stored as zero-padded members with the same score and ranged
+// lexicographically, as scores (float64) can't hold 64-bit IDs exactly
+const memberFormat = "%019d"
+
+// Member keeping the key of a feed being rebuilt existing, removed by Store
+const buildingMarker = "-"
+
+// Time to keep a feed being rebuilt, in case Store is never called
+const buildingTTL = time.Minute
+
+type (
+	// Implementation of repository.HomeFeed storing sorted sets in Redis
+	redisFeed struct {
+		pool *redis.Pool
+		size int
+	}
+)
+
+// Add ARGV[1] to the existing sorted sets of KEYS, keeping ARGV[2] members at most
+var pushScript = redis.NewScript(-1, `
+for _, key in ipairs(KEYS) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('ZADD', key, 0, ARGV[1])
+		redis.call('ZREMRANGEBYRANK', key, 0, -(tonumber(ARGV[2]) + 1))
+	end
+end
+return 0
+`)
+
+// Add ARGV[4..] to the feed being rebuilt at KEYS[2], and replace the feed at KEYS[1] with it.
+// Without the feed being rebuilt, they are added to KEYS[1] instead.
+// ARGV[1] is the member marking a complete feed, kept only if ARGV[2] is 1,
+// and ARGV[3] is the number of members to keep at most.
+var storeScript = redis.NewScript(2, `
+local dest = KEYS[1]
+local building = redis.call('EXISTS', KEYS[2]) == 1
+if building then
+	dest = KEYS[2]
+	redis.call('ZREM', dest, '`+buildingMarker+`')
+elseif ARGV[2] == '1' and redis.call('EXISTS', dest) == 0 then
+	redis.call('ZADD', dest, 0, ARGV[1])
+end
+for i = 4, #ARGV do
+	redis.call('ZADD', dest, 0, ARGV[i])
+end
+if ARGV[2] ~= '1' then
+	redis.call('ZREM', dest, ARGV[1])
+end
+redis.call('ZREMRANGEBYRANK', dest, 0, -(tonumber(ARGV[3]) + 1))
+if building then
+	if redis.call('EXISTS', dest) == 1 then
+		redis.call('RENAME', dest, KEYS[1])
+		redis.call('PERSIST', KEYS[1])
+	else
+		redis.call('DEL', KEYS[1])
+	end
+end
+return 0
+`)
+
+// Create home feed stored in Redis, holding up to size statuses per account
+func NewRedis(pool *redis.Pool, size int) repository.HomeFeed {
+	return &redisFeed{pool: pool, size: size}
+}
+
+// Create connection pool of Redis at url
+func NewRedisPool(url string) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle: 10,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return redis.DialURLContext(ctx, url)
+		},
+	}
+}
+
+func key(accountID object.AccountID) string {
+	return "feed:home:v2:" + strconv.FormatInt(int64(accountID), 10)
+}
+
+// Key of the feed being rebuilt, which receives pushes until Store renames it to key
+func buildingKey(accountID object.AccountID) string {
+	return key(accountID) + ":building"
+}
+
+func member(id int64) string {
+	return fmt.Sprintf(memberFormat, id)
+}
+
+func (r *redisFeed) Push(ctx context.Context, id object.StatusID, accountIDs []object.AccountID) error {
+	if len(accountIDs) == 0 {
+		return nil
+	}
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer conn.Close()
+
+	args := make([]interface{}, 0, 2*len(accountIDs)+3)
+	args = append(args, 2*len(accountIDs))
+	for _, accountID := range accountIDs {
+		args = append(args, key(accountID), buildingKey(accountID))
+	}
+	// the marker is kept as long as the feed has no more than size statuses
+	args = append(args, member(int64(id)), r.size+1)
+	if _, err := pushScript.Do(conn, args...); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (r *redisFeed) Range(ctx context.Context, accountID object.AccountID, p object.Parameters) ([]object.StatusID, bool, bool, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("%w", err)
+	}
+	defer conn.Close()
+
+	k := key(accountID)
+	conn.Send("MULTI")
+	conn.Send("EXISTS", k)
+	conn.Send("ZSCORE", k, completeMarker)
+	conn.Send("ZRANGE", k, 0, 0)
+	if p.Upward() {
+		conn.Send("ZRANGEBYLEX", k, "("+member(p.After()), "("+member(p.MaxID), "LIMIT", 0, p.Limit)
+	} else {
+		conn.Send("ZREVRANGEBYLEX", k, "("+member(p.MaxID), "("+member(p.After()), "LIMIT", 0, p.Limit)
+	}
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, false, false, fmt.Errorf("%w", err)
+	}
+
+	exists, err := redis.Bool(replies[0], nil)
+	if err != nil || !exists {
+		return nil, false, false, err
+	}
+	first, err := redis.Int64s(replies[2], nil)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("%w", err)
+	}
+	members, err := redis.Int64s(replies[3], nil)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("%w", err)
+	}
+	ids := make([]object.StatusID, len(members))
+	for i, id := range members {
+		ids[i] = object.StatusID(id)
+	}
+	if p.Upward() {
+		reverseIDs(ids)
+	}
+
+	// trimmed statuses may be in the page
+	complete := replies[1] != nil
+	oldest := object.StatusID(math.MaxInt64)
+	if len(first) > 0 {
+		oldest = object.StatusID(first[0])
+	}
+	if !covers(complete, oldest, p, len(ids)) {
+		return nil, true, false, nil
+	}
+	return ids, true, true, nil
+}
+
+func (r *redisFeed) Prepare(ctx context.Context, accountID object.AccountID) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer conn.Close()
+
+	// 空でもキーが残るように印を入れ、Storeされなければ期限で消える
+	k := buildingKey(accountID)
+	conn.Send("MULTI")
+	conn.Send("ZADD", k, 0, buildingMarker, 0, completeMarker)
+	conn.Send("EXPIRE", k, int(buildingTTL/time.Second))
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (r *redisFeed) Store(ctx context.Context, accountID object.AccountID, ids []object.StatusID, complete bool) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer conn.Close()
+
+	flag := 0
+	if complete {
+		flag = 1
+	}
+	args := make([]interface{}, 0, len(ids)+5)
+	args = append(args, key(accountID), buildingKey(accountID), completeMarker, flag, r.size+1)
+	for _, id := range ids {
+		args = append(args, member(int64(id)))
+	}
+	if _, err := storeScript.Do(conn, args...); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (r *redisFeed) Ping(ctx context.Context) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Do("PING"); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Package accesslog logs a line for each request and carries a logger with its request ID.
+package accesslog
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/logger"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header returning the request ID to the client
+const RequestIDHeader = "X-Request-Id"
+
+type contextKey struct{}
+
+// Values found while handling a request, filled by later handlers
+type record struct {
+	accountID object.AccountID
+}
+
+// Log each request, to be used after middleware.RequestID.
+// The context of the request carries a logger with the request ID.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := r.Context()
+
+		id := middleware.GetReqID(ctx)
+		if id != "" {
+			w.Header().Set(RequestIDHeader, id)
+		}
+		l := logger.FromContext(ctx).With("request_id", id)
+		// 記録中のトレースがあれば、ログからたどれるようにする
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			l = l.With("trace_id", sc.TraceID().String())
+		}
+		rec := new(record)
+		ctx = logger.NewContext(context.WithValue(ctx, contextKey{}, rec), l)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			kv := []interface{}{
+				"method", r.Method,
+				"route", routePattern(r),
+				"path", r.URL.Path,
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+				"remote_addr", r.RemoteAddr,
+			}
+			if rec.accountID != 0 {
+				kv = append(kv, "account_id", rec.accountID)
+			}
+			l.Info("access", kv...)
+		}()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
+
+// Record the authenticated account of the request.
+// The returned context carries a logger with the account ID.
+func SetAccountID(ctx context.Context, id object.AccountID) context.Context {
+	if rec, ok := ctx.Value(contextKey{}).(*record); ok {
+		rec.accountID = id
+	}
+	return logger.NewContext(ctx, logger.FromContext(ctx).With("account_id", id))
+}
+
+// Route pattern matched by chi, like "/v1/statuses/{id}"
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
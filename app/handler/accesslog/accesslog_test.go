@@ -0,0 +1,62 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yatter-backend-go/app/handler/accesslog"
+	"yatter-backend-go/app/logger"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	buf := new(bytes.Buffer)
+	defer logger.SetDefault(logger.Default())
+	logger.SetDefault(logger.New(buf, logger.FormatJSON, logger.LevelInfo))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(accesslog.Middleware)
+	r.Get("/v1/statuses/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// 後のハンドラーが見つけたアカウントとエラーのログにもリクエストIDが付く
+		ctx := accesslog.SetAccountID(r.Context(), 7)
+		logger.FromContext(ctx).Error("failed")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hello"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/statuses/1", nil))
+
+	id := w.Header().Get(accesslog.RequestIDHeader)
+	assert.NotEmpty(t, id)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	var failed, access map[string]interface{}
+	if err := json.Unmarshal(lines[0], &failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(lines[1], &access); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, id, failed["request_id"])
+	assert.Equal(t, float64(7), failed["account_id"])
+
+	assert.Equal(t, "access", access["msg"])
+	assert.Equal(t, id, access["request_id"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/v1/statuses/{id}", access["route"])
+	assert.Equal(t, float64(http.StatusTeapot), access["status"])
+	assert.Equal(t, float64(5), access["bytes"])
+	assert.Equal(t, float64(7), access["account_id"])
+	assert.Contains(t, access, "latency_ms")
+}
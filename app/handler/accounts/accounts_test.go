@@ -2,21 +2,29 @@ package accounts_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"yatter-backend-go/app/config"
 	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/accounts"
 	"yatter-backend-go/app/handler/handler_test_setup"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pquerna/otp/totp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,7 +41,7 @@ func TestAccount(t *testing.T) {
 		{
 			name: "Create",
 			request: func(m *handler_test_setup.C) (*http.Response, error) {
-				body := bytes.NewReader([]byte(fmt.Sprintf(`{"username":"%s"}`, handler_test_setup.CreateUser)))
+				body := bytes.NewReader([]byte(fmt.Sprintf(`{"username":"%s","email":"smith@example.com","password":"c0rrect horse"}`, handler_test_setup.CreateUser)))
 				req, err := http.NewRequest("POST", m.AsURL("/v1/accounts"), body)
 				if err != nil {
 					t.Fatal(err)
@@ -86,7 +94,7 @@ func TestAccount(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", contentType)
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", m.Bearer(handler_test_setup.ExistingUsername1))
 				return m.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusOK,
@@ -97,7 +105,7 @@ func TestAccount(t *testing.T) {
 		{
 			name: "CreateDupricatedUsername",
 			request: func(m *handler_test_setup.C) (*http.Response, error) {
-				body := bytes.NewReader([]byte(fmt.Sprintf(`{"username":"%s"}`, handler_test_setup.ExistingUsername1)))
+				body := bytes.NewReader([]byte(fmt.Sprintf(`{"username":"%s","email":"smith@example.com","password":"c0rrect horse"}`, handler_test_setup.ExistingUsername1)))
 				req, err := http.NewRequest("POST", m.AsURL("/v1/accounts"), body)
 				if err != nil {
 					t.Fatal(err)
@@ -109,14 +117,26 @@ func TestAccount(t *testing.T) {
 		{
 			name: "CreateEmptyUsername",
 			request: func(m *handler_test_setup.C) (*http.Response, error) {
-				body := bytes.NewReader([]byte(fmt.Sprintf(`{"username":"%s"}`, "")))
+				body := bytes.NewReader([]byte(fmt.Sprintf(`{"username":"%s","email":"smith@example.com","password":"c0rrect horse"}`, "")))
 				req, err := http.NewRequest("POST", m.AsURL("/v1/accounts"), body)
 				if err != nil {
 					t.Fatal(err)
 				}
 				return m.Server.Client().Do(req)
 			},
-			expectStatusCode: http.StatusBadRequest,
+			expectStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "CreateWeakPassword",
+			request: func(m *handler_test_setup.C) (*http.Response, error) {
+				body := bytes.NewReader([]byte(fmt.Sprintf(`{"username":"%s","email":"smith@example.com","password":"password"}`, handler_test_setup.CreateUser)))
+				req, err := http.NewRequest("POST", m.AsURL("/v1/accounts"), body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return m.Server.Client().Do(req)
+			},
+			expectStatusCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "CreateFailUnmatshalJSON",
@@ -206,7 +226,7 @@ func TestFollowReturnRelation(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusNotFound,
@@ -220,7 +240,7 @@ func TestFollowReturnRelation(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusOK,
@@ -239,7 +259,7 @@ func TestFollowReturnRelation(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername2))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername2))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusOK,
@@ -258,7 +278,7 @@ func TestFollowReturnRelation(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername2))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername2))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusNotFound,
@@ -340,7 +360,7 @@ func TestRelationships(t *testing.T) {
 			params.Add("username", tt.username)
 			req.URL.RawQuery = params.Encode()
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authentication", fmt.Sprintf("username %s", tt.login))
+			req.Header.Set("Authentication", m.Bearer(tt.login))
 			resp, err := m.Server.Client().Do(req)
 			if err != nil {
 				t.Fatal(err)
@@ -551,3 +571,472 @@ func TestFollowReturnAccounts(t *testing.T) {
 		})
 	}
 }
+
+// Send a request with JSON body, authenticated as username if not empty
+func TestUpdateCredentialsTooLarge(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+	m.App.Config.Media.MaxUploadBytes = 1 << 10
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(bytes.Repeat([]byte{0}, 2<<10)); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+	req, err := http.NewRequest("POST", m.AsURL("/v1/accounts/update_credentials"), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authentication", m.Bearer(handler_test_setup.ExistingUsername1))
+	resp, err := m.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// 上限を超えたボディは400ではなく413になる
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func send(t *testing.T, m *handler_test_setup.C, method string, path string, query string, body string, username string) *http.Response {
+	req, err := http.NewRequest(method, m.AsURL(path), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.URL.RawQuery = query
+	req.Header.Set("Content-Type", "application/json")
+	if username != "" {
+		req.Header.Set("Authentication", m.Bearer(username))
+	}
+	resp, err := m.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// Token following prefix in the last email sent
+func mailToken(t *testing.T, m *handler_test_setup.C, prefix string) string {
+	mails := m.Mails()
+	if !assert.NotEmpty(t, mails) {
+		t.FailNow()
+	}
+	body := mails[len(mails)-1].Body
+	i := strings.Index(body, prefix)
+	if i < 0 {
+		t.Fatalf("no token in %q", body)
+	}
+	return strings.Fields(body[i+len(prefix):])[0]
+}
+
+func TestRegistration(t *testing.T) {
+	post := func(m *handler_test_setup.C, path string, body string) *http.Response {
+		return send(t, m, "POST", path, "", body, "")
+	}
+	get := func(m *handler_test_setup.C, path string, query string, username string) *http.Response {
+		return send(t, m, "GET", path, query, "", username)
+	}
+	// メールに書かれた確認用URLのトークン
+	token := func(t *testing.T, m *handler_test_setup.C) string {
+		return mailToken(t, m, "token=")
+	}
+	const create = `{"username":"smith","email":"smith@example.com","password":"c0rrect horse"}`
+
+	t.Run("Confirm", func(t *testing.T) {
+		m := handler_test_setup.MockSetup()
+		defer m.Close()
+
+		assert.Equal(t, http.StatusOK, post(m, "/v1/accounts", create).StatusCode)
+		assert.Equal(t, "smith@example.com", m.Mails()[0].To)
+
+		// 確認前はログインできない
+		assert.Equal(t, http.StatusForbidden, get(m, "/v1/accounts/relationships", "username=john", "smith").StatusCode)
+
+		assert.Equal(t, http.StatusNotFound, get(m, "/v1/accounts/confirm", "token=invalid", "").StatusCode)
+		tok := token(t, m)
+		assert.Equal(t, http.StatusOK, get(m, "/v1/accounts/confirm", "token="+tok, "").StatusCode)
+		assert.Equal(t, http.StatusOK, get(m, "/v1/accounts/relationships", "username=john", "smith").StatusCode)
+
+		// トークンは一度しか使えない
+		assert.Equal(t, http.StatusNotFound, get(m, "/v1/accounts/confirm", "token="+tok, "").StatusCode)
+	})
+
+	t.Run("DuplicatedEmail", func(t *testing.T) {
+		m := handler_test_setup.MockSetup()
+		defer m.Close()
+
+		assert.Equal(t, http.StatusOK, post(m, "/v1/accounts", create).StatusCode)
+		// メールアドレスは大文字小文字を区別せずに重複をチェックする
+		body := `{"username":"smith2","email":"Smith@Example.com","password":"c0rrect horse"}`
+		assert.Equal(t, http.StatusConflict, post(m, "/v1/accounts", body).StatusCode)
+	})
+
+	t.Run("Resend", func(t *testing.T) {
+		m := handler_test_setup.MockSetup()
+		defer m.Close()
+
+		assert.Equal(t, http.StatusOK, post(m, "/v1/accounts", create).StatusCode)
+		first := token(t, m)
+
+		assert.Equal(t, http.StatusAccepted, post(m, "/v1/accounts/confirm/resend", `{"email":"smith@example.com"}`).StatusCode)
+		assert.Len(t, m.Mails(), 2)
+		// 登録されていないアドレスでも同じ応答を返す
+		assert.Equal(t, http.StatusAccepted, post(m, "/v1/accounts/confirm/resend", `{"email":"fred@example.com"}`).StatusCode)
+		assert.Len(t, m.Mails(), 2)
+
+		// 再送すると古いトークンは使えなくなる
+		assert.Equal(t, http.StatusNotFound, get(m, "/v1/accounts/confirm", "token="+first, "").StatusCode)
+		assert.Equal(t, http.StatusOK, get(m, "/v1/accounts/confirm", "token="+token(t, m), "").StatusCode)
+	})
+
+	t.Run("Approval", func(t *testing.T) {
+		m := handler_test_setup.MockSetup()
+		defer m.Close()
+		m.App.Config.Registrations.Mode = config.RegistrationsApproval
+
+		assert.Equal(t, http.StatusOK, post(m, "/v1/accounts", create).StatusCode)
+		assert.Equal(t, http.StatusOK, get(m, "/v1/accounts/confirm", "token="+token(t, m), "").StatusCode)
+
+		// 承認されるまではログインできない
+		assert.Equal(t, http.StatusForbidden, get(m, "/v1/accounts/relationships", "username=john", "smith").StatusCode)
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		m := handler_test_setup.MockSetup()
+		defer m.Close()
+		m.App.Config.Registrations.Mode = config.RegistrationsClosed
+
+		assert.Equal(t, http.StatusForbidden, post(m, "/v1/accounts", create).StatusCode)
+		assert.Empty(t, m.Mails())
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+
+	tests := []struct {
+		name             string
+		body             string
+		expectStatusCode int
+	}{
+		{
+			name:             "WrongPassword",
+			body:             `{"current_password":"wrong","new_password":"n3w battery staple"}`,
+			expectStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:             "WeakPassword",
+			body:             `{"current_password":"passw0rd","new_password":"password"}`,
+			expectStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:             "Change",
+			body:             `{"current_password":"passw0rd","new_password":"n3w battery staple"}`,
+			expectStatusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := send(t, m, "POST", "/v1/accounts/change_password", "", tt.body, handler_test_setup.ExistingUsername1)
+			assert.Equal(t, tt.expectStatusCode, resp.StatusCode)
+		})
+	}
+
+	a, err := m.App.Dao.Account().FindByUsername(context.Background(), handler_test_setup.ExistingUsername1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, a.CheckPassword("n3w battery staple"))
+}
+
+func TestResetPassword(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+
+	resp := send(t, m, "POST", "/v1/accounts", "", `{"username":"smith","email":"smith@example.com","password":"c0rrect horse"}`, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	confirmation := mailToken(t, m, "token=")
+
+	// 登録されていないアドレスでも同じ応答を返す
+	resp = send(t, m, "POST", "/v1/accounts/password/forgot", "", `{"email":"fred@example.com"}`, "")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Len(t, m.Mails(), 1)
+
+	resp = send(t, m, "POST", "/v1/accounts/password/forgot", "", `{"email":"Smith@example.com"}`, "")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Len(t, m.Mails(), 2)
+	token := mailToken(t, m, "Token: ")
+
+	tests := []struct {
+		name             string
+		body             string
+		expectStatusCode int
+	}{
+		{
+			name:             "InvalidToken",
+			body:             `{"token":"invalid","password":"n3w battery staple"}`,
+			expectStatusCode: http.StatusNotFound,
+		},
+		{
+			// メールアドレスの確認用のトークンでは再設定できない
+			name:             "ConfirmationToken",
+			body:             fmt.Sprintf(`{"token":"%s","password":"n3w battery staple"}`, confirmation),
+			expectStatusCode: http.StatusNotFound,
+		},
+		{
+			name:             "WeakPassword",
+			body:             fmt.Sprintf(`{"token":"%s","password":"password"}`, token),
+			expectStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:             "Reset",
+			body:             fmt.Sprintf(`{"token":"%s","password":"n3w battery staple"}`, token),
+			expectStatusCode: http.StatusOK,
+		},
+		{
+			// トークンは一度しか使えない
+			name:             "Reused",
+			body:             fmt.Sprintf(`{"token":"%s","password":"n3w battery staple"}`, token),
+			expectStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := send(t, m, "POST", "/v1/accounts/password/reset", "", tt.body, "")
+			assert.Equal(t, tt.expectStatusCode, resp.StatusCode)
+		})
+	}
+
+	a, err := m.App.Dao.Account().FindByUsername(context.Background(), "smith")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, a.CheckPassword("n3w battery staple"))
+}
+
+func TestDelete(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+
+	resp := send(t, m, "POST", "/v1/accounts/delete", "", `{"password":"wrong"}`, handler_test_setup.ExistingUsername1)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = send(t, m, "POST", "/v1/accounts/delete", "", `{"password":"passw0rd"}`, handler_test_setup.ExistingUsername1)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// 消えるまでの間もログインできず、見つからない
+	resp = send(t, m, "GET", "/v1/accounts/relationships", "username="+handler_test_setup.ExistingUsername2, "", handler_test_setup.ExistingUsername1)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = send(t, m, "GET", "/v1/accounts/"+handler_test_setup.ExistingUsername1, "", "", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// POST body with the Authentication header, decoding the response into v if given
+func postAs(t *testing.T, m *handler_test_setup.C, path string, body string, authentication string, v interface{}) *http.Response {
+	req, err := http.NewRequest("POST", m.AsURL(path), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authentication != "" {
+		req.Header.Set("Authentication", authentication)
+	}
+	resp, err := m.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+// Log in and return the Authentication header of the access token
+func login(t *testing.T, m *handler_test_setup.C, body string) (*http.Response, string) {
+	var res accounts.LoginResponse
+	resp := postAs(t, m, "/v1/accounts/login", body, "", &res)
+	return resp, "Bearer " + res.AccessToken
+}
+
+func TestLogin(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+	const relationships = "/v1/accounts/" + handler_test_setup.ExistingUsername2 + "/follow"
+
+	resp, _ := login(t, m, `{"username":"john","password":"wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = login(t, m, `{"username":"fred","password":"passw0rd"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, bearer := login(t, m, `{"username":"john","password":"passw0rd"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	resp = postAs(t, m, relationships, "", bearer, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postAs(t, m, relationships, "", "Bearer invalid", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	// ユーザー名だけでは認証できない
+	resp = postAs(t, m, relationships, "", "username "+handler_test_setup.ExistingUsername1, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// ログアウトしたトークンは使えない
+	resp = postAs(t, m, "/v1/accounts/logout", "", bearer, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postAs(t, m, relationships, "", bearer, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// パスワードを変えると、発行済みのトークンはすべて使えなくなる
+	_, bearer = login(t, m, `{"username":"john","password":"passw0rd"}`)
+	resp = postAs(t, m, "/v1/accounts/change_password", `{"current_password":"passw0rd","new_password":"n3w battery staple"}`, bearer, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postAs(t, m, relationships, "", bearer, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestTwoFactor(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+	john := m.Bearer(handler_test_setup.ExistingUsername1)
+	code := func(secret string, at time.Time) string {
+		c, err := totp.GenerateCode(secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	resp := postAs(t, m, "/v1/accounts/two_factor", `{"password":"wrong"}`, john, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	var enroll accounts.EnrollTwoFactorResponse
+	resp = postAs(t, m, "/v1/accounts/two_factor", `{"password":"passw0rd"}`, john, &enroll)
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		t.FailNow()
+	}
+	assert.True(t, strings.HasPrefix(enroll.OtpauthURI, "otpauth://totp/Yatter:john?"), enroll.OtpauthURI)
+	assert.Contains(t, enroll.OtpauthURI, "secret="+enroll.Secret)
+	const dataURI = "data:image/png;base64,"
+	if assert.True(t, strings.HasPrefix(enroll.QRCode, dataURI)) {
+		b, err := base64.StdEncoding.DecodeString(enroll.QRCode[len(dataURI):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = png.Decode(bytes.NewReader(b))
+		assert.NoError(t, err)
+	}
+
+	// 確認するまでは有効にならない
+	now := time.Now()
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postAs(t, m, "/v1/accounts/two_factor/confirm", `{"code":"`+code(enroll.Secret, now.Add(-time.Hour))+`"}`, john, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	var recovery accounts.RecoveryCodesResponse
+	resp = postAs(t, m, "/v1/accounts/two_factor/confirm", `{"code":"`+code(enroll.Secret, now)+`"}`, john, &recovery)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if !assert.Len(t, recovery.RecoveryCodes, 10) {
+		t.FailNow()
+	}
+
+	// ログインにはコードが必要になる
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	// 確認に使ったコードは使えない
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd","code":"`+code(enroll.Secret, now)+`"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, bearer := login(t, m, `{"username":"john","password":"passw0rd","code":"`+code(enroll.Secret, now.Add(30*time.Second))+`"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postAs(t, m, "/v1/accounts/two_factor", `{"password":"passw0rd"}`, bearer, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// リカバリーコードは大文字や区切りなしでも一度だけ使える
+	first := strings.ToUpper(strings.ReplaceAll(recovery.RecoveryCodes[0], "-", ""))
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd","code":"`+first+`"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd","code":"`+first+`"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// 作り直すと古いコードは使えない
+	var regenerated accounts.RecoveryCodesResponse
+	resp = postAs(t, m, "/v1/accounts/two_factor/recovery_codes", `{"password":"passw0rd","code":"`+recovery.RecoveryCodes[1]+`"}`, bearer, &regenerated)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, regenerated.RecoveryCodes, 10)
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd","code":"`+recovery.RecoveryCodes[2]+`"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = postAs(t, m, "/v1/accounts/two_factor/disable", `{"password":"passw0rd","code":"`+recovery.RecoveryCodes[3]+`"}`, bearer, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp = postAs(t, m, "/v1/accounts/two_factor/disable", `{"password":"passw0rd","code":"`+regenerated.RecoveryCodes[0]+`"}`, bearer, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 無効にした後は、もう一度は無効にできない
+	resp = postAs(t, m, "/v1/accounts/two_factor/disable", `{"password":"passw0rd","code":"`+regenerated.RecoveryCodes[1]+`"}`, john, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestLoginCodeLimit(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+	m.App.Config.RateLimit.LoginCode = config.RateLimitRule{Requests: 2, Per: time.Hour}
+	john := m.Bearer(handler_test_setup.ExistingUsername1)
+
+	var enroll accounts.EnrollTwoFactorResponse
+	resp := postAs(t, m, "/v1/accounts/two_factor", `{"password":"passw0rd"}`, john, &enroll)
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		t.FailNow()
+	}
+	now := time.Now()
+	code, err := totp.GenerateCode(enroll.Secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = postAs(t, m, "/v1/accounts/two_factor/confirm", `{"code":"`+code+`"}`, john, nil)
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		t.FailNow()
+	}
+
+	// コードがないのとパスワードの間違いは数えない
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, _ = login(t, m, `{"username":"john","password":"wrong","code":"000000"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	for i := 0; i < 2; i++ {
+		resp, _ = login(t, m, `{"username":"john","password":"passw0rd","code":"wrong"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+	// 間違いが上限に達すると、正しいコードでも待たされる
+	code, err = totp.GenerateCode(enroll.Secret, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ = login(t, m, `{"username":"john","password":"passw0rd","code":"`+code+`"}`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	// 他のアカウントには影響しない
+	resp, _ = login(t, m, `{"username":"sum","password":"passw0rd"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTwoFactorNotConfigured(t *testing.T) {
+	m := handler_test_setup.MockSetup()
+	defer m.Close()
+	m.App.Secrets = nil
+
+	resp := postAs(t, m, "/v1/accounts/two_factor", `{"password":"passw0rd"}`, m.Bearer(handler_test_setup.ExistingUsername1), nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,157 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/parameters"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/mailer"
+)
+
+// Request body for "POST /v1/accounts/confirm/resend"
+type ResendRequest struct {
+	Email string `validate:"required,max=255,email"`
+}
+
+// Save a new token of the account valid for ttl, returning the token to be sent
+func issueToken(ctx context.Context, repo repository.Confirmation, purpose object.TokenPurpose, id object.AccountID, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	err := repo.Insert(ctx, object.ConfirmationToken{
+		Hash:      object.HashToken(token),
+		Purpose:   purpose,
+		AccountID: id,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Save a new token to confirm the email of the account
+func (h *handler) issueConfirmation(ctx context.Context, repo repository.Confirmation, id object.AccountID) (string, error) {
+	return issueToken(ctx, repo, object.PurposeEmail, id, h.app.Config.Registrations.ConfirmationTTL)
+}
+
+// Send the link to confirm email, only logging failures
+func (h *handler) sendConfirmation(r *http.Request, email string, token string) {
+	link := parameters.URL(r, h.app.Config.PublicURL, "/v1/accounts/confirm", url.Values{"token": {token}})
+	body := "Open the link below to confirm your email address.\n\n" + link + "\n\n" +
+		"The link expires in " + h.app.Config.Registrations.ConfirmationTTL.String() + ".\n" +
+		"If you did not create an account, ignore this email.\n"
+
+	err := h.app.Mailer.Send(r.Context(), mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body:    body,
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("send confirmation", "error", err)
+	}
+}
+
+// Handle request for "GET /v1/accounts/confirm"
+func (h *handler) Confirm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		httperror.Respond(w, r, errs.BadRequest("token is required"))
+		return
+	}
+
+	// トークンは一度だけ使えるように、確認と削除を1つのトランザクションで行う
+	var entity *object.Account
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		t, err := tx.Confirmation().FindValid(ctx, object.PurposeEmail, object.HashToken(token), time.Now())
+		if err != nil {
+			return err
+		} else if t == nil {
+			return errs.NotFound("confirmation token")
+		}
+
+		approval := h.app.Config.Registrations.Mode == config.RegistrationsApproval
+		if err := tx.Account().ConfirmEmail(ctx, t.AccountID, approval); err != nil {
+			return err
+		}
+		if err := tx.Confirmation().DeleteByAccountID(ctx, object.PurposeEmail, t.AccountID); err != nil {
+			return err
+		}
+
+		accounts, err := tx.Account().FindAccountsByIDs(ctx, []object.AccountID{t.AccountID})
+		if err != nil {
+			return err
+		}
+		entity = accounts[t.AccountID]
+		return nil
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if entity == nil {
+		httperror.Respond(w, r, errs.NotFound("account"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entity); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
+
+// Handle request for "POST /v1/accounts/confirm/resend"
+func (h *handler) ResendConfirmation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req ResendRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	email := strings.ToLower(req.Email)
+
+	// 登録されているかどうかを知られないように、常に受け付けたと返す
+	var token string
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		a, err := tx.Account().FindByEmail(ctx, email)
+		if err != nil || a == nil || a.EmailConfirmedAt != nil || a.IsDeleted() {
+			return err
+		}
+
+		// 古いリンクは使えなくする
+		if err := tx.Confirmation().DeleteByAccountID(ctx, object.PurposeEmail, a.ID); err != nil {
+			return err
+		}
+		token, err = h.issueConfirmation(ctx, tx.Confirmation(), a.ID)
+		return err
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if token != "" {
+		h.sendConfirmation(r, email, token)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -4,60 +4,47 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/domain/repository"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/validate"
 )
 
 // Request body for "POST /v1/accounts"
 type AddRequest struct {
-	Username     string
-	Password     string
-	Display_Name string
-	Note         string
+	Username     string `validate:"required,max=30,username"`
+	Email        string `validate:"required,max=255,email"`
+	Password     string `validate:"required,min=12,maxbytes=72,password"`
+	Display_Name string `validate:"max=30"`
+	Note         string `validate:"max=500"`
 	Avatar       string
 	Header       string
 }
 
-// Custom error type
-type (
-	errBadrequest struct {
-		message string
-	}
-
-	errConflict struct{}
-)
-
-func (e *errBadrequest) Error() string {
-	return e.message
-}
-
-func (e *errConflict) Error() string {
-	return ""
-}
-
-func parseRequest(ctx context.Context, r *http.Request, repo repository.Account) (*object.Account, error) {
+// リクエストを読んでパスワードをハッシュにしたアカウントを作る
+// bcryptは遅いので、トランザクションを始める前に呼ぶ
+func parseRequest(r *http.Request) (*object.Account, error) {
 	var req AddRequest
 	d := json.NewDecoder(r.Body)
 	if err := d.Decode(&req); err != nil {
-		return nil, &errBadrequest{message: err.Error()}
+		return nil, errs.BadRequest("request body is not valid JSON")
 	}
 
-	if len(req.Username) < 1 {
-		return nil, &errBadrequest{message: "empty username"}
-	}
-
-	// 同じユーザー名がいるかチェック
-	a, err := repo.FindByUsername(ctx, req.Username)
-	if err != nil {
+	if err := validate.Struct(&req); err != nil {
 		return nil, err
-	} else if a != nil {
-		return nil, &errConflict{}
 	}
 
+	// メールアドレスは大文字小文字を区別しない
+	email := strings.ToLower(req.Email)
 	account := &object.Account{
 		Username:    req.Username,
+		Email:       &email,
+		State:       object.AccountPending,
 		Avatar:      &req.Avatar,
 		Note:        &req.Note,
 		Header:      &req.Header,
@@ -77,48 +64,85 @@ func parseRequest(ctx context.Context, r *http.Request, repo repository.Account)
 		}
 	}
 
-	if err = account.SetPassword(req.Password); err != nil {
+	if err := account.SetPassword(req.Password); err != nil {
 		return nil, err
 	}
 	return account, nil
 }
 
+// 同じユーザー名やメールアドレスのアカウントがいないか確かめる
+func checkUnique(ctx context.Context, repo repository.Account, account *object.Account) error {
+	a, err := repo.FindByUsername(ctx, account.Username)
+	if err != nil {
+		return err
+	} else if a != nil {
+		return errs.Conflict("username %q is already taken", account.Username)
+	}
+
+	a, err = repo.FindByEmail(ctx, *account.Email)
+	if err != nil {
+		return err
+	} else if a != nil {
+		return errs.Conflict("email is already taken")
+	}
+	return nil
+}
+
 // Handle request for "POST /v1/accounts"
 func (h *handler) Create(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	account, err := parseRequest(ctx, r, h.app.Dao.Account())
-	if err != nil {
-		switch err.(type) {
-		case *errBadrequest:
-			httperror.BadRequest(w, err)
-			return
-		case *errConflict:
-			httperror.Error(w, http.StatusConflict)
-			return
-		default:
-			httperror.InternalServerError(w, err)
-			return
-		}
+	if h.app.Config.Registrations.Mode == config.RegistrationsClosed {
+		httperror.Respond(w, r, errs.Forbidden("registrations are closed"))
+		return
 	}
 
-	// データベースにアカウント作成
-	if _, err = h.app.Dao.Account().Insert(ctx, *account); err != nil {
-		httperror.InternalServerError(w, err)
+	account, err := parseRequest(r)
+	if err != nil {
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	// データベース上のアカウント情報を取得
-	entity, err := h.app.Dao.Account().FindByUsername(ctx, account.Username)
+	// 重複チェックから作成直後の読み出しまでを1つのトランザクションで行う
+	var entity *object.Account
+	var token string
+	err = h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		if err := checkUnique(ctx, tx.Account(), account); err != nil {
+			return err
+		}
+
+		// データベースにアカウント作成
+		id, err := tx.Account().Insert(ctx, *account)
+		if err != nil {
+			return err
+		}
+
+		// メールアドレスの確認用トークンを発行
+		token, err = h.issueConfirmation(ctx, tx.Confirmation(), id)
+		if err != nil {
+			return err
+		}
+
+		// データベース上のアカウント情報を取得
+		entity, err = tx.Account().FindByUsername(ctx, account.Username)
+		return err
+	})
+	// 同時に作成されたアカウントとは、確認をすり抜けても一意制約でぶつかる
+	if dao.IsDuplicate(err) {
+		err = errs.Conflict("username or email is already taken")
+	}
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
+	// 送れなくても再送できるので、作成は成功とする
+	h.sendConfirmation(r, *entity.Email, token)
+
 	// アカウント情報をjsonにエンコード
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(entity); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -0,0 +1,43 @@
+package accounts
+
+import (
+	"fmt"
+	"net/http"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/httperror"
+)
+
+// Request body for "POST /v1/accounts/delete"
+type DeleteRequest struct {
+	Password string `validate:"required"`
+}
+
+// Handle request for "POST /v1/accounts/delete"
+func (h *handler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login := auth.AccountOf(r)
+	if login == nil {
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
+	}
+
+	var req DeleteRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if !login.CheckPassword(req.Password) {
+		httperror.Respond(w, r, errs.Invalid("password", "incorrect", "password is incorrect"))
+		return
+	}
+
+	// すぐにログインできなくし、投稿やファイルはjob.AccountPurgeがバックグラウンドで消す
+	if err := h.app.Dao.Account().MarkDeleted(ctx, login.ID); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -3,6 +3,7 @@ package accounts
 import (
 	"encoding/json"
 	"net/http"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/handler/httperror"
 
 	"github.com/go-chi/chi"
@@ -15,17 +16,17 @@ func (h *handler) Fetch(w http.ResponseWriter, r *http.Request) {
 	// データベースからアカウント情報を取得
 	account, err := h.app.Dao.Account().FindByUsername(ctx, chi.URLParam(r, "username"))
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
-	if account == nil {
-		httperror.Error(w, http.StatusNotFound)
+	if account == nil || account.IsDeleted() {
+		httperror.Respond(w, r, errs.NotFound("account"))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(account); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/metrics"
 
 	"github.com/go-chi/chi"
 )
@@ -17,17 +20,17 @@ func (h *handler) Follow(w http.ResponseWriter, r *http.Request) {
 
 	login := auth.AccountOf(r)
 	if login == nil {
-		httperror.InternalServerError(w, fmt.Errorf("lost account"))
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
 		return
 	}
 
 	target, err := h.app.Dao.Account().FindByUsername(ctx, chi.URLParam(r, "username"))
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
-	if target == nil {
-		httperror.Error(w, http.StatusNotFound)
+	if target == nil || target.IsDeleted() {
+		httperror.Respond(w, r, errs.NotFound("account"))
 		return
 	}
 
@@ -39,28 +42,34 @@ func (h *handler) Follow(w http.ResponseWriter, r *http.Request) {
 	// フォローしているか
 	relation.Following, err = h.app.Dao.Relation().IsFollowing(ctx, login.ID, target.ID)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 	// フォローしてなかったらフォローする
 	if !relation.Following {
 		if err = h.app.Dao.Relation().Follow(ctx, login.ID, target.ID); err != nil {
-			httperror.InternalServerError(w, err)
+			httperror.Respond(w, r, err)
 			return
 		}
 		relation.Following = true
+		metrics.Follows.Inc()
+
+		// フォロー関係が変わったのでホームフィードを作り直す
+		if err := h.app.HomeFeed.Rebuild(ctx, login.ID); err != nil {
+			logger.FromContext(ctx).Warn("rebuild home feed", "account_id", login.ID, "error", err)
+		}
 	}
 
 	// フォローされているか
 	relation.FollowedBy, err = h.app.Dao.Relation().IsFollowing(ctx, target.ID, login.ID)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(relation); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -3,6 +3,7 @@ package accounts
 import (
 	"encoding/json"
 	"net/http"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/handler/httperror"
 	"yatter-backend-go/app/handler/parameters"
 
@@ -15,28 +16,32 @@ func (h *handler) Followers(w http.ResponseWriter, r *http.Request) {
 
 	account, err := h.app.Dao.Account().FindByUsername(ctx, chi.URLParam(r, "username"))
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
-	if account == nil {
-		httperror.Error(w, http.StatusNotFound)
+	if account == nil || account.IsDeleted() {
+		httperror.Respond(w, r, errs.NotFound("account"))
 		return
 	}
 
-	p, err := parameters.ParseAll(r)
+	p, err := parameters.ParsePage(r)
 	if err != nil {
-		httperror.BadRequest(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	accounts, err := h.app.Dao.Relation().Followers(ctx, account.ID, *p)
+	follows, err := h.app.Dao.Relation().Followers(ctx, account.ID, *p)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
+
+	if n := len(follows); n > 0 {
+		parameters.SetLink(w, r, h.app.Config.PublicURL, p, n, follows[0].ID, follows[n-1].ID)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(accounts); err != nil {
-		httperror.InternalServerError(w, err)
+	if err := json.NewEncoder(w).Encode(follows); err != nil {
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -0,0 +1,128 @@
+package accounts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/ratelimit"
+)
+
+// Request body for "POST /v1/accounts/login"
+type LoginRequest struct {
+	Username string `validate:"required"`
+	Password string `validate:"required"`
+
+	// TOTP code or recovery code, required for accounts with two-factor authentication
+	Code string
+}
+
+// Response of "POST /v1/accounts/login"
+type LoginResponse struct {
+	// Token to send as "Authentication: Bearer <token>"
+	AccessToken string `json:"access_token"`
+
+	TokenType string `json:"token_type"`
+
+	// The time the token gets invalid
+	ExpiresAt object.DateTime `json:"expires_at"`
+}
+
+// Handle request for "POST /v1/accounts/login"
+func (h *handler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req LoginRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	// ユーザー名とパスワードのどちらが違うかは教えない
+	a, err := h.app.Dao.Account().FindByUsername(ctx, req.Username)
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	} else if a == nil || a.IsDeleted() || !a.CheckPassword(req.Password) {
+		httperror.Respond(w, r, errs.Unauthorized("username or password is incorrect"))
+		return
+	} else if !a.IsConfirmed() {
+		httperror.Respond(w, r, errs.Forbidden("account is pending confirmation"))
+		return
+	}
+	if a.TwoFactorEnabled && req.Code == "" {
+		httperror.Respond(w, r, errs.Invalid("code", "blank", "code is required for two-factor authentication"))
+		return
+	}
+
+	// IPアドレスを変えながらのコードの総当たりを防ぐため、アカウントごとに失敗を数える
+	codeLimit := h.app.Config.RateLimit.LoginCode.Limit()
+	codeKey := strconv.FormatInt(a.ID, 10)
+	if a.TwoFactorEnabled && !ratelimit.Allow(w, r, h.app.RateLimits, "login_code", codeKey, codeLimit) {
+		return
+	}
+
+	ttl := h.app.Config.Accounts.AccessTokenTTL
+	var token string
+	var codeFailed bool
+	err = h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		if a.TwoFactorEnabled {
+			t, err := findEnabled(ctx, tx.TwoFactor(), a.ID)
+			if err != nil {
+				return err
+			}
+			if ok, err := h.verifySecondFactor(ctx, tx.TwoFactor(), t, req.Code); err != nil {
+				return err
+			} else if !ok {
+				codeFailed = true
+				return errs.Invalid("code", "incorrect", "code is incorrect")
+			}
+		}
+
+		token, err = issueToken(ctx, tx.Confirmation(), object.PurposeAccess, a.ID, ttl)
+		return err
+	})
+	if codeFailed {
+		ratelimit.Fail(r, h.app.RateLimits, "login_code", codeKey, codeLimit)
+	}
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(&LoginResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresAt:   object.DateTime{Time: time.Now().Add(ttl).UTC().Truncate(time.Second)},
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
+
+// Handle request for "POST /v1/accounts/logout"
+func (h *handler) Logout(w http.ResponseWriter, r *http.Request) {
+	token := auth.AccessTokenOf(r)
+	if token == "" {
+		httperror.Respond(w, r, errs.BadRequest("only access tokens can be revoked"))
+		return
+	}
+
+	if err := h.app.Dao.Confirmation().Delete(r.Context(), object.HashToken(token)); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&struct{}{}); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,192 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/parameters"
+	"yatter-backend-go/app/handler/validate"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/mailer"
+)
+
+// Request body for "POST /v1/accounts/change_password"
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=12,maxbytes=72,password"`
+}
+
+// Request body for "POST /v1/accounts/password/forgot"
+type ForgotPasswordRequest struct {
+	Email string `validate:"required,max=255,email"`
+}
+
+// Request body for "POST /v1/accounts/password/reset"
+type ResetPasswordRequest struct {
+	Token    string `validate:"required"`
+	Password string `validate:"required,min=12,maxbytes=72,password"`
+}
+
+// Decode JSON body of r into the request struct v and validate it
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return errs.BadRequest("request body is not valid JSON")
+	}
+	return validate.Struct(v)
+}
+
+// Delete tokens to reset password and access tokens of the account, as its password has changed
+func revokeTokens(ctx context.Context, repo repository.Confirmation, id object.AccountID) error {
+	for _, purpose := range []object.TokenPurpose{object.PurposePasswordReset, object.PurposeAccess} {
+		if err := repo.DeleteByAccountID(ctx, purpose, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handle request for "POST /v1/accounts/change_password"
+func (h *handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login := auth.AccountOf(r)
+	if login == nil {
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if !login.CheckPassword(req.CurrentPassword) {
+		httperror.Respond(w, r, errs.Invalid("current_password", "incorrect", "current_password is incorrect"))
+		return
+	}
+	if err := login.SetPassword(req.NewPassword); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	// 変更前に送った再設定用のトークンと、ログインで発行したトークンは使えなくする
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		if err := tx.Account().UpdatePassword(ctx, login.ID, login.PasswordHash); err != nil {
+			return err
+		}
+		return revokeTokens(ctx, tx.Confirmation(), login.ID)
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&struct{}{}); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
+
+// Handle request for "POST /v1/accounts/password/forgot"
+func (h *handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req ForgotPasswordRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	email := strings.ToLower(req.Email)
+
+	// 登録されているかどうかを知られないように、常に受け付けたと返す
+	var token string
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		a, err := tx.Account().FindByEmail(ctx, email)
+		if err != nil || a == nil || a.IsDeleted() {
+			return err
+		}
+
+		// 古いトークンは使えなくする
+		if err := tx.Confirmation().DeleteByAccountID(ctx, object.PurposePasswordReset, a.ID); err != nil {
+			return err
+		}
+		token, err = issueToken(ctx, tx.Confirmation(), object.PurposePasswordReset, a.ID, h.app.Config.Accounts.PasswordResetTTL)
+		return err
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if token != "" {
+		h.sendPasswordReset(r, email, token)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Send the token to reset password, only logging failures
+func (h *handler) sendPasswordReset(r *http.Request, email string, token string) {
+	endpoint := parameters.URL(r, h.app.Config.PublicURL, "/v1/accounts/password/reset", nil)
+	body := "A password reset was requested for your account.\n\n" +
+		"Token: " + token + "\n\n" +
+		"Send it with a new password to " + endpoint + " within " + h.app.Config.Accounts.PasswordResetTTL.String() + ".\n" +
+		"If you did not request this, ignore this email and your password stays the same.\n"
+
+	err := h.app.Mailer.Send(r.Context(), mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("send password reset", "error", err)
+	}
+}
+
+// Handle request for "POST /v1/accounts/password/reset"
+func (h *handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req ResetPasswordRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	var a object.Account
+	if err := a.SetPassword(req.Password); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	// トークンは一度だけ使えるように、変更と削除を1つのトランザクションで行う
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		t, err := tx.Confirmation().FindValid(ctx, object.PurposePasswordReset, object.HashToken(req.Token), time.Now())
+		if err != nil {
+			return err
+		} else if t == nil {
+			return errs.NotFound("reset token")
+		}
+
+		if err := tx.Account().UpdatePassword(ctx, t.AccountID, a.PasswordHash); err != nil {
+			return err
+		}
+		return revokeTokens(ctx, tx.Confirmation(), t.AccountID)
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&struct{}{}); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
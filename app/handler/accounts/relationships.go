@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/httperror"
@@ -16,7 +17,7 @@ func (h *handler) Relationships(w http.ResponseWriter, r *http.Request) {
 
 	login := auth.AccountOf(r)
 	if login == nil {
-		httperror.InternalServerError(w, fmt.Errorf("lost account"))
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
 		return
 	}
 
@@ -25,10 +26,10 @@ func (h *handler) Relationships(w http.ResponseWriter, r *http.Request) {
 	for _, targetName := range targetNames {
 		target, err := h.app.Dao.Account().FindByUsername(ctx, targetName)
 		if err != nil {
-			httperror.InternalServerError(w, err)
+			httperror.Respond(w, r, err)
 			return
-		} else if target == nil {
-			httperror.Error(w, http.StatusNotFound)
+		} else if target == nil || target.IsDeleted() {
+			httperror.Respond(w, r, errs.NotFound("account"))
 			return
 		}
 
@@ -38,13 +39,13 @@ func (h *handler) Relationships(w http.ResponseWriter, r *http.Request) {
 		// フォローしているか
 		relation.Following, err = h.app.Dao.Relation().IsFollowing(ctx, login.ID, target.ID)
 		if err != nil {
-			httperror.InternalServerError(w, err)
+			httperror.Respond(w, r, err)
 			return
 		}
 		// フォローされているか
 		relation.FollowedBy, err = h.app.Dao.Relation().IsFollowing(ctx, target.ID, login.ID)
 		if err != nil {
-			httperror.InternalServerError(w, err)
+			httperror.Respond(w, r, err)
 			return
 		}
 		relations = append(relations, *relation)
@@ -52,7 +53,7 @@ func (h *handler) Relationships(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(relations); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
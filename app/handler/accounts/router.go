@@ -5,6 +5,7 @@ import (
 
 	"yatter-backend-go/app/app"
 	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/ratelimit"
 
 	"github.com/go-chi/chi"
 )
@@ -35,7 +36,29 @@ func NewRouter(app *app.App) http.Handler {
 		r.Post("/", h.UpdateCredentials)
 	})
 
-	r.Post("/", h.Create)
+	r.With(auth.Middleware(app)).Post("/change_password", h.ChangePassword)
+	r.With(auth.Middleware(app)).Post("/delete", h.Delete)
+	r.With(auth.Middleware(app)).Post("/logout", h.Logout)
+
+	r.Route("/two_factor", func(r chi.Router) {
+		r.Use(auth.Middleware(app))
+		r.Post("/", h.EnrollTwoFactor)
+		r.Post("/confirm", h.ConfirmTwoFactor)
+		r.Post("/disable", h.DisableTwoFactor)
+		r.Post("/recovery_codes", h.RegenerateRecoveryCodes)
+	})
+
+	// パスワードやコードを総当たりされないように制限する
+	login := ratelimit.Middleware(app.RateLimits, "login", app.Config.RateLimit.Login.Limit(), ratelimit.ByIP)
+	r.With(login).Post("/login", h.Login)
+
+	// メールを送るリクエストもアカウント作成と同じく制限する
+	creation := ratelimit.Middleware(app.RateLimits, "account_creation", app.Config.RateLimit.AccountCreation.Limit(), ratelimit.ByIP)
+	r.With(creation).Post("/", h.Create)
+	r.Get("/confirm", h.Confirm)
+	r.With(creation).Post("/confirm/resend", h.ResendConfirmation)
+	r.With(creation).Post("/password/forgot", h.ForgotPassword)
+	r.Post("/password/reset", h.ResetPassword)
 	r.Get("/{username}", h.Fetch)
 	r.Get("/{username}/following", h.Following)
 	r.Get("/{username}/followers", h.Followers)
@@ -0,0 +1,401 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/httperror"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// Seconds each TOTP code is valid for, the default of authenticator apps
+	totpPeriod = 30
+
+	// Number of recovery codes given at once
+	recoveryCodes = 10
+
+	// Size of QR code images in pixels
+	qrCodeSize = 256
+)
+
+// Request body for "POST /v1/accounts/two_factor"
+type EnrollTwoFactorRequest struct {
+	Password string `validate:"required"`
+}
+
+// Response of "POST /v1/accounts/two_factor"
+type EnrollTwoFactorResponse struct {
+	// TOTP secret in base32, for authenticator apps without cameras
+	Secret string `json:"secret"`
+
+	// otpauth:// URI of the secret
+	OtpauthURI string `json:"otpauth_uri"`
+
+	// PNG image of the QR code of OtpauthURI, as a data URI
+	QRCode string `json:"qr_code"`
+}
+
+// Request body for "POST /v1/accounts/two_factor/confirm"
+type ConfirmTwoFactorRequest struct {
+	Code string `validate:"required"`
+}
+
+// Request body for "POST /v1/accounts/two_factor/disable" and "POST /v1/accounts/two_factor/recovery_codes"
+type TwoFactorRequest struct {
+	Password string `validate:"required"`
+
+	// TOTP code or recovery code
+	Code string `validate:"required"`
+}
+
+// Response with new recovery codes, shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Additional data of sealed secrets, binding them to the account
+func secretContext(id object.AccountID) []byte {
+	return []byte(strconv.FormatInt(id, 10))
+}
+
+// Time step of the TOTP code of secret matching code, allowing a step of clock skew
+func matchStep(secret string, code string, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	for _, skew := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		want, err := totp.GenerateCodeCustom(secret, t, opts)
+		if err == nil && subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// Whether code looks like a TOTP code rather than a recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Recovery code as stored, ignoring case and separators people may type differently
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
+
+// Generate recovery codes like "abcd-efgh-ijkl-mnop", returning them with their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("%w", err)
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+		hashes[i] = object.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+// Decrypt the TOTP secret of t
+func (h *handler) openSecret(t *object.TwoFactor) (string, error) {
+	if h.app.Secrets == nil {
+		return "", fmt.Errorf("two_factor.encryption_key is not configured to open TOTP secrets")
+	}
+	secret, err := h.app.Secrets.Open(t.Secret, secretContext(t.AccountID))
+	if err != nil {
+		return "", fmt.Errorf("open TOTP secret of account %d: %w", t.AccountID, err)
+	}
+	return string(secret), nil
+}
+
+// Check code against the second factor of t, a TOTP code or a recovery code.
+// The code is consumed, so it cannot be used again.
+func (h *handler) verifySecondFactor(ctx context.Context, repo repository.TwoFactor, t *object.TwoFactor, code string) (bool, error) {
+	if !isTOTPCode(code) {
+		return repo.UseRecoveryCode(ctx, t.AccountID, object.HashToken(normalizeRecoveryCode(code)))
+	}
+
+	secret, err := h.openSecret(t)
+	if err != nil {
+		return false, err
+	}
+	step, ok := matchStep(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return repo.UseStep(ctx, t.AccountID, step)
+}
+
+// Fetch the enabled second factor of the account, or respond not found
+func findEnabled(ctx context.Context, repo repository.TwoFactor, id object.AccountID) (*object.TwoFactor, error) {
+	t, err := repo.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if t == nil || !t.IsEnabled() {
+		return nil, errs.NotFound("two-factor authentication")
+	}
+	return t, nil
+}
+
+// Respond new recovery codes
+func respondRecoveryCodes(w http.ResponseWriter, r *http.Request, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	// 一度しか見せないので、キャッシュさせない
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(&RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
+
+// Handle request for "POST /v1/accounts/two_factor"
+func (h *handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login := auth.AccountOf(r)
+	if login == nil {
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
+	}
+	if h.app.Secrets == nil {
+		httperror.Respond(w, r, errs.Forbidden("two-factor authentication is not available"))
+		return
+	}
+
+	var req EnrollTwoFactorRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if !login.CheckPassword(req.Password) {
+		httperror.Respond(w, r, errs.Invalid("password", "incorrect", "password is incorrect"))
+		return
+	}
+	if login.TwoFactorEnabled {
+		httperror.Respond(w, r, errs.Conflict("two-factor authentication is already enabled"))
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      h.app.Config.TwoFactor.Issuer,
+		AccountName: login.Username,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		httperror.InternalServerError(w, r, err)
+		return
+	}
+	sealed, err := h.app.Secrets.Seal([]byte(key.Secret()), secretContext(login.ID))
+	if err != nil {
+		httperror.InternalServerError(w, r, err)
+		return
+	}
+
+	// 確認するまでは有効にしない
+	if err := h.app.Dao.TwoFactor().SavePending(ctx, object.TwoFactor{AccountID: login.ID, Secret: sealed}); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	img, err := key.Image(qrCodeSize, qrCodeSize)
+	if err != nil {
+		httperror.InternalServerError(w, r, err)
+		return
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		httperror.InternalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(&EnrollTwoFactorResponse{
+		Secret:     key.Secret(),
+		OtpauthURI: key.URL(),
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes()),
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
+
+// Handle request for "POST /v1/accounts/two_factor/confirm"
+func (h *handler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login := auth.AccountOf(r)
+	if login == nil {
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
+	}
+
+	var req ConfirmTwoFactorRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	var codes []string
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		t, err := tx.TwoFactor().Find(ctx, login.ID)
+		if err != nil {
+			return err
+		} else if t == nil {
+			return errs.NotFound("two-factor enrollment")
+		} else if t.IsEnabled() {
+			return errs.Conflict("two-factor authentication is already enabled")
+		}
+
+		// 確認に使ったコードではログインできないように、使用済みにする
+		secret, err := h.openSecret(t)
+		if err != nil {
+			return err
+		}
+		step, ok := matchStep(secret, req.Code, time.Now())
+		if ok {
+			ok, err = tx.TwoFactor().UseStep(ctx, login.ID, step)
+			if err != nil {
+				return err
+			}
+		}
+		if !ok {
+			return errs.Invalid("code", "incorrect", "code is incorrect")
+		}
+
+		if err := tx.TwoFactor().Enable(ctx, login.ID); err != nil {
+			return err
+		}
+		var hashes []string
+		codes, hashes, err = newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		return tx.TwoFactor().ReplaceRecoveryCodes(ctx, login.ID, hashes)
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	respondRecoveryCodes(w, r, codes)
+}
+
+// Handle request for "POST /v1/accounts/two_factor/disable"
+func (h *handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login := auth.AccountOf(r)
+	if login == nil {
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
+	}
+
+	var req TwoFactorRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if !login.CheckPassword(req.Password) {
+		httperror.Respond(w, r, errs.Invalid("password", "incorrect", "password is incorrect"))
+		return
+	}
+
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		t, err := findEnabled(ctx, tx.TwoFactor(), login.ID)
+		if err != nil {
+			return err
+		}
+		if ok, err := h.verifySecondFactor(ctx, tx.TwoFactor(), t, req.Code); err != nil {
+			return err
+		} else if !ok {
+			return errs.Invalid("code", "incorrect", "code is incorrect")
+		}
+		return tx.TwoFactor().Delete(ctx, login.ID)
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&struct{}{}); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+}
+
+// Handle request for "POST /v1/accounts/two_factor/recovery_codes"
+func (h *handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login := auth.AccountOf(r)
+	if login == nil {
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
+	}
+
+	var req TwoFactorRequest
+	if err := decode(r, &req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if !login.CheckPassword(req.Password) {
+		httperror.Respond(w, r, errs.Invalid("password", "incorrect", "password is incorrect"))
+		return
+	}
+
+	// 古いコードはすべて使えなくなる
+	var codes []string
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		t, err := findEnabled(ctx, tx.TwoFactor(), login.ID)
+		if err != nil {
+			return err
+		}
+		if ok, err := h.verifySecondFactor(ctx, tx.TwoFactor(), t, req.Code); err != nil {
+			return err
+		} else if !ok {
+			return errs.Invalid("code", "incorrect", "code is incorrect")
+		}
+
+		var hashes []string
+		codes, hashes, err = newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		return tx.TwoFactor().ReplaceRecoveryCodes(ctx, login.ID, hashes)
+	})
+	if err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	respondRecoveryCodes(w, r, codes)
+}
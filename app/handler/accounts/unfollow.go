@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/logger"
 
 	"github.com/go-chi/chi"
 )
@@ -17,18 +19,18 @@ func (h *handler) Unfollow(w http.ResponseWriter, r *http.Request) {
 
 	login := auth.AccountOf(r)
 	if login == nil {
-		httperror.InternalServerError(w, fmt.Errorf("lost account"))
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
 		return
 	}
 
 	targetName := chi.URLParam(r, "username")
 	target, err := h.app.Dao.Account().FindByUsername(ctx, targetName)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 	if target == nil {
-		httperror.Error(w, http.StatusNotFound)
+		httperror.Respond(w, r, errs.NotFound("account"))
 		return
 	}
 
@@ -36,25 +38,30 @@ func (h *handler) Unfollow(w http.ResponseWriter, r *http.Request) {
 		ID: target.ID,
 	}
 	if err = h.app.Dao.Relation().Unfollow(ctx, login.ID, target.ID); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
+	// フォロー関係が変わったのでホームフィードを作り直す
+	if err := h.app.HomeFeed.Rebuild(ctx, login.ID); err != nil {
+		logger.FromContext(ctx).Warn("rebuild home feed", "account_id", login.ID, "error", err)
+	}
+
 	relation.Following, err = h.app.Dao.Relation().IsFollowing(ctx, login.ID, target.ID)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
 	relation.FollowedBy, err = h.app.Dao.Relation().IsFollowing(ctx, target.ID, login.ID)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(relation); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
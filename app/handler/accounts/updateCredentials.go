@@ -1,22 +1,23 @@
 package accounts
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
 	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
 	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/files"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/validate"
+	"yatter-backend-go/app/logger"
 )
 
 // mediaをサーバーにアップロードしてそのパスのポインタを返す
-func uploadMedia(r *http.Request, key string) (*string, error) {
+func uploadMedia(r *http.Request, key string, repo repository.MediaBlob) (*string, error) {
 	// リクエストからファイルを取得
-	src, fileHeader, err := r.FormFile(key)
+	src, _, err := r.FormFile(key)
 	if err != nil {
 		return nil, err
 	}
@@ -24,28 +25,12 @@ func uploadMedia(r *http.Request, key string) (*string, error) {
 	defer func() {
 		err := src.Close()
 		if err != nil {
-			log.Println("Close:", err)
+			logger.FromContext(r.Context()).Warn("close uploaded file", "error", err)
 		}
 	}()
 
-	err = files.MightCreateAttachmentDir()
-	if err != nil {
-		return nil, err
-	}
-
-	url := files.CreateURL(fileHeader.Filename)
-	dest, err := os.Create(url)
-	if err != nil {
-		return nil, fmt.Errorf("create: %w", err)
-	}
-	defer func() {
-		err := dest.Close()
-		if err != nil {
-			log.Println("Close:", err)
-		}
-	}()
-
-	_, err = io.Copy(dest, src)
+	// attachmentと同じ内容でも、回収されないように参照を持つ
+	_, url, err := files.Store(r.Context(), repo, src)
 	if err != nil {
 		return nil, err
 	}
@@ -53,45 +38,59 @@ func uploadMedia(r *http.Request, key string) (*string, error) {
 	return &url, nil
 }
 
+// Form values for "POST /v1/accounts/update_credentials"
+type credentialsRequest struct {
+	DisplayName string `json:"display_name" validate:"max=30"`
+	Note        string `validate:"max=500"`
+}
+
 // リクエストから更新内容を取得してオブジェクトを更新
-func updateObject(r *http.Request, a *object.Account) error {
+func updateObject(r *http.Request, a *object.Account, repo repository.MediaBlob) error {
 	new := &object.Account{
 		Username:     a.Username,
 		PasswordHash: a.PasswordHash,
 	}
-	displayName := r.FormValue("display_name")
-	if displayName != "" {
-		new.DisplayName = &displayName
+	req := credentialsRequest{
+		DisplayName: r.FormValue("display_name"),
+		Note:        r.FormValue("note"),
 	}
-	note := r.FormValue("note")
-	if note != "" {
-		new.Note = &note
+	if err := validate.Struct(&req); err != nil {
+		return err
 	}
-
-	const maxMemory = 32 << 20
-	err := r.ParseMultipartForm(maxMemory)
-	if err != nil {
-		return fmt.Errorf("ParseMultipartForm: %w", err)
+	if req.DisplayName != "" {
+		new.DisplayName = &req.DisplayName
+	}
+	if req.Note != "" {
+		new.Note = &req.Note
 	}
 
+	var err error
 	for k := range r.MultipartForm.File {
 		if k == "avatar" {
-			new.Avatar, err = uploadMedia(r, k)
-			if err != nil {
-				return err
-			}
+			new.Avatar, err = uploadMedia(r, k, repo)
 		}
 		if k == "header" {
-			new.Header, err = uploadMedia(r, k)
-			if err != nil {
-				return err
-			}
+			new.Header, err = uploadMedia(r, k, repo)
+		}
+		if err != nil {
+			// 先にアップロードした方の参照を戻す
+			releaseMedia(r.Context(), repo, new)
+			return err
 		}
 	}
 	*a = *new
 	return nil
 }
 
+// アイコンとヘッダーのmedia blobの参照を外す
+func releaseMedia(ctx context.Context, repo repository.MediaBlob, a *object.Account) {
+	for _, url := range []*string{a.Avatar, a.Header} {
+		if url != nil {
+			files.Release(ctx, repo, *url)
+		}
+	}
+}
+
 // Handle request for "POST /v1/update_credentials"
 func (h *handler) UpdateCredentials(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -99,27 +98,39 @@ func (h *handler) UpdateCredentials(w http.ResponseWriter, r *http.Request) {
 	// ログインユーザーを取得
 	login := auth.AccountOf(r)
 	if login == nil {
-		httperror.InternalServerError(w, fmt.Errorf("lost account"))
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
 	}
 
 	// 入力内容を取得
-	if err := updateObject(r, login); err != nil {
-		httperror.InternalServerError(w, err)
+	if err := files.ParseMultipartForm(w, r, h.app.Config.Media.MaxUploadBytes); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+	if err := updateObject(r, login, h.app.Dao.MediaBlob()); err != nil {
+		httperror.Respond(w, r, err)
 		return
 	}
 
 	// データベースの内容を更新
-	err := h.app.Dao.Account().Update(ctx, *login)
+	replaced, err := h.app.Dao.Account().Update(ctx, *login)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		releaseMedia(ctx, h.app.Dao.MediaBlob(), login)
+		httperror.Respond(w, r, err)
 		return
 	}
+	// 置き換えたり外したりした前のアイコンとヘッダーの参照を外す
+	// 同時に更新しても、それぞれが実際に置き換えた分だけになる
+	for _, url := range replaced {
+		files.Release(ctx, h.app.Dao.MediaBlob(), url)
+	}
 
-	account, err := h.app.Dao.Account().FindByUsername(ctx, login.Username)
+	// 更新直後なのでプライマリから読む
+	account, err := h.app.Dao.Primary().Account().FindByUsername(ctx, login.Username)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(account); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -4,51 +4,107 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/accesslog"
 	"yatter-backend-go/app/handler/httperror"
 )
 
-var contextKey = new(struct{})
+// Key of context values, a distinct type as pointers to zero-sized values may be equal
+type contextKey struct{}
 
-// Auth by header
+// Key of the access token in context values
+type tokenKey struct{}
+
+// Auth by header "Authentication: Bearer <access token>" issued by logging in
 func Middleware(app *app.App) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-
-			// ヘッダーから Username を取り出すだけの超安易な認証
-			a := r.Header.Get("Authentication")
-			pair := strings.SplitN(a, " ", 2)
-			if len(pair) < 2 {
-				httperror.Error(w, http.StatusUnauthorized)
+			// Optionalで認証済みなら確かめ直さない
+			if AccountOf(r) != nil {
+				next.ServeHTTP(w, r)
 				return
 			}
-
-			authType := pair[0]
-			if !strings.EqualFold(authType, "username") {
-				httperror.Error(w, http.StatusUnauthorized)
+			ctx, err := authenticate(r, app)
+			if err != nil {
+				httperror.Respond(w, r, err)
 				return
 			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-			username := pair[1]
-			if account, err := app.Dao.Account().FindByUsername(ctx, username); err != nil {
-				httperror.InternalServerError(w, err)
+// Auth like Middleware if the request has the header, but pass requests without valid credentials as they are.
+// Routes requiring an account still need Middleware, which rejects them.
+func Optional(app *app.App) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authentication") == "" {
+				next.ServeHTTP(w, r)
 				return
-			} else if account == nil {
-				httperror.Error(w, http.StatusUnauthorized)
+			}
+			ctx, err := authenticate(r, app)
+			if err != nil {
+				next.ServeHTTP(w, r)
 				return
-			} else {
-				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey, account)))
 			}
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// Authenticate the request by its header, returning the context with its account
+func authenticate(r *http.Request, app *app.App) (context.Context, error) {
+	ctx := r.Context()
+
+	a := r.Header.Get("Authentication")
+	pair := strings.SplitN(a, " ", 2)
+	if len(pair) < 2 {
+		return nil, errs.Unauthorized("Authentication header is required")
+	}
+
+	if !strings.EqualFold(pair[0], "bearer") {
+		return nil, errs.Unauthorized("unsupported authentication type")
+	}
+	token := pair[1]
+	account, err := findByToken(ctx, app, token)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, tokenKey{}, token)
+
+	if account == nil || account.IsDeleted() {
+		return nil, errs.Unauthorized("unknown account")
+	} else if !account.IsConfirmed() {
+		return nil, errs.Forbidden("account is pending confirmation")
+	}
+	return NewContext(ctx, account), nil
+}
+
+// Create context carrying account as the authenticated one
+func NewContext(ctx context.Context, account *object.Account) context.Context {
+	ctx = accesslog.SetAccountID(ctx, account.ID)
+	return context.WithValue(ctx, contextKey{}, account)
+}
+
+// Fetch the account of a valid access token
+func findByToken(ctx context.Context, app *app.App, token string) (*object.Account, error) {
+	t, err := app.Dao.Confirmation().FindValid(ctx, object.PurposeAccess, object.HashToken(token), time.Now())
+	if err != nil {
+		return nil, err
+	} else if t == nil {
+		return nil, errs.Unauthorized("access token is invalid or expired")
+	}
+	return app.Dao.Account().FindByID(ctx, t.AccountID)
+}
+
 // Read Account data from authorized request
 func AccountOf(r *http.Request) *object.Account {
-	if cv := r.Context().Value(contextKey); cv == nil {
+	if cv := r.Context().Value(contextKey{}); cv == nil {
 		return nil
 
 	} else if account, ok := cv.(*object.Account); !ok {
@@ -59,3 +115,9 @@ func AccountOf(r *http.Request) *object.Account {
 
 	}
 }
+
+// Read the access token of authorized request, empty if it was not authorized
+func AccessTokenOf(r *http.Request) string {
+	token, _ := r.Context().Value(tokenKey{}).(string)
+	return token
+}
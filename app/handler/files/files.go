@@ -1,15 +1,37 @@
 package files
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
-	"path/filepath"
-	"time"
+	"strings"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/logger"
 )
 
 const attachmentDir = "attachments/"
 
-func CreateURL(filename string) string {
-	return attachmentDir + time.Now().Format(time.RFC3339Nano) + filepath.Ext(filename)
+// multipart formのうちメモリに置く大きさ、超えた分は一時ファイルになる
+const maxMemory = 32 << 20
+
+// 内容のハッシュからURLを作成
+func URLOf(hash string) string {
+	return attachmentDir + hash
+}
+
+// URLOfで作ったURLから内容のハッシュを取り出す
+func HashOf(url string) (string, bool) {
+	if !strings.HasPrefix(url, attachmentDir) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, attachmentDir), true
 }
 
 // attachmentsディレクトリがなかったら作成
@@ -23,3 +45,126 @@ func MightCreateAttachmentDir() error {
 
 	return nil
 }
+
+// srcを内容のSHA-256をキーとして保存し、media blobの参照を取ってそのblobとURLを返す
+// 同じ内容のファイルが既にあれば同じURLになる
+func Store(ctx context.Context, repo repository.MediaBlob, src io.Reader) (*object.MediaBlob, string, error) {
+	if err := MightCreateAttachmentDir(); err != nil {
+		return nil, "", err
+	}
+
+	// 一時ファイルに書き出しながらハッシュを計算する
+	tmp, err := os.CreateTemp(attachmentDir, ".upload-*")
+	if err != nil {
+		return nil, "", fmt.Errorf("create: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	blob := &object.MediaBlob{
+		Hash: hex.EncodeToString(h.Sum(nil)),
+		Size: size,
+	}
+	// ファイルを置く前に参照を取る
+	// 同じ内容を回収中なら、Acquireはファイルの削除が終わるまで待たされる
+	if err := repo.Acquire(ctx, *blob); err != nil {
+		return nil, "", err
+	}
+
+	// 同じ内容なので既にあっても置き換えて構わない
+	url := URLOf(blob.Hash)
+	if err := os.Rename(tmp.Name(), url); err != nil {
+		Release(ctx, repo, url)
+		return nil, "", fmt.Errorf("rename: %w", err)
+	}
+	return blob, url, nil
+}
+
+// URLOfで作ったURLのmedia blobの参照を外し、最後の参照ならファイルも消す
+// 失敗は出力だけして、ファイルは残ったままにする
+func Release(ctx context.Context, repo repository.MediaBlob, url string) {
+	hash, ok := HashOf(url)
+	if !ok {
+		return
+	}
+	_, err := repo.Release(ctx, hash, func() error { return Remove(url) })
+	if err != nil {
+		logger.FromContext(ctx).Warn("release media blob", "hash", hash, "error", err)
+	}
+}
+
+// リクエストボディをlimitバイトまでに制限してmultipart formとして読み込む
+func ParseMultipartForm(w http.ResponseWriter, r *http.Request, limit int64) error {
+	r.Body = &limitedBody{ReadCloser: r.Body, remaining: limit}
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			// 残りのボディを読まずに済むよう接続を閉じる
+			w.Header().Set("Connection", "close")
+			return errs.PayloadTooLarge("request body must be at most %d bytes", limit)
+		}
+		return errs.BadRequest("request body is not valid multipart form data")
+	}
+	return nil
+}
+
+// http.MaxBytesReaderのエラーには型がないので、判別できるエラーを返すリーダーを使う
+var errBodyTooLarge = errors.New("request body too large")
+
+// remainingバイトを超えて読むとerrBodyTooLargeを返すボディ
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	// 上限を超えたか分かるよう1バイト余分に読む
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		b.err = err
+		return n, err
+	}
+	n = int(b.remaining)
+	b.remaining = 0
+	b.err = errBodyTooLarge
+	return n, b.err
+}
+
+// URLで指定したファイルを削除 (既に無い場合は何もしない)
+func Remove(url string) error {
+	if err := os.Remove(url); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// attachmentsディレクトリにファイルを作成できるか確かめる
+func CheckWritable() error {
+	if err := MightCreateAttachmentDir(); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(attachmentDir, ".health-*")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return nil
+}
@@ -1,24 +1,40 @@
 package handler_test_setup
 
 import (
+	"bytes"
 	"context"
 	"net/http/httptest"
 	"net/url"
 	"path"
+	"sync"
+	"time"
 	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/bucket"
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/dao"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/feed"
 	"yatter-backend-go/app/handler"
+	"yatter-backend-go/app/mailer"
+	"yatter-backend-go/app/secret"
 )
 
 type (
 	C struct {
 		App    *app.App
 		Server *httptest.Server
+		mailer *mockmailer
+		dao    *mockdao
 	}
 
 	mockdao struct {
 		accounts map[string]*object.Account
+		tokens   map[string]object.ConfirmationToken
+
+		// TOTP secrets and hashes of recovery codes by account
+		twoFactors    map[object.AccountID]*object.TwoFactor
+		recoveryCodes map[object.AccountID]map[string]bool
 	}
 
 	mockaccount struct {
@@ -36,6 +52,23 @@ type (
 	mockattachment struct {
 		m *mockdao
 	}
+
+	mockmediablob struct {
+		m *mockdao
+	}
+
+	mockconfirmation struct {
+		m *mockdao
+	}
+
+	mocktwofactor struct {
+		m *mockdao
+	}
+
+	mockmailer struct {
+		mu   sync.Mutex
+		sent []mailer.Message
+	}
 )
 
 const CreateUser = "smith"
@@ -44,9 +77,19 @@ const Content = "hello world"
 
 const ID1 = 1
 const ExistingUsername1 = "john"
+const Password = "passw0rd"
 const ID2 = 2
 const ExistingUsername2 = "sum"
 
+// Hash of Password set to the existing accounts, computed once as bcrypt is slow
+var passwordHash = func() object.PasswordHash {
+	var a object.Account
+	if err := a.SetPassword(Password); err != nil {
+		panic(err)
+	}
+	return a.PasswordHash
+}()
+
 func (m *mockdao) Account() repository.Account {
 	return &mockaccount{m: m}
 }
@@ -63,19 +106,52 @@ func (m *mockdao) Attachment() repository.Attachment {
 	return &mockattachment{m: m}
 }
 
+func (m *mockdao) MediaBlob() repository.MediaBlob {
+	return &mockmediablob{m: m}
+}
+
+func (m *mockdao) Confirmation() repository.Confirmation {
+	return &mockconfirmation{m: m}
+}
+
+func (m *mockdao) TwoFactor() repository.TwoFactor {
+	return &mocktwofactor{m: m}
+}
+
+func (m *mockdao) Primary() dao.Dao {
+	return m
+}
+
+func (m *mockdao) WithTx(ctx context.Context, f func(dao.Dao) error) error {
+	return f(m)
+}
+
 func (m *mockdao) InitAll() error {
 	return nil
 }
 
+func (m *mockdao) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockdao) Close() error {
+	return nil
+}
+
 func (m *mockaccount) Insert(ctx context.Context, a object.Account) (object.AccountID, error) {
+	id := object.AccountID(len(m.m.accounts) + 1)
 	m.m.accounts[a.Username] = &object.Account{
-		Username: a.Username,
+		ID:           id,
+		Username:     a.Username,
+		PasswordHash: a.PasswordHash,
+		Email:        a.Email,
+		State:        a.State,
 	}
-	return 0, nil
+	return id, nil
 }
 
-func (m *mockaccount) Update(ctx context.Context, a object.Account) error {
-	return nil
+func (m *mockaccount) Update(ctx context.Context, a object.Account) ([]string, error) {
+	return nil, nil
 }
 
 func (m *mockaccount) FindByUsername(ctx context.Context, username string) (*object.Account, error) {
@@ -85,6 +161,76 @@ func (m *mockaccount) FindByUsername(ctx context.Context, username string) (*obj
 	return nil, nil
 }
 
+func (m *mockaccount) FindByID(ctx context.Context, id object.AccountID) (*object.Account, error) {
+	for _, a := range m.m.accounts {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockaccount) FindByEmail(ctx context.Context, email string) (*object.Account, error) {
+	for _, a := range m.m.accounts {
+		if a.Email != nil && *a.Email == email {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockaccount) ConfirmEmail(ctx context.Context, id object.AccountID, approvalRequired bool) error {
+	for _, a := range m.m.accounts {
+		if a.ID == id {
+			now := object.DateTime{Time: time.Now()}
+			a.EmailConfirmedAt = &now
+			if !approvalRequired {
+				a.State = object.AccountConfirmed
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockaccount) Approve(ctx context.Context, id object.AccountID) error {
+	for _, a := range m.m.accounts {
+		if a.ID == id && a.EmailConfirmedAt != nil {
+			a.State = object.AccountConfirmed
+		}
+	}
+	return nil
+}
+
+func (m *mockaccount) UpdatePassword(ctx context.Context, id object.AccountID, hash object.PasswordHash) error {
+	for _, a := range m.m.accounts {
+		if a.ID == id {
+			a.PasswordHash = hash
+		}
+	}
+	return nil
+}
+
+func (m *mockaccount) MarkDeleted(ctx context.Context, id object.AccountID) error {
+	for _, a := range m.m.accounts {
+		if a.ID == id {
+			a.State = object.AccountDeleted
+		}
+	}
+	return nil
+}
+
+func (m *mockaccount) UnsetImage(ctx context.Context, id object.AccountID, url string) (int, error) {
+	return 0, nil
+}
+
+func (m *mockaccount) FindDeleted(ctx context.Context, limit int) ([]object.Account, error) {
+	return nil, nil
+}
+
+func (m *mockaccount) Purge(ctx context.Context, id object.AccountID) error {
+	return nil
+}
+
 func (m *mockstatus) Insert(ctx context.Context, status object.Status, mediaIDs []object.AttachmentID) (object.StatusID, error) {
 	return 1, nil
 }
@@ -115,6 +261,37 @@ func (m *mockstatus) HomeTimeline(ctx context.Context, loginID object.AccountID,
 	}, nil
 }
 
+func (m *mockaccount) FindAccountsByIDs(ctx context.Context, ids []object.AccountID) (map[object.AccountID]*object.Account, error) {
+	found := make(map[object.AccountID]*object.Account)
+	for _, id := range ids {
+		for _, a := range m.m.accounts {
+			if a.ID == id {
+				found[id] = a
+			}
+		}
+	}
+	return found, nil
+}
+
+func (m *mockaccount) RecountStats(ctx context.Context) (int64, error) {
+	return int64(len(m.m.accounts)), nil
+}
+
+func (m *mockstatus) FindByIDs(ctx context.Context, ids []object.StatusID) (object.Timelines, error) {
+	var statuses object.Timelines
+	for _, id := range ids {
+		s, _ := m.FindByID(ctx, id)
+		if s != nil {
+			statuses = append(statuses, *s)
+		}
+	}
+	return statuses, nil
+}
+
+func (m *mockstatus) HomeStatusIDs(ctx context.Context, loginID object.AccountID, limit int) ([]object.StatusID, error) {
+	return []object.StatusID{1}, nil
+}
+
 func (m *mockrelation) Follow(ctx context.Context, loginID object.AccountID, targetID object.AccountID) error {
 	return nil
 }
@@ -126,16 +303,23 @@ func (m *mockrelation) IsFollowing(ctx context.Context, accountID object.Account
 	return false, nil
 }
 
-func (m *mockrelation) Following(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Account, error) {
+func (m *mockrelation) Following(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Follow, error) {
 	if id == ID1 {
-		return []object.Account{*m.m.accounts[ExistingUsername2]}, nil
+		return []object.Follow{{ID: 1, Account: *m.m.accounts[ExistingUsername2]}}, nil
 	}
 	return nil, nil
 }
 
-func (m *mockrelation) Followers(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Account, error) {
+func (m *mockrelation) Followers(ctx context.Context, id object.AccountID, p object.Parameters) ([]object.Follow, error) {
 	if id == ID2 {
-		return []object.Account{*m.m.accounts[ExistingUsername1]}, nil
+		return []object.Follow{{ID: 1, Account: *m.m.accounts[ExistingUsername1]}}, nil
+	}
+	return nil, nil
+}
+
+func (m *mockrelation) FollowerIDs(ctx context.Context, id object.AccountID) ([]object.AccountID, error) {
+	if id == ID2 {
+		return []object.AccountID{ID1}, nil
 	}
 	return nil, nil
 }
@@ -152,32 +336,196 @@ func (m *mockattachment) FindByStatusID(ctx context.Context, id object.StatusID)
 	return nil, nil
 }
 
-func (m *mockattachment) HasAttachmentIDs(ctx context.Context, id []object.AttachmentID) (bool, error) {
+func (m *mockattachment) FindByStatusIDs(ctx context.Context, ids []object.StatusID) (map[object.StatusID][]object.Attachment, error) {
+	return map[object.StatusID][]object.Attachment{}, nil
+}
+
+func (m *mockattachment) IsAttachable(ctx context.Context, accountID object.AccountID, id []object.AttachmentID) (bool, error) {
+	return true, nil
+}
+
+func (m *mockattachment) FindByAccountID(ctx context.Context, id object.AccountID) ([]object.Attachment, error) {
+	return nil, nil
+}
+
+func (m *mockattachment) FindOrphans(ctx context.Context, before time.Time, after object.AttachmentID, limit int) ([]object.Attachment, error) {
+	return nil, nil
+}
+
+func (m *mockattachment) DeleteOrphan(ctx context.Context, id object.AttachmentID, before time.Time) (bool, error) {
+	return true, nil
+}
+
+func (m *mockattachment) Delete(ctx context.Context, id object.AttachmentID) (bool, error) {
 	return true, nil
 }
 
+func (m *mockmediablob) Acquire(ctx context.Context, blob object.MediaBlob) error {
+	return nil
+}
+
+func (m *mockmediablob) Release(ctx context.Context, hash string, remove func() error) (bool, error) {
+	return true, nil
+}
+
+func (m *mockconfirmation) Insert(ctx context.Context, token object.ConfirmationToken) error {
+	m.m.tokens[token.Hash] = token
+	return nil
+}
+
+func (m *mockconfirmation) FindValid(ctx context.Context, purpose object.TokenPurpose, hash string, now time.Time) (*object.ConfirmationToken, error) {
+	if t, ok := m.m.tokens[hash]; ok && t.Purpose == purpose && t.ExpiresAt.After(now) {
+		return &t, nil
+	}
+	return nil, nil
+}
+
+func (m *mockconfirmation) Delete(ctx context.Context, hash string) error {
+	delete(m.m.tokens, hash)
+	return nil
+}
+
+func (m *mockconfirmation) DeleteByAccountID(ctx context.Context, purpose object.TokenPurpose, id object.AccountID) error {
+	for hash, t := range m.m.tokens {
+		if t.AccountID == id && t.Purpose == purpose {
+			delete(m.m.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (m *mocktwofactor) Find(ctx context.Context, id object.AccountID) (*object.TwoFactor, error) {
+	if t, ok := m.m.twoFactors[id]; ok {
+		copied := *t
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (m *mocktwofactor) SavePending(ctx context.Context, t object.TwoFactor) error {
+	if old, ok := m.m.twoFactors[t.AccountID]; !ok || !old.IsEnabled() {
+		m.m.twoFactors[t.AccountID] = &t
+	}
+	return nil
+}
+
+// 有効にしたらアカウントからも分かるようにする
+func (m *mocktwofactor) setEnabled(id object.AccountID, enabled bool) {
+	for _, a := range m.m.accounts {
+		if a.ID == id {
+			a.TwoFactorEnabled = enabled
+		}
+	}
+}
+
+func (m *mocktwofactor) Enable(ctx context.Context, id object.AccountID) error {
+	if t, ok := m.m.twoFactors[id]; ok {
+		now := object.DateTime{Time: time.Now()}
+		t.EnabledAt = &now
+		m.setEnabled(id, true)
+	}
+	return nil
+}
+
+func (m *mocktwofactor) UseStep(ctx context.Context, id object.AccountID, step int64) (bool, error) {
+	if t, ok := m.m.twoFactors[id]; ok && t.LastUsedStep < step {
+		t.LastUsedStep = step
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *mocktwofactor) ReplaceRecoveryCodes(ctx context.Context, id object.AccountID, hashes []string) error {
+	codes := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		codes[hash] = true
+	}
+	m.m.recoveryCodes[id] = codes
+	return nil
+}
+
+func (m *mocktwofactor) UseRecoveryCode(ctx context.Context, id object.AccountID, hash string) (bool, error) {
+	if m.m.recoveryCodes[id][hash] {
+		delete(m.m.recoveryCodes[id], hash)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *mocktwofactor) Delete(ctx context.Context, id object.AccountID) error {
+	delete(m.m.twoFactors, id)
+	delete(m.m.recoveryCodes, id)
+	m.setEnabled(id, false)
+	return nil
+}
+
+func (m *mockmailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
 func MockSetup() *C {
 	a1 := &object.Account{
-		ID:       1,
-		Username: ExistingUsername1,
+		ID:           1,
+		Username:     ExistingUsername1,
+		PasswordHash: passwordHash,
+		State:        object.AccountConfirmed,
 	}
 	a2 := &object.Account{
-		ID:       2,
-		Username: ExistingUsername2,
+		ID:           2,
+		Username:     ExistingUsername2,
+		PasswordHash: passwordHash,
+		State:        object.AccountConfirmed,
 	}
 
-	app := &app.App{Dao: &mockdao{accounts: map[string]*object.Account{
+	d := &mockdao{accounts: map[string]*object.Account{
 		a1.Username: a1,
 		a2.Username: a2,
-	}}}
+	},
+		tokens:        map[string]object.ConfirmationToken{},
+		twoFactors:    map[object.AccountID]*object.TwoFactor{},
+		recoveryCodes: map[object.AccountID]map[string]bool{},
+	}
+	m := &mockmailer{}
+	secrets, err := secret.New(bytes.Repeat([]byte{1}, secret.KeySize))
+	if err != nil {
+		panic(err)
+	}
+	app := &app.App{Config: config.Default(), Dao: d, HomeFeed: feed.NewHome(d, feed.NewMemory(10), 10), RateLimits: bucket.NewMemory(), Mailer: m, Secrets: secrets}
 	server := httptest.NewServer(handler.NewRouter(app))
 
 	return &C{
 		App:    app,
 		Server: server,
+		mailer: m,
+		dao:    d,
 	}
 }
 
+// Authentication header with an access token of the account, as issued by logging in.
+// The token of an unknown username is invalid.
+func (c *C) Bearer(username string) string {
+	token := "token-" + username
+	if a, ok := c.dao.accounts[username]; ok {
+		c.dao.tokens[object.HashToken(token)] = object.ConfirmationToken{
+			Hash:      object.HashToken(token),
+			Purpose:   object.PurposeAccess,
+			AccountID: a.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+	return "Bearer " + token
+}
+
+// Emails sent so far
+func (c *C) Mails() []mailer.Message {
+	c.mailer.mu.Lock()
+	defer c.mailer.mu.Unlock()
+	return append([]mailer.Message(nil), c.mailer.sent...)
+}
+
 func (c *C) Close() {
 	c.Server.Close()
 }
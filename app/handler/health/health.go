@@ -1,16 +1,146 @@
 package health
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"sync"
+	"time"
+	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/handler/files"
+	"yatter-backend-go/app/logger"
+
+	"github.com/go-chi/chi"
+)
+
+// Maximum time of each check
+const checkTimeout = 2 * time.Second
+
+type (
+	// Implementation of handler
+	handler struct {
+		app *app.App
+	}
+
+	// Dependency checked for readiness
+	check struct {
+		name string
+
+		// The server can't serve without it
+		critical bool
+
+		ping func(ctx context.Context) error
+	}
+
+	// Response body of health checks
+	Report struct {
+		// "ok", or "fail" if any critical check fails
+		Status string `json:"status"`
+
+		// Result of each check by name
+		Checks map[string]Result `json:"checks,omitempty"`
+	}
+
+	// Result of a check
+	Result struct {
+		// "ok" or "fail"
+		Status string `json:"status"`
+
+		Critical bool `json:"critical"`
+
+		LatencyMs float64 `json:"latency_ms"`
+	}
+)
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
 )
 
-// Handle health check request
-func NewRouter() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		_, err := w.Write([]byte("OK"))
-		if err != nil {
-			panic(err)
-		}
+// Create handler for health checks
+func NewRouter(app *app.App) http.Handler {
+	r := chi.NewRouter()
+
+	h := &handler{app: app}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		r.MethodFunc(method, "/", h.Live)
+		r.MethodFunc(method, "/live", h.Live)
+		r.MethodFunc(method, "/ready", h.Ready)
+	}
+
+	return r
+}
+
+// Handle request for "GET /v1/health/live".
+// The process is alive as long as it responds.
+func (h *handler) Live(w http.ResponseWriter, r *http.Request) {
+	write(w, r, http.StatusOK, Report{Status: statusOK})
+}
+
+// Handle request for "GET /v1/health/ready".
+// Responds with Service Unavailable (503) if any critical dependency fails.
+func (h *handler) Ready(w http.ResponseWriter, r *http.Request) {
+	checks := []check{
+		{name: "database", critical: true, ping: h.app.Dao.Ping},
+		{name: "media_storage", critical: true, ping: func(context.Context) error { return files.CheckWritable() }},
+	}
+	// タイムラインはデータベースから読めるので、フィードのキャッシュは必須ではない
+	if h.app.HomeFeed != nil {
+		checks = append(checks, check{name: "home_feed", ping: h.app.HomeFeed.Ping})
+	}
+
+	report := Report{Status: statusOK, Checks: make(map[string]Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+			result := run(r.Context(), c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if c.critical && result.Status == statusFail {
+				report.Status = statusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if report.Status == statusFail {
+		status = http.StatusServiceUnavailable
+	}
+	write(w, r, status, report)
+}
+
+// Run check within checkTimeout, logging the cause of failure
+func run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.ping(ctx)
+	result := Result{
+		Status:    statusOK,
+		Critical:  c.critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		// 原因は内部の情報なのでログにだけ出す
+		logger.FromContext(ctx).Warn("health check failed", "check", c.name, "error", err)
+		result.Status = statusFail
+	}
+	return result
+}
+
+func write(w http.ResponseWriter, r *http.Request, status int, report Report) {
+	// 監視の結果は常に最新を返す
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.FromContext(r.Context()).Error("write health report", "error", err)
 	}
 }
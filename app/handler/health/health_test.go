@@ -0,0 +1,106 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/handler/handler_test_setup"
+	"yatter-backend-go/app/handler/health"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// データベースにつながらないDAO
+type brokenDao struct {
+	dao.Dao
+}
+
+func (brokenDao) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealth(t *testing.T) {
+	// attachmentsディレクトリを一時ディレクトリに作る
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		name             string
+		path             string
+		broken           bool
+		expectStatusCode int
+		expectStatus     string
+		expectChecks     map[string]string
+	}{
+		{
+			name:             "Live",
+			path:             "/v1/health/live",
+			expectStatusCode: http.StatusOK,
+			expectStatus:     "ok",
+		},
+		{
+			name:             "LiveWithBrokenDatabase",
+			path:             "/v1/health/live",
+			broken:           true,
+			expectStatusCode: http.StatusOK,
+			expectStatus:     "ok",
+		},
+		{
+			name:             "Ready",
+			path:             "/v1/health/ready",
+			expectStatusCode: http.StatusOK,
+			expectStatus:     "ok",
+			expectChecks:     map[string]string{"database": "ok", "media_storage": "ok", "home_feed": "ok"},
+		},
+		{
+			name:             "ReadyWithBrokenDatabase",
+			path:             "/v1/health/ready",
+			broken:           true,
+			expectStatusCode: http.StatusServiceUnavailable,
+			expectStatus:     "fail",
+			expectChecks:     map[string]string{"database": "fail", "media_storage": "ok", "home_feed": "ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := handler_test_setup.MockSetup()
+			defer c.Close()
+			if tt.broken {
+				c.App.Dao = brokenDao{c.App.Dao}
+			}
+
+			resp, err := c.Server.Client().Get(c.AsURL(tt.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, tt.expectStatusCode, resp.StatusCode)
+
+			var report health.Report
+			if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.expectStatus, report.Status)
+			checks := make(map[string]string)
+			for name, result := range report.Checks {
+				checks[name] = result.Status
+			}
+			if tt.expectChecks == nil {
+				assert.Empty(t, checks)
+			} else {
+				assert.Equal(t, tt.expectChecks, checks)
+			}
+		})
+	}
+}
@@ -1,23 +1,105 @@
 package httperror
 
 import (
-	"log"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/logger"
+
+	"github.com/go-chi/chi/middleware"
 )
 
-// Response with given status code
-func Error(w http.ResponseWriter, code int) {
-	http.Error(w, http.StatusText(code), code)
+// Body of error responses
+type Body struct {
+	// Short summary of the error, the status text of the response
+	Error string `json:"error"`
+
+	// Human-readable description of the error
+	Description string `json:"error_description,omitempty"`
+
+	// Machine-readable code of the error, like "not_found"
+	Code string `json:"code"`
+
+	// Invalid fields of the request, for code "validation_failed"
+	Fields []errs.FieldError `json:"fields,omitempty"`
+
+	// ID of the request, also found in logs
+	RequestID string `json:"request_id,omitempty"`
 }
 
-// Response with Bad Request (400)
-func BadRequest(w http.ResponseWriter, err error) {
-	http.Error(w, err.Error(), http.StatusBadRequest)
+// Respond with err, mapping errors of package errs to their status codes.
+// Other errors are logged and hidden from the client as Internal Server Error (500).
+func Respond(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		badRequest   *errs.BadRequestError
+		unauthorized *errs.UnauthorizedError
+		forbidden    *errs.ForbiddenError
+		notFound     *errs.NotFoundError
+		conflict     *errs.ConflictError
+		tooLarge     *errs.PayloadTooLargeError
+		tooMany      *errs.TooManyRequestsError
+		validation   *errs.ValidationError
+	)
+
+	switch {
+	case errors.As(err, &badRequest):
+		write(w, r, http.StatusBadRequest, Body{Description: badRequest.Message})
+	case errors.As(err, &unauthorized):
+		write(w, r, http.StatusUnauthorized, Body{Description: unauthorized.Message})
+	case errors.As(err, &forbidden):
+		write(w, r, http.StatusForbidden, Body{Description: forbidden.Message})
+	case errors.As(err, &notFound):
+		write(w, r, http.StatusNotFound, Body{Description: notFound.Error()})
+	case errors.As(err, &conflict):
+		write(w, r, http.StatusConflict, Body{Description: conflict.Message})
+	case errors.As(err, &tooLarge):
+		write(w, r, http.StatusRequestEntityTooLarge, Body{Description: tooLarge.Message})
+	case errors.As(err, &tooMany):
+		write(w, r, http.StatusTooManyRequests, Body{Description: tooMany.Message})
+	case errors.As(err, &validation):
+		write(w, r, http.StatusUnprocessableEntity, Body{
+			Description: "some fields are invalid",
+			Code:        "validation_failed",
+			Fields:      validation.Fields,
+		})
+	default:
+		InternalServerError(w, r, err)
+	}
+}
+
+// Response with given status code
+func Error(w http.ResponseWriter, r *http.Request, code int) {
+	write(w, r, code, Body{})
 }
 
 // Response with Internal Server Error (500)
-func InternalServerError(w http.ResponseWriter, err error) {
-	log.Printf("[InternalServerError] %+v", err)
+func InternalServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logger.FromContext(r.Context()).Error("internal server error", "error", err)
+
+	Error(w, r, http.StatusInternalServerError)
+}
+
+// Write body filling Error, Code and RequestID
+func write(w http.ResponseWriter, r *http.Request, status int, body Body) {
+	body.Error = http.StatusText(status)
+	if body.Code == "" {
+		body.Code = code(status)
+	}
+	body.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.FromContext(r.Context()).Error("write error body", "error", err)
+	}
+}
 
-	Error(w, http.StatusInternalServerError)
+// Machine-readable code of status, like "not_found" for 404
+func code(status int) string {
+	if status == http.StatusInternalServerError {
+		return "internal_error"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
 }
@@ -0,0 +1,122 @@
+package httperror_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/logger"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespond(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              error
+		expectStatusCode int
+		expectBody       httperror.Body
+	}{
+		{
+			name:             "BadRequest",
+			err:              errs.BadRequest("limit is out of range"),
+			expectStatusCode: http.StatusBadRequest,
+			expectBody:       httperror.Body{Error: "Bad Request", Description: "limit is out of range", Code: "bad_request", RequestID: "req-1"},
+		},
+		{
+			name:             "Unauthorized",
+			err:              errs.Unauthorized("unknown account"),
+			expectStatusCode: http.StatusUnauthorized,
+			expectBody:       httperror.Body{Error: "Unauthorized", Description: "unknown account", Code: "unauthorized", RequestID: "req-1"},
+		},
+		{
+			name:             "Forbidden",
+			err:              errs.Forbidden("not yours"),
+			expectStatusCode: http.StatusForbidden,
+			expectBody:       httperror.Body{Error: "Forbidden", Description: "not yours", Code: "forbidden", RequestID: "req-1"},
+		},
+		{
+			// ラップされていても判別する
+			name:             "WrappedNotFound",
+			err:              fmt.Errorf("fetch: %w", errs.NotFound("status")),
+			expectStatusCode: http.StatusNotFound,
+			expectBody:       httperror.Body{Error: "Not Found", Description: "status not found", Code: "not_found", RequestID: "req-1"},
+		},
+		{
+			name:             "Conflict",
+			err:              errs.Conflict("taken"),
+			expectStatusCode: http.StatusConflict,
+			expectBody:       httperror.Body{Error: "Conflict", Description: "taken", Code: "conflict", RequestID: "req-1"},
+		},
+		{
+			name:             "PayloadTooLarge",
+			err:              errs.PayloadTooLarge("too big"),
+			expectStatusCode: http.StatusRequestEntityTooLarge,
+			expectBody:       httperror.Body{Error: "Request Entity Too Large", Description: "too big", Code: "request_entity_too_large", RequestID: "req-1"},
+		},
+		{
+			name:             "TooManyRequests",
+			err:              errs.TooManyRequests("slow down"),
+			expectStatusCode: http.StatusTooManyRequests,
+			expectBody:       httperror.Body{Error: "Too Many Requests", Description: "slow down", Code: "too_many_requests", RequestID: "req-1"},
+		},
+		{
+			name:             "Validation",
+			err:              errs.Invalid("username", "blank", "username is required").Add("password", "too_short", "too short"),
+			expectStatusCode: http.StatusUnprocessableEntity,
+			expectBody: httperror.Body{
+				Error:       "Unprocessable Entity",
+				Description: "some fields are invalid",
+				Code:        "validation_failed",
+				Fields: []errs.FieldError{
+					{Field: "username", Code: "blank", Message: "username is required"},
+					{Field: "password", Code: "too_short", Message: "too short"},
+				},
+				RequestID: "req-1",
+			},
+		},
+		{
+			// 内部のエラーメッセージは返さない
+			name:             "Internal",
+			err:              fmt.Errorf("dial tcp 10.0.0.1:3306: connection refused"),
+			expectStatusCode: http.StatusInternalServerError,
+			expectBody:       httperror.Body{Error: "Internal Server Error", Code: "internal_error", RequestID: "req-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// リクエストIDはボディとログの両方に出す
+			logs := new(bytes.Buffer)
+			ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+			ctx = logger.NewContext(ctx, logger.New(logs, logger.FormatLogfmt, logger.LevelInfo).With("request_id", "req-1"))
+			r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			httperror.Respond(w, r, tt.err)
+
+			assert.Equal(t, tt.expectStatusCode, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var body httperror.Body
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if d := cmp.Diff(body, tt.expectBody); len(d) != 0 {
+				t.Fatalf("differs: (-got +want)\n%s", d)
+			}
+			if tt.expectStatusCode == http.StatusInternalServerError {
+				assert.Contains(t, logs.String(), "request_id=req-1")
+				assert.Contains(t, logs.String(), "connection refused")
+			} else {
+				assert.Empty(t, logs.String())
+			}
+		})
+	}
+}
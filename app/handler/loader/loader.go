@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"context"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/object"
+)
+
+// Loader of accounts and attachments of statuses, created for each request.
+// It collects IDs of all statuses given at once and resolves them with one query per kind,
+// so a timeline costs the same number of queries whatever its length.
+// Accounts already joined by the query of the statuses, which have their username, are used as they are.
+type Loader struct {
+	dao dao.Dao
+
+	// accounts already loaded in the request
+	accounts map[object.AccountID]*object.Account
+}
+
+// Create loader
+func New(d dao.Dao) *Loader {
+	return &Loader{dao: d, accounts: make(map[object.AccountID]*object.Account)}
+}
+
+// Fill account and media attachments of the statuses
+func (l *Loader) Statuses(ctx context.Context, statuses []object.Status) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	var (
+		statusIDs  = make([]object.StatusID, 0, len(statuses))
+		accountIDs []object.AccountID
+		pending    = make(map[object.AccountID]bool)
+	)
+	for _, s := range statuses {
+		statusIDs = append(statusIDs, s.ID)
+		if s.Account == nil {
+			continue
+		}
+		if _, ok := l.accounts[s.Account.ID]; ok || pending[s.Account.ID] {
+			continue
+		}
+		// タイムラインのクエリでJOINしたアカウントは取得し直さない
+		if s.Account.Username != "" {
+			l.accounts[s.Account.ID] = s.Account
+			continue
+		}
+		pending[s.Account.ID] = true
+		accountIDs = append(accountIDs, s.Account.ID)
+	}
+
+	if len(accountIDs) != 0 {
+		accounts, err := l.dao.Account().FindAccountsByIDs(ctx, accountIDs)
+		if err != nil {
+			return err
+		}
+		for id, a := range accounts {
+			l.accounts[id] = a
+		}
+	}
+	attachments, err := l.dao.Attachment().FindByStatusIDs(ctx, statusIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range statuses {
+		if statuses[i].Account != nil {
+			if a, ok := l.accounts[statuses[i].Account.ID]; ok {
+				statuses[i].Account = a
+			}
+		}
+		statuses[i].MediaAttachments = attachments[statuses[i].ID]
+	}
+	return nil
+}
+
+// Fill account and media attachments of the status
+func (l *Loader) Status(ctx context.Context, status *object.Status) error {
+	statuses := []object.Status{*status}
+	if err := l.Statuses(ctx, statuses); err != nil {
+		return err
+	}
+	*status = statuses[0]
+	return nil
+}
@@ -0,0 +1,118 @@
+package loader_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/handler/loader"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// 実際のリポジトリが発行するSQLをsqlmockで受けるdao
+	mockdao struct {
+		dao.Dao
+		db *sqlx.DB
+	}
+)
+
+func (m *mockdao) Account() repository.Account {
+	return dao.NewAccount(m.db)
+}
+
+func (m *mockdao) Attachment() repository.Attachment {
+	return dao.NewAttachment(m.db)
+}
+
+func setup(t *testing.T) (*loader.Loader, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return loader.New(&mockdao{db: sqlx.NewDb(db, "sqlmock")}), mock
+}
+
+var (
+	accountColumns    = []string{"id", "username"}
+	attachmentColumns = []string{"status_id", "id", "account_id", "type", "url"}
+)
+
+func TestStatuses(t *testing.T) {
+	l, mock := setup(t)
+	ctx := context.Background()
+
+	// 80件のタイムラインでもクエリは種類ごとに1回
+	timeline := make(object.Timelines, 80)
+	args := make([]driver.Value, 0, len(timeline))
+	for i := range timeline {
+		timeline[i] = object.Status{
+			ID:      object.StatusID(i + 1),
+			Account: &object.Account{ID: object.AccountID(i%5 + 1)},
+		}
+		args = append(args, int64(i+1))
+	}
+	accounts := sqlmock.NewRows(accountColumns)
+	for id := 1; id <= 5; id++ {
+		accounts.AddRow(id, "user")
+	}
+	mock.ExpectQuery(`FROM\s+account\s`).WithArgs(1, 2, 3, 4, 5).WillReturnRows(accounts)
+	attachments := sqlmock.NewRows(attachmentColumns)
+	for id := 2; id <= 80; id += 2 {
+		attachments.AddRow(id, id, 1, "image", "attachments/x")
+	}
+	mock.ExpectQuery(`FROM\s+attachment\s`).WithArgs(args...).WillReturnRows(attachments)
+
+	if err := l.Statuses(ctx, timeline); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range timeline {
+		assert.Equal(t, "user", s.Account.Username)
+		if s.ID%2 == 0 {
+			assert.Len(t, s.MediaAttachments, 1)
+		} else {
+			assert.Empty(t, s.MediaAttachments)
+		}
+	}
+
+	// 読み込み済みのアカウントは再び取得しない
+	status := &object.Status{ID: 100, Account: &object.Account{ID: 1}}
+	mock.ExpectQuery(`FROM\s+attachment\s`).WithArgs(100).WillReturnRows(sqlmock.NewRows(attachmentColumns))
+	if err := l.Status(ctx, status); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "user", status.Account.Username)
+
+	// 空のタイムラインではクエリを発行しない
+	if err := l.Statuses(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// タイムラインのクエリでJOINしたアカウントは取得し直さない
+func TestStatusesJoinedAccounts(t *testing.T) {
+	l, mock := setup(t)
+	ctx := context.Background()
+
+	displayName := "John"
+	timeline := object.Timelines{
+		{ID: 1, Account: &object.Account{ID: 1, Username: "john", DisplayName: &displayName}},
+		{ID: 2, Account: &object.Account{ID: 2}},
+	}
+	mock.ExpectQuery(`FROM\s+account\s`).WithArgs(2).WillReturnRows(sqlmock.NewRows(accountColumns).AddRow(2, "sum"))
+	mock.ExpectQuery(`FROM\s+attachment\s`).WithArgs(1, 2).WillReturnRows(sqlmock.NewRows(attachmentColumns))
+
+	if err := l.Statuses(ctx, timeline); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &displayName, timeline[0].Account.DisplayName)
+	assert.Equal(t, "sum", timeline[1].Account.Username)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,6 +3,8 @@ package media
 import (
 	"net/http"
 	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/ratelimit"
 
 	"github.com/go-chi/chi"
 )
@@ -17,6 +19,9 @@ func NewRouter(app *app.App) http.Handler {
 	r := chi.NewRouter()
 	h := &handler{app: app}
 
+	r.Use(auth.Middleware(app))
+	// 投稿と同じバケツを使う
+	r.Use(ratelimit.Middleware(app.RateLimits, "post", app.Config.RateLimit.Post.Limit(), ratelimit.ByAccount))
 	r.Post("/", h.Upload)
 	return r
 }
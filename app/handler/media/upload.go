@@ -2,14 +2,18 @@ package media
 
 import (
 	"encoding/json"
-	"io"
-	"log"
+	"fmt"
 	"net/http"
-	"os"
 	"strings"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/files"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/validate"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/metrics"
 )
 
 func mediatype(contentType string) string {
@@ -23,64 +27,77 @@ func mediatype(contentType string) string {
 	return "unknown"
 }
 
+// Form values for "POST /v1/media"
+type uploadRequest struct {
+	Description string `validate:"max=420"`
+}
+
 // Handle request for "POST /v1/media"
 func (h *handler) Upload(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	description := r.FormValue("description")
+	login := auth.AccountOf(r)
+	if login == nil {
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
+		return
+	}
+
+	if err := files.ParseMultipartForm(w, r, h.app.Config.Media.MaxUploadBytes); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	req := uploadRequest{Description: r.FormValue("description")}
+	if err := validate.Struct(&req); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
 
 	src, header, err := r.FormFile("file")
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, errs.BadRequest("file is required as multipart form data"))
 		return
 	}
 	defer func() {
 		if err := src.Close(); err != nil {
-			log.Println(err)
+			logger.FromContext(ctx).Warn("close uploaded file", "error", err)
 		}
 	}()
 
 	attachment := &object.Attachment{
-		MediaType:   mediatype(header.Header["Content-Type"][0]),
-		URL:         files.CreateURL(header.Filename),
-		Description: &description,
+		AccountID:   login.ID,
+		MediaType:   mediatype(header.Header.Get("Content-Type")),
+		Description: &req.Description,
 	}
 	if *attachment.Description == "" {
 		attachment.Description = nil
 	}
 
-	err = files.MightCreateAttachmentDir()
-	if err != nil {
-		httperror.InternalServerError(w, err)
-		return
-	}
-
-	dest, err := os.Create(attachment.URL)
-	if err != nil {
-		httperror.InternalServerError(w, err)
-		return
-	}
-	defer func() {
-		if err := dest.Close(); err != nil {
-			log.Println(err)
+	// 参照を取るのとattachmentの作成を1つのトランザクションで行い、途中で失敗しても参照を残さない
+	// 失敗したときのファイルは、同じ内容を置いている他のリクエストがあり得るので消さない
+	var blob *object.MediaBlob
+	err = h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		// 同じ内容のファイルは一つだけ保存して参照を数える
+		var err error
+		blob, attachment.URL, err = files.Store(ctx, tx.MediaBlob(), src)
+		if err != nil {
+			return err
 		}
-	}()
-
-	_, err = io.Copy(dest, src)
-	if err != nil {
-		httperror.InternalServerError(w, err)
-		return
-	}
+		attachment.BlobHash = &blob.Hash
 
-	attachment.ID, err = h.app.Dao.Attachment().Insert(ctx, *attachment)
+		attachment.ID, err = tx.Attachment().Insert(ctx, *attachment)
+		return err
+	})
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
+	metrics.MediaUploads.Inc()
+	metrics.MediaBytesStored.Add(float64(blob.Size))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(attachment); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -0,0 +1,50 @@
+package parameters
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/proxy"
+)
+
+// Set Link header (RFC 8288) to the pages around the page of p, which has n (> 0) items
+// from newest to oldest ID. "next" points to older items and "prev" to newer ones.
+// "next" is omitted if the page is not full.
+// Links are under base, the public URL of the server, or the URL of r if base is empty.
+func SetLink(w http.ResponseWriter, r *http.Request, base string, p *object.Parameters, n int, newest int64, oldest int64) {
+	var links []string
+	if n >= p.Limit {
+		links = append(links, link(r, base, "next", "max_id", oldest, "min_id"))
+	}
+	links = append(links, link(r, base, "prev", "min_id", newest, "max_id", "since_id"))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// Link to the URL of r with key set to id and drop removed
+func link(r *http.Request, base string, rel string, key string, id int64, drop ...string) string {
+	query := r.URL.Query()
+	for _, k := range drop {
+		query.Del(k)
+	}
+	query.Set(key, strconv.FormatInt(id, 10))
+
+	return "<" + URL(r, base, r.URL.Path, query) + `>; rel="` + rel + `"`
+}
+
+// Absolute URL of path on this server as seen by the client, or under base if not empty
+func URL(r *http.Request, base string, path string, query url.Values) string {
+	u := url.URL{
+		Scheme:   proxy.Scheme(r),
+		Host:     r.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	if b, err := url.Parse(base); err == nil && base != "" {
+		u.Scheme = b.Scheme
+		u.Host = b.Host
+		u.Path = strings.TrimSuffix(b.Path, "/") + u.Path
+	}
+	return u.String()
+}
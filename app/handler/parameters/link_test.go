@@ -0,0 +1,75 @@
+package parameters_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"yatter-backend-go/app/handler/parameters"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		base   string
+		proto  string
+		n      int
+		expect string
+	}{
+		{
+			name:   "FullPage",
+			target: "/v1/timelines/public?limit=2&only_media=1",
+			n:      2,
+			expect: `<http://example.com/v1/timelines/public?limit=2&max_id=10&only_media=1>; rel="next", ` +
+				`<http://example.com/v1/timelines/public?limit=2&min_id=20&only_media=1>; rel="prev"`,
+		},
+		{
+			// 最後のページには次がない
+			name:   "LastPage",
+			target: "/v1/timelines/public?limit=2&max_id=30",
+			n:      1,
+			expect: `<http://example.com/v1/timelines/public?limit=2&min_id=20>; rel="prev"`,
+		},
+		{
+			// 前のページへはmax_idとsince_idを外す
+			name:   "MinID",
+			target: "/v1/timelines/public?limit=2&min_id=5&since_id=1",
+			n:      2,
+			expect: `<http://example.com/v1/timelines/public?limit=2&max_id=10&since_id=1>; rel="next", ` +
+				`<http://example.com/v1/timelines/public?limit=2&min_id=20>; rel="prev"`,
+		},
+		{
+			// 公開URLが設定されていればリクエストのホストより優先する
+			name:   "PublicURL",
+			target: "/v1/timelines/public?limit=2",
+			base:   "https://yatter.example.org/api/",
+			n:      1,
+			expect: `<https://yatter.example.org/api/v1/timelines/public?limit=2&min_id=20>; rel="prev"`,
+		},
+		{
+			// 信頼するプロキシを通っていなければX-Forwarded-Protoは無視する
+			name:   "UntrustedForwardedProto",
+			target: "/v1/timelines/public?limit=2",
+			proto:  "https",
+			n:      1,
+			expect: `<http://example.com/v1/timelines/public?limit=2&min_id=20>; rel="prev"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com"+tt.target, nil)
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			p, err := parameters.ParseAll(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			parameters.SetLink(w, req, tt.base, p, tt.n, 20, 10)
+			assert.Equal(t, tt.expect, w.Header().Get("Link"))
+		})
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"math"
 	"net/http"
 	"testing"
+	"time"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/handler/handler_test_setup"
 	"yatter-backend-go/app/handler/parameters"
+	"yatter-backend-go/app/snowflake"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
@@ -66,6 +68,22 @@ func TestParseErr(t *testing.T) {
 			}(),
 			expect_is_err: true,
 		},
+		{
+			// タイムライン以外のIDは投稿時刻を持たないので、日時は指定できない
+			name: "date in page",
+			actual_is_err: func() bool {
+				req, err := http.NewRequest("GET", m.AsURL("/v1/accounts/john/followers"), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params := req.URL.Query()
+				params.Add("max_id", "2024-01-02")
+				req.URL.RawQuery = params.Encode()
+				_, err = parameters.ParsePage(req)
+				return err != nil
+			}(),
+			expect_is_err: true,
+		},
 		{
 			name: "OverMaxLimit",
 			actual_is_err: func() bool {
@@ -185,6 +203,55 @@ func TestParseAll(t *testing.T) {
 				Limit:     parameters.DefaultLimit,
 			},
 		},
+		{
+			name: "min_id",
+			actual: func() *object.Parameters {
+				req, err := http.NewRequest("GET", m.AsURL("/v1/timelines/public"), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params := req.URL.Query()
+				params.Add("min_id", "10")
+				req.URL.RawQuery = params.Encode()
+				param, err := parameters.ParseAll(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return param
+			}(),
+			expect: &object.Parameters{
+				OnlyMedia: false,
+				MaxID:     math.MaxInt64,
+				SinceID:   0,
+				MinID:     10,
+				Limit:     parameters.DefaultLimit,
+			},
+		},
+		{
+			// 日時はその時刻に生成される最小のIDになる
+			name: "date",
+			actual: func() *object.Parameters {
+				req, err := http.NewRequest("GET", m.AsURL("/v1/timelines/public"), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params := req.URL.Query()
+				params.Add("max_id", "2024-01-02T03:04:05Z")
+				params.Add("since_id", "2024-01-01")
+				req.URL.RawQuery = params.Encode()
+				param, err := parameters.ParseAll(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return param
+			}(),
+			expect: &object.Parameters{
+				OnlyMedia: false,
+				MaxID:     snowflake.FromTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+				SinceID:   snowflake.FromTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) - 1,
+				Limit:     parameters.DefaultLimit,
+			},
+		},
 		{
 			name: "limit",
 			actual: func() *object.Parameters {
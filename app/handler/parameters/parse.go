@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/snowflake"
 )
 
-var ErrOutOfRange = fmt.Errorf("limit is out of range")
+var ErrOutOfRange = errs.BadRequest("limit is out of range (%d to %d)", minLimit, maxLimit)
 var ErrEmpty = fmt.Errorf("empty parameter")
 
 func parseFormValue(r *http.Request, key string) (int64, error) {
@@ -17,11 +20,38 @@ func parseFormValue(r *http.Request, key string) (int64, error) {
 	}
 	intValue, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		return -1, err
+		return -1, errs.BadRequest("%s is not a valid number", key)
 	}
 	return intValue, nil
 }
 
+// Date formats accepted in place of IDs, in ISO 8601
+var dateFormats = []string{time.RFC3339Nano, "2006-01-02"}
+
+// Parse ID of key, which may be given as a date instead if dates is true.
+// A date is converted to the smallest status ID generated at the time,
+// and lower is true if the ID is used as an exclusive lower bound, to include statuses of the time.
+func parseIDValue(r *http.Request, key string, lower bool, dates bool) (int64, error) {
+	id, err := parseFormValue(r, key)
+	if err == nil || err == ErrEmpty || !dates {
+		return id, err
+	}
+
+	value := r.FormValue(key)
+	for _, format := range dateFormats {
+		t, terr := time.Parse(format, value)
+		if terr != nil {
+			continue
+		}
+		id = snowflake.FromTime(t)
+		if lower && id > 0 {
+			id--
+		}
+		return id, nil
+	}
+	return -1, errs.BadRequest("%s is neither a valid ID nor an ISO 8601 date", key)
+}
+
 func parseLimitValue(limit int64) (int, error) {
 	if limit > maxLimit || limit < minLimit {
 		return -1, ErrOutOfRange
@@ -46,7 +76,18 @@ func ParseLimit(r *http.Request) (int, error) {
 	return intlimit, nil
 }
 
+// Parse parameters of timelines, whose IDs may be given as dates
 func ParseAll(r *http.Request) (*object.Parameters, error) {
+	return parse(r, true)
+}
+
+// Parse parameters of lists other than timelines, like followers.
+// Their IDs are not snowflake IDs, so dates are not accepted in place of them.
+func ParsePage(r *http.Request) (*object.Parameters, error) {
+	return parse(r, false)
+}
+
+func parse(r *http.Request, dates bool) (*object.Parameters, error) {
 	var err error
 	p := Default()
 
@@ -58,20 +99,27 @@ func ParseAll(r *http.Request) (*object.Parameters, error) {
 		p.OnlyMedia = true
 	}
 
-	max_id, err := parseFormValue(r, "max_id")
+	max_id, err := parseIDValue(r, "max_id", false, dates)
 	if err != nil && err != ErrEmpty {
 		return nil, err
 	} else if err != ErrEmpty {
 		p.MaxID = max_id
 	}
 
-	since_id, err := parseFormValue(r, "since_id")
+	since_id, err := parseIDValue(r, "since_id", true, dates)
 	if err != nil && err != ErrEmpty {
 		return nil, err
 	} else if err != ErrEmpty {
 		p.SinceID = since_id
 	}
 
+	min_id, err := parseIDValue(r, "min_id", true, dates)
+	if err != nil && err != ErrEmpty {
+		return nil, err
+	} else if err != ErrEmpty {
+		p.MinID = min_id
+	}
+
 	limit, err := ParseLimit(r)
 	if err != nil {
 		return nil, err
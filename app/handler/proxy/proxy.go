@@ -0,0 +1,93 @@
+// Package proxy reads headers set by reverse proxies, honoring them only
+// when the request comes from one of the trusted proxies.
+// Otherwise any client could claim another address by sending the headers itself.
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Key of context values marking requests from trusted proxies
+type trustedKey struct{}
+
+// Replace r.RemoteAddr with the address of the client given by X-Forwarded-For or X-Real-IP,
+// if the request comes from one of trusted. The address has no port, as middleware.RealIP of chi.
+// Such requests are also marked for Scheme to honor X-Forwarded-Proto.
+//
+// X-Forwarded-For is read from the right, as each proxy appends the address it received from,
+// and the first address not in trusted is the client.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isTrusted(trusted, peer(r)) {
+				r = r.WithContext(context.WithValue(r.Context(), trustedKey{}, true))
+				if ip := clientIP(trusted, r); ip != "" {
+					r.RemoteAddr = ip
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Scheme of the request as seen by the client, "https" or "http".
+// X-Forwarded-Proto of a proxy terminating TLS is honored only on requests marked by RealIP.
+func Scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if trusted, _ := r.Context().Value(trustedKey{}).(bool); trusted {
+		if strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// Address of the client given by the headers, or "" without valid ones
+func clientIP(trusted []*net.IPNet, r *http.Request) string {
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// 壊れた値より左はクライアントが書いたかもしれない
+				break
+			}
+			client = ip.String()
+			if !isTrusted(trusted, ip) {
+				break
+			}
+		}
+		return client
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// Address of the peer directly connected to the server
+func peer(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func isTrusted(trusted []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
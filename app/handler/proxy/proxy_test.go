@@ -0,0 +1,77 @@
+package proxy_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yatter-backend-go/app/handler/proxy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIP(t *testing.T) {
+	_, lb, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{lb}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		expect     string
+	}{
+		{
+			// 信頼しないクライアントが送ったヘッダーは使わない
+			name:       "Untrusted",
+			remoteAddr: "192.0.2.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}},
+			expect:     "192.0.2.1:1234",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			expect:     "198.51.100.1",
+		},
+		{
+			// クライアントが付けた偽の値は、信頼するプロキシが追記した値より左にある
+			name:       "Spoofed",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.9, 198.51.100.1", "10.0.0.2"}},
+			expect:     "198.51.100.1",
+		},
+		{
+			name:       "Broken",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.9, garbage, 10.0.0.2"}},
+			expect:     "10.0.0.2",
+		},
+		{
+			name:       "RealIP",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Real-Ip": {"198.51.100.2"}},
+			expect:     "198.51.100.2",
+		},
+		{
+			name:       "NoHeader",
+			remoteAddr: "10.0.0.1:1234",
+			expect:     "10.0.0.1:1234",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := proxy.RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
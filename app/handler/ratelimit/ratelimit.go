@@ -0,0 +1,147 @@
+// Package ratelimit rejects requests of clients exceeding their limits with Too Many Requests (429).
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"yatter-backend-go/app/bucket"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/metrics"
+)
+
+// Headers telling the client its limit
+const (
+	LimitHeader     = "X-RateLimit-Limit"
+	RemainingHeader = "X-RateLimit-Remaining"
+	ResetHeader     = "X-RateLimit-Reset"
+)
+
+// Identify the client of a request, or return "" not to limit the request
+type KeyFunc func(r *http.Request) string
+
+// Limit requests of each client identified by key to l, with a bucket per group in store.
+// The limit is disabled if l is zero.
+func Middleware(store bucket.Store, group string, l bucket.Limit, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !l.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := store.Take(ctx, group+":"+k, l, time.Now())
+			if err != nil {
+				// 制限を保存できなくてもサービスは止めない
+				logger.FromContext(ctx).Warn("take rate limit", "group", group, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setHeaders(w, l, res)
+			if !res.Allowed {
+				reject(w, r, group, res)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Check the bucket of key in group before an attempt counted only if it fails, like a wrong code.
+// The request is rejected with 429 if no failure is left, and failures are counted by Fail.
+// Returns whether the attempt may go on.
+func Allow(w http.ResponseWriter, r *http.Request, store bucket.Store, group string, key string, l bucket.Limit) bool {
+	if !l.Enabled() {
+		return true
+	}
+	res, err := store.Peek(r.Context(), group+":"+key, l, time.Now())
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("peek rate limit", "group", group, "error", err)
+		return true
+	}
+	if !res.Allowed {
+		setHeaders(w, l, res)
+		reject(w, r, group, res)
+		return false
+	}
+	return true
+}
+
+// Count a failed attempt of key in group checked by Allow
+func Fail(r *http.Request, store bucket.Store, group string, key string, l bucket.Limit) {
+	if !l.Enabled() {
+		return
+	}
+	if _, err := store.Take(r.Context(), group+":"+key, l, time.Now()); err != nil {
+		logger.FromContext(r.Context()).Warn("take rate limit", "group", group, "error", err)
+	}
+}
+
+func setHeaders(w http.ResponseWriter, l bucket.Limit, res bucket.Result) {
+	h := w.Header()
+	h.Set(LimitHeader, strconv.Itoa(l.Requests))
+	h.Set(RemainingHeader, strconv.Itoa(res.Remaining))
+	h.Set(ResetHeader, seconds(res.Reset))
+}
+
+// Respond 429 to the request exceeding the limit of group
+func reject(w http.ResponseWriter, r *http.Request, group string, res bucket.Result) {
+	metrics.RateLimited.WithLabelValues(group).Inc()
+	w.Header().Set("Retry-After", seconds(res.RetryAfter))
+	httperror.Respond(w, r, errs.TooManyRequests("rate limit exceeded, retry after %s seconds", seconds(res.RetryAfter)))
+}
+
+// Whole seconds of d, rounded up
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// Identify the client by IP address, to be used after proxy.RealIP
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// proxy.RealIPはポートなしのアドレスにする
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Identify the client by the authenticated account, to be used after auth.Middleware
+func ByAccount(r *http.Request) string {
+	account := auth.AccountOf(r)
+	if account == nil {
+		return ""
+	}
+	return strconv.FormatInt(account.ID, 10)
+}
+
+// Identify the client by the authenticated account, or by IP address if not authenticated.
+// It is used after auth.Optional, so invalid credentials are counted by IP address.
+func ByClient(r *http.Request) string {
+	if id := ByAccount(r); id != "" {
+		return "account:" + id
+	}
+	return "ip:" + ByIP(r)
+}
+
+// Limit only GET and HEAD requests of the clients identified by key
+func Reads(key KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return ""
+		}
+		return key(r)
+	}
+}
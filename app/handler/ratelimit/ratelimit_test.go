@@ -0,0 +1,147 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yatter-backend-go/app/bucket"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 常に失敗するストア
+type brokenStore struct{}
+
+func (brokenStore) Take(ctx context.Context, key string, l bucket.Limit, now time.Time) (bucket.Result, error) {
+	return bucket.Result{}, errors.New("connection refused")
+}
+
+func (brokenStore) Peek(ctx context.Context, key string, l bucket.Limit, now time.Time) (bucket.Result, error) {
+	return bucket.Result{}, errors.New("connection refused")
+}
+
+func serve(h http.Handler, method string, remoteAddr string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if token != "" {
+		req.Header.Set("Authentication", token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// 認証済みのaccountとしてリクエストする
+func serveAs(h http.Handler, method string, remoteAddr string, account *object.Account) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	req.RemoteAddr = remoteAddr
+	req = req.WithContext(auth.NewContext(req.Context(), account))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestMiddleware(t *testing.T) {
+	l := bucket.Limit{Requests: 2, Per: time.Minute}
+	h := ratelimit.Middleware(bucket.NewMemory(), "test", l, ratelimit.ByIP)(http.HandlerFunc(ok))
+
+	w := serve(h, "POST", "192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "2", w.Header().Get(ratelimit.LimitHeader))
+	assert.Equal(t, "1", w.Header().Get(ratelimit.RemainingHeader))
+	assert.Equal(t, "30", w.Header().Get(ratelimit.ResetHeader))
+
+	// ポートが違っても同じクライアント
+	w = serve(h, "POST", "192.0.2.1:5678", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "0", w.Header().Get(ratelimit.RemainingHeader))
+
+	w = serve(h, "POST", "192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get(ratelimit.RemainingHeader))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "too_many_requests")
+
+	// 別のIPアドレスは制限されない
+	w = serve(h, "POST", "192.0.2.2:1234", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestMiddlewareReads(t *testing.T) {
+	l := bucket.Limit{Requests: 1, Per: time.Minute}
+	h := ratelimit.Middleware(bucket.NewMemory(), "read", l, ratelimit.Reads(ratelimit.ByClient))(http.HandlerFunc(ok))
+	alice := &object.Account{ID: 1}
+	bob := &object.Account{ID: 2}
+
+	assert.Equal(t, http.StatusNoContent, serveAs(h, "GET", "192.0.2.1:1234", alice).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveAs(h, "GET", "192.0.2.2:1234", alice).Code)
+
+	// 認証したアカウントごとに数える
+	assert.Equal(t, http.StatusNoContent, serveAs(h, "GET", "192.0.2.1:1234", bob).Code)
+	assert.Equal(t, http.StatusNoContent, serve(h, "GET", "192.0.2.1:1234", "").Code)
+
+	// 認証できなかったヘッダーを変えても、IPアドレスごとに数える
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, "GET", "192.0.2.1:1234", "Bearer forged").Code)
+
+	// 読み取り以外は数えない
+	w := serveAs(h, "POST", "192.0.2.1:1234", alice)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get(ratelimit.LimitHeader))
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	h := ratelimit.Middleware(brokenStore{}, "test", bucket.Limit{}, ratelimit.ByIP)(http.HandlerFunc(ok))
+
+	w := serve(h, "POST", "192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get(ratelimit.LimitHeader))
+}
+
+func TestMiddlewareStoreError(t *testing.T) {
+	// ストアが使えなくてもリクエストは通す
+	l := bucket.Limit{Requests: 1, Per: time.Minute}
+	h := ratelimit.Middleware(brokenStore{}, "test", l, ratelimit.ByIP)(http.HandlerFunc(ok))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusNoContent, serve(h, "POST", "192.0.2.1:1234", "").Code)
+	}
+}
+
+func TestAllowAndFail(t *testing.T) {
+	store := bucket.NewMemory()
+	l := bucket.Limit{Requests: 2, Per: time.Minute}
+	allow := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		if ratelimit.Allow(w, httptest.NewRequest("POST", "/", nil), store, "test", "1", l) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return w
+	}
+
+	// 確かめるだけではトークンを取らない
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusNoContent, allow().Code)
+	}
+
+	// 失敗を数えて上限に達すると断る
+	ratelimit.Fail(httptest.NewRequest("POST", "/", nil), store, "test", "1", l)
+	assert.Equal(t, http.StatusNoContent, allow().Code)
+	ratelimit.Fail(httptest.NewRequest("POST", "/", nil), store, "test", "1", l)
+	w := allow()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get(ratelimit.RemainingHeader))
+
+	// ストアが使えなくても通す
+	assert.True(t, ratelimit.Allow(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil), brokenStore{}, "test", "1", l))
+}
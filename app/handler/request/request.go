@@ -3,9 +3,9 @@ package request
 import (
 	"net/http"
 	"strconv"
+	"yatter-backend-go/app/domain/errs"
 
 	"github.com/go-chi/chi"
-	"github.com/pkg/errors"
 )
 
 // Read path parameter `id`
@@ -13,12 +13,12 @@ func IDOf(r *http.Request) (int64, error) {
 	ids := chi.URLParam(r, "id")
 
 	if ids == "" {
-		return -1, errors.Errorf("id was not presence")
+		return -1, errs.BadRequest("id is required")
 	}
 
 	id, err := strconv.ParseInt(ids, 10, 64)
 	if err != nil {
-		return -1, errors.Errorf("id was not number")
+		return -1, errs.BadRequest("id is not a number")
 	}
 
 	return id, nil
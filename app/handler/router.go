@@ -5,11 +5,21 @@ import (
 	"time"
 
 	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/handler/accesslog"
 	"yatter-backend-go/app/handler/accounts"
+	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/health"
+	"yatter-backend-go/app/handler/httperror"
 	"yatter-backend-go/app/handler/media"
+	"yatter-backend-go/app/handler/proxy"
+	"yatter-backend-go/app/handler/ratelimit"
+	"yatter-backend-go/app/handler/security"
 	"yatter-backend-go/app/handler/statuses"
 	"yatter-backend-go/app/handler/timelines"
+	"yatter-backend-go/app/metrics"
+	"yatter-backend-go/app/tracing"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -21,37 +31,67 @@ func NewRouter(app *app.App) http.Handler {
 
 	// A good base middleware stack
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	// r.Use(middleware.Logger)
+	r.Use(proxy.RealIP(app.Config.Server.TrustedNets()))
+	r.Use(tracing.Middleware)
+	r.Use(accesslog.Middleware)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.Recoverer)
-	r.Use(newCORS().Handler)
+	r.Use(security.Headers(app.Config.Security))
+	// オリジンを指定しなければ、別のオリジンからの呼び出しは許可しない
+	if len(app.Config.CORS.AllowedOrigins) > 0 {
+		r.Use(newCORS(app.Config.CORS).Handler)
+	}
 
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
 	// processing should be stopped.
 	r.Use(middleware.Timeout(60 * time.Second))
 
-	r.Mount("/v1/accounts", accounts.NewRouter(app))
-	r.Mount("/v1/health", health.NewRouter())
-	r.Mount("/v1/statuses", statuses.NewRouter(app))
-	r.Mount("/v1/timelines", timelines.NewRouter(app))
-	r.Mount("/v1/media", media.NewRouter(app))
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		httperror.Respond(w, r, errs.NotFound("route"))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		httperror.Error(w, r, http.StatusMethodNotAllowed)
+	})
+
+	r.Mount("/v1/health", health.NewRouter(app))
+
+	r.Group(func(r chi.Router) {
+		// 読み取りは認証したアカウントごと、認証しないリクエストはIPアドレスごとに数える
+		r.Use(auth.Optional(app))
+		r.Use(ratelimit.Middleware(app.RateLimits, "read", app.Config.RateLimit.Read.Limit(), ratelimit.Reads(ratelimit.ByClient)))
+		r.Mount("/v1/accounts", accounts.NewRouter(app))
+		r.Mount("/v1/statuses", statuses.NewRouter(app))
+		r.Mount("/v1/timelines", timelines.NewRouter(app))
+		r.Mount("/v1/media", media.NewRouter(app))
+	})
 
 	return r
 }
 
-func newCORS() *cors.Cors {
+// Router of the admin listener, kept apart from the API as its endpoints are not public
+func NewAdminRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Handle("/metrics", metrics.Handler())
+	return r
+}
+
+func newCORS(c config.CORSConfig) *cors.Cors {
 	return cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedHeaders: []string{"*"},
-		AllowedMethods: []string{
-			http.MethodGet,
-			http.MethodHead,
-			http.MethodPut,
-			http.MethodPatch,
-			http.MethodPost,
-			http.MethodDelete,
-			http.MethodOptions,
+		AllowedOrigins: c.AllowedOrigins,
+		AllowedHeaders: c.AllowedHeaders,
+		AllowedMethods: c.AllowedMethods,
+		// pagination of list endpoints, correlation with logs, and rate limits
+		ExposedHeaders: []string{
+			"Link",
+			accesslog.RequestIDHeader,
+			ratelimit.LimitHeader,
+			ratelimit.RemainingHeader,
+			ratelimit.ResetHeader,
+			"Retry-After",
 		},
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           int(c.MaxAge.Seconds()),
 	})
 }
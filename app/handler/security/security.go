@@ -0,0 +1,40 @@
+// Package security sets headers which restrict what browsers do with responses.
+package security
+
+import (
+	"net/http"
+	"strconv"
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/handler/proxy"
+)
+
+// Set security headers to each response as c says.
+// X-Content-Type-Options is always set, and Strict-Transport-Security only to requests over TLS,
+// including those through a trusted proxy terminating TLS, so it is used after proxy.RealIP.
+func Headers(c config.SecurityConfig) func(http.Handler) http.Handler {
+	hsts := ""
+	if c.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(c.HSTSMaxAge.Seconds()), 10)
+		if c.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			if c.ContentSecurityPolicy != "" {
+				h.Set("Content-Security-Policy", c.ContentSecurityPolicy)
+			}
+			if c.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", c.ReferrerPolicy)
+			}
+			// 平文のHTTPで送っても無視されるので、TLSのときだけ付ける
+			if hsts != "" && proxy.Scheme(r) == "https" {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
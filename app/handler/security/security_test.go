@@ -0,0 +1,93 @@
+package security_test
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/handler/proxy"
+	"yatter-backend-go/app/handler/security"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaders(t *testing.T) {
+	c := config.SecurityConfig{
+		ContentSecurityPolicy: "default-src 'none'",
+		ReferrerPolicy:        "no-referrer",
+		HSTSMaxAge:            24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+	}
+	_, lb, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{lb}
+
+	tests := []struct {
+		name       string
+		config     config.SecurityConfig
+		tls        bool
+		remoteAddr string
+		proto      string
+		expectHSTS string
+	}{
+		{
+			// 平文のHTTPにはHSTSを付けない
+			name:   "PlainHTTP",
+			config: c,
+		},
+		{
+			name:       "TLS",
+			config:     c,
+			tls:        true,
+			expectHSTS: "max-age=86400; includeSubDomains",
+		},
+		{
+			// TLSを終端するプロキシの後ろ
+			name:       "ForwardedHTTPS",
+			config:     c,
+			remoteAddr: "10.0.0.1:1234",
+			proto:      "https",
+			expectHSTS: "max-age=86400; includeSubDomains",
+		},
+		{
+			// 信頼しないクライアントが付けたヘッダーは使わない
+			name:       "UntrustedForwardedHTTPS",
+			config:     c,
+			remoteAddr: "192.0.2.1:1234",
+			proto:      "https",
+		},
+		{
+			name:   "HSTSDisabled",
+			config: config.SecurityConfig{ContentSecurityPolicy: c.ContentSecurityPolicy, ReferrerPolicy: c.ReferrerPolicy},
+			tls:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := proxy.RealIP(trusted)(security.Headers(tt.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, "default-src 'none'", w.Header().Get("Content-Security-Policy"))
+			assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+			assert.Equal(t, tt.expectHSTS, w.Header().Get("Strict-Transport-Security"))
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/httperror"
 	"yatter-backend-go/app/handler/request"
@@ -15,38 +17,39 @@ func (h *handler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	id, err := request.IDOf(r)
 	if err != nil {
-		httperror.BadRequest(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	status, err := h.app.Dao.Status().FindByID(ctx, id)
+	// 削除できるかは最新の状態で判断する
+	status, err := h.app.Dao.Primary().Status().FindByID(ctx, object.StatusID(id))
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 	if status == nil {
-		httperror.Error(w, http.StatusNotFound)
+		httperror.Respond(w, r, errs.NotFound("status"))
 		return
 	}
 
 	// statusの投稿者とログインユーザーの一致を確認
 	login := auth.AccountOf(r)
 	if login == nil {
-		httperror.InternalServerError(w, fmt.Errorf("lost account"))
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
 		return
 	}
 	if status.Account.ID != login.ID {
-		httperror.BadRequest(w, fmt.Errorf("status does not belong to the User"))
+		httperror.Respond(w, r, errs.Forbidden("status does not belong to the account"))
 		return
 	}
 
-	if err = h.app.Dao.Status().Delete(ctx, id); err != nil {
-		httperror.InternalServerError(w, err)
+	if err = h.app.Dao.Status().Delete(ctx, object.StatusID(id)); err != nil {
+		httperror.Respond(w, r, err)
 		return
 	}
 
 	if err := json.NewEncoder(w).Encode(&struct{}{}); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -3,7 +3,10 @@ package statuses
 import (
 	"encoding/json"
 	"net/http"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/loader"
 	"yatter-backend-go/app/handler/request"
 )
 
@@ -12,29 +15,28 @@ func (h *handler) Fetch(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id, err := request.IDOf(r)
 	if err != nil {
-		httperror.BadRequest(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	status, err := h.app.Dao.Status().FindByID(ctx, id)
+	status, err := h.app.Dao.Status().FindByID(ctx, object.StatusID(id))
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 	if status == nil {
-		httperror.Error(w, http.StatusNotFound)
+		httperror.Respond(w, r, errs.NotFound("status"))
 		return
 	}
 
-	status.MediaAttachments, err = h.app.Dao.Attachment().FindByStatusID(ctx, id)
-	if err != nil {
-		httperror.InternalServerError(w, err)
+	if err := loader.New(h.app.Dao).Status(ctx, status); err != nil {
+		httperror.Respond(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(status); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
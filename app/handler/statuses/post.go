@@ -4,14 +4,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/errs"
 	"yatter-backend-go/app/domain/object"
 	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/loader"
+	"yatter-backend-go/app/handler/validate"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/metrics"
 )
 
+var errUnknownMedia = errs.BadRequest("unknown media_id")
+
 type AddRequest struct {
-	Status    string
-	Media_ids []object.AttachmentID
+	Status    string                `validate:"required_without=Media_ids,max=500"`
+	Media_ids []object.AttachmentID `validate:"unique,max=4"`
 }
 
 // Handle request for `POST /v1/statuses`
@@ -21,19 +29,12 @@ func (h *handler) Post(w http.ResponseWriter, r *http.Request) {
 	var req AddRequest
 	d := json.NewDecoder(r.Body)
 	if err := d.Decode(&req); err != nil {
-		httperror.BadRequest(w, err)
+		httperror.Respond(w, r, errs.BadRequest("request body is not valid JSON"))
 		return
 	}
-
-	if len(req.Media_ids) != 0 {
-		ok, err := h.app.Dao.Attachment().HasAttachmentIDs(ctx, req.Media_ids)
-		if err != nil {
-			httperror.InternalServerError(w, err)
-			return
-		} else if !ok {
-			httperror.BadRequest(w, fmt.Errorf("unknown media_id"))
-			return
-		}
+	if err := validate.Struct(&req); err != nil {
+		httperror.Respond(w, r, err)
+		return
 	}
 
 	status := &object.Status{
@@ -41,30 +42,51 @@ func (h *handler) Post(w http.ResponseWriter, r *http.Request) {
 		Account: auth.AccountOf(r),
 	}
 	if status.Account == nil {
-		httperror.InternalServerError(w, fmt.Errorf("lost account"))
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
 		return
 	}
 
-	id, err := h.app.Dao.Status().Insert(ctx, *status, req.Media_ids)
+	// 添付のチェックから投稿直後の読み出しまでを1つのトランザクションで行う
+	var entity *object.Status
+	err := h.app.Dao.WithTx(ctx, func(tx dao.Dao) error {
+		if len(req.Media_ids) != 0 {
+			// 他人のmediaや既に使われたmediaは添付できない
+			ok, err := tx.Attachment().IsAttachable(ctx, status.Account.ID, req.Media_ids)
+			if err != nil {
+				return err
+			} else if !ok {
+				return errUnknownMedia
+			}
+		}
+
+		id, err := tx.Status().Insert(ctx, *status, req.Media_ids)
+		if err != nil {
+			return err
+		}
+
+		entity, err = tx.Status().FindByID(ctx, id)
+		if err != nil {
+			return err
+		} else if entity == nil {
+			return fmt.Errorf("lost status %d", id)
+		}
+		return loader.New(tx).Status(ctx, entity)
+	})
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	entity, err := h.app.Dao.Status().FindByID(ctx, id)
-	if err != nil || entity == nil {
-		httperror.InternalServerError(w, err)
-		return
-	}
-	entity.MediaAttachments, err = h.app.Dao.Attachment().FindByStatusID(ctx, id)
-	if err != nil {
-		httperror.InternalServerError(w, err)
-		return
+	metrics.StatusesPosted.Inc()
+
+	// 投稿は保存済みなので、ホームフィードへの配信に失敗してもエラーにしない
+	if err := h.app.HomeFeed.Fanout(ctx, entity); err != nil {
+		logger.FromContext(ctx).Warn("fan out status to home feeds", "status_id", entity.ID, "error", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(entity); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"yatter-backend-go/app/app"
 	"yatter-backend-go/app/handler/auth"
+	"yatter-backend-go/app/handler/ratelimit"
 
 	"github.com/go-chi/chi"
 )
@@ -20,6 +21,7 @@ func NewRouter(app *app.App) http.Handler {
 
 	r.Route("/", func(r chi.Router) {
 		r.Use(auth.Middleware(app))
+		r.Use(ratelimit.Middleware(app.RateLimits, "post", app.Config.RateLimit.Post.Limit(), ratelimit.ByAccount))
 		r.Post("/", h.Post)
 	})
 
@@ -45,7 +45,7 @@ func TestStatus(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusBadRequest,
@@ -59,12 +59,54 @@ func TestStatus(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusOK,
 			expectContent:    handler_test_setup.Content,
 		},
+		{
+			name: "PostTooManyMedia",
+			request: func(c *handler_test_setup.C) (*http.Response, error) {
+				body := bytes.NewReader([]byte(fmt.Sprintf(`{"status":"%s","media_ids":[1,2,3,4,5]}`, handler_test_setup.Content)))
+				req, err := http.NewRequest("POST", c.AsURL("/v1/statuses"), body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
+				return c.Server.Client().Do(req)
+			},
+			expectStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "PostDuplicatedMedia",
+			request: func(c *handler_test_setup.C) (*http.Response, error) {
+				body := bytes.NewReader([]byte(fmt.Sprintf(`{"status":"%s","media_ids":[1,1]}`, handler_test_setup.Content)))
+				req, err := http.NewRequest("POST", c.AsURL("/v1/statuses"), body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
+				return c.Server.Client().Do(req)
+			},
+			expectStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "PostEmpty",
+			request: func(c *handler_test_setup.C) (*http.Response, error) {
+				body := bytes.NewReader([]byte(`{"status":""}`))
+				req, err := http.NewRequest("POST", c.AsURL("/v1/statuses"), body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
+				return c.Server.Client().Do(req)
+			},
+			expectStatusCode: http.StatusUnprocessableEntity,
+		},
 		{
 			name: "Fetch",
 			request: func(c *handler_test_setup.C) (*http.Response, error) {
@@ -98,7 +140,7 @@ func TestStatus(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusOK,
@@ -112,7 +154,7 @@ func TestStatus(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusNotFound,
@@ -125,10 +167,10 @@ func TestStatus(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername2))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername2))
 				return c.Server.Client().Do(req)
 			},
-			expectStatusCode: http.StatusBadRequest,
+			expectStatusCode: http.StatusForbidden,
 		},
 		{
 			name: "UnauthorizeDelete",
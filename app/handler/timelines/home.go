@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"yatter-backend-go/app/handler/auth"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/loader"
 	"yatter-backend-go/app/handler/parameters"
 )
 
@@ -13,33 +14,34 @@ func (h *handler) Home(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	login := auth.AccountOf(r)
 	if login == nil {
-		httperror.InternalServerError(w, fmt.Errorf("lost account"))
+		httperror.InternalServerError(w, r, fmt.Errorf("lost account"))
 		return
 	}
 
 	p, err := parameters.ParseAll(r)
 	if err != nil {
-		httperror.BadRequest(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	timeline, err := h.app.Dao.Status().HomeTimeline(ctx, login.ID, *p)
+	timeline, err := h.app.HomeFeed.Timeline(ctx, login.ID, *p)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	for i := range timeline {
-		timeline[i].MediaAttachments, err = h.app.Dao.Attachment().FindByStatusID(ctx, timeline[i].ID)
-		if err != nil {
-			httperror.InternalServerError(w, err)
-			return
-		}
+	if err := loader.New(h.app.Dao).Statuses(ctx, timeline); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	if n := len(timeline); n > 0 {
+		parameters.SetLink(w, r, h.app.Config.PublicURL, p, n, int64(timeline[0].ID), int64(timeline[n-1].ID))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(timeline); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"yatter-backend-go/app/handler/httperror"
+	"yatter-backend-go/app/handler/loader"
 	"yatter-backend-go/app/handler/parameters"
 )
 
@@ -13,27 +14,28 @@ func (h *handler) Public(w http.ResponseWriter, r *http.Request) {
 
 	p, err := parameters.ParseAll(r)
 	if err != nil {
-		httperror.BadRequest(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
 	timeline, err := h.app.Dao.Status().PublicTimeline(ctx, *p)
 	if err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 
-	for i := range timeline {
-		timeline[i].MediaAttachments, err = h.app.Dao.Attachment().FindByStatusID(ctx, timeline[i].ID)
-		if err != nil {
-			httperror.InternalServerError(w, err)
-			return
-		}
+	if err := loader.New(h.app.Dao).Statuses(ctx, timeline); err != nil {
+		httperror.Respond(w, r, err)
+		return
+	}
+
+	if n := len(timeline); n > 0 {
+		parameters.SetLink(w, r, h.app.Config.PublicURL, p, n, int64(timeline[0].ID), int64(timeline[n-1].ID))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(timeline); err != nil {
-		httperror.InternalServerError(w, err)
+		httperror.Respond(w, r, err)
 		return
 	}
 }
@@ -2,7 +2,6 @@ package timelines_test
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -75,7 +74,7 @@ func TestTimeline(t *testing.T) {
 					t.Fatal(err)
 				}
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername2))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername2))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusOK,
@@ -105,7 +104,7 @@ func TestTimeline(t *testing.T) {
 				params.Add("limit", "81")
 				req.URL.RawQuery = params.Encode()
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusBadRequest,
@@ -121,7 +120,7 @@ func TestTimeline(t *testing.T) {
 				params.Add("limit", "-1")
 				req.URL.RawQuery = params.Encode()
 				req.Header.Set("Content-Type", "application/json")
-				req.Header.Set("Authentication", fmt.Sprintf("username %s", handler_test_setup.ExistingUsername1))
+				req.Header.Set("Authentication", c.Bearer(handler_test_setup.ExistingUsername1))
 				return c.Server.Client().Do(req)
 			},
 			expectStatusCode: http.StatusBadRequest,
@@ -0,0 +1,214 @@
+// Package validate checks fields of request structs by rules declared in `validate` tags.
+//
+// Rules are separated by commas:
+//
+//	required            not empty
+//	required_without=F  not empty unless field F is not empty
+//	min=N, max=N        length in characters (grapheme clusters) of strings, or number of elements
+//	minbytes=N, maxbytes=N  length in bytes of strings
+//	username            only letters, digits and underscores, and not a reserved name
+//	password            contains both a letter and a digit, and is not a common password
+//	email               an address like user@example.com, without display name
+//	unique              no element of a slice appears twice
+//
+// The name of a field in errors is its json tag, or its lowercased Go name.
+package validate
+
+import (
+	_ "embed"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"yatter-backend-go/app/domain/errs"
+
+	"github.com/rivo/uniseg"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Static path segments under /v1/accounts, which would shadow `/v1/accounts/{username}`
+var reservedUsernames = map[string]bool{
+	"change_password":    true,
+	"confirm":            true,
+	"delete":             true,
+	"login":              true,
+	"logout":             true,
+	"password":           true,
+	"relationships":      true,
+	"two_factor":         true,
+	"update_credentials": true,
+}
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// Set of common passwords in lower case
+var commonPasswords = func() map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			set[strings.ToLower(line)] = true
+		}
+	}
+	return set
+}()
+
+// Check fields of the struct v points to, returning *errs.ValidationError with all invalid fields
+func Struct(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	verr := new(errs.ValidationError)
+	for i := 0; i < rt.NumField(); i++ {
+		tag, ok := rt.Field(i).Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		name := fieldName(rt.Field(i))
+		value := reflect.Indirect(rv.Field(i))
+
+		for _, rule := range strings.Split(tag, ",") {
+			key, arg := rule, ""
+			if j := strings.Index(rule, "="); j >= 0 {
+				key, arg = rule[:j], rule[j+1:]
+			}
+			if code, msg, ok := check(rv, value, key, arg); !ok {
+				verr.Add(name, code, name+" "+msg)
+				// report only the first broken rule of each field
+				break
+			}
+		}
+	}
+	return verr.Err()
+}
+
+// Check a rule, returning code and message of the error if broken
+func check(parent reflect.Value, v reflect.Value, key string, arg string) (string, string, bool) {
+	switch key {
+	case "required":
+		if isEmpty(v) {
+			return "blank", "is required", false
+		}
+	case "required_without":
+		if isEmpty(v) && isEmpty(reflect.Indirect(parent.FieldByName(arg))) {
+			return "blank", "is required", false
+		}
+	case "min":
+		if !isEmpty(v) && length(v) < atoi(arg) {
+			return "too_short", fmt.Sprintf("must be at least %s characters", arg), false
+		}
+	case "max":
+		if length(v) > atoi(arg) {
+			if v.Kind() == reflect.Slice {
+				return "too_many", fmt.Sprintf("must have at most %s items", arg), false
+			}
+			return "too_long", fmt.Sprintf("must be at most %s characters", arg), false
+		}
+	case "minbytes":
+		if !isEmpty(v) && v.Len() < atoi(arg) {
+			return "too_short", fmt.Sprintf("must be at least %s bytes", arg), false
+		}
+	case "maxbytes":
+		if v.Len() > atoi(arg) {
+			return "too_long", fmt.Sprintf("must be at most %s bytes", arg), false
+		}
+	case "username":
+		if !isEmpty(v) && !usernamePattern.MatchString(v.String()) {
+			return "invalid_characters", "must contain only letters, digits and underscores", false
+		}
+		if reservedUsernames[strings.ToLower(v.String())] {
+			return "reserved", "is reserved", false
+		}
+	case "password":
+		if !isEmpty(v) && !hasLetterAndDigit(v.String()) {
+			return "too_weak", "must contain both letters and digits", false
+		}
+		if commonPasswords[strings.ToLower(v.String())] {
+			return "too_common", "is too common", false
+		}
+	case "email":
+		if !isEmpty(v) && !isEmail(v.String()) {
+			return "invalid_format", "must be an email address", false
+		}
+	case "unique":
+		if hasDuplicates(v) {
+			return "duplicated", "must not contain the same item twice", false
+		}
+	default:
+		panic("validate: unknown rule " + key)
+	}
+	return "", "", true
+}
+
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+func isEmpty(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// Length of v, in grapheme clusters for strings
+func length(v reflect.Value) int {
+	if !v.IsValid() {
+		return 0
+	}
+	if v.Kind() == reflect.String {
+		return uniseg.GraphemeClusterCount(v.String())
+	}
+	return v.Len()
+}
+
+func hasLetterAndDigit(s string) bool {
+	var letter, digit bool
+	for _, r := range s {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+	return letter && digit
+}
+
+// Whether the slice v has equal elements
+func hasDuplicates(v reflect.Value) bool {
+	if !v.IsValid() {
+		return false
+	}
+	seen := make(map[interface{}]bool, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i).Interface()
+		if seen[e] {
+			return true
+		}
+		seen[e] = true
+	}
+	return false
+}
+
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic("validate: invalid argument " + s)
+	}
+	return n
+}
@@ -0,0 +1,154 @@
+package validate_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"yatter-backend-go/app/domain/errs"
+	"yatter-backend-go/app/handler/validate"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	Username    string `validate:"required,max=30,username"`
+	Password    string `validate:"required,min=12,maxbytes=72,password"`
+	DisplayName string `json:"display_name" validate:"max=30"`
+}
+
+type signup struct {
+	Email string `validate:"required,max=255,email"`
+}
+
+type status struct {
+	Status   string  `validate:"required_without=MediaIDs,max=500"`
+	MediaIDs []int64 `json:"media_ids" validate:"unique,max=4"`
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		expect []errs.FieldError
+	}{
+		{
+			name:  "Valid",
+			value: &account{Username: "john_1", Password: "c0rrect horse", DisplayName: "ジョン"},
+		},
+		{
+			name:  "Blank",
+			value: &account{Username: " ", Password: ""},
+			expect: []errs.FieldError{
+				{Field: "username", Code: "blank", Message: "username is required"},
+				{Field: "password", Code: "blank", Message: "password is required"},
+			},
+		},
+		{
+			name:  "InvalidCharacters",
+			value: &account{Username: "john!", Password: "c0rrect horse"},
+			expect: []errs.FieldError{
+				{Field: "username", Code: "invalid_characters", Message: "username must contain only letters, digits and underscores"},
+			},
+		},
+		{
+			// 固定のパスと重なる名前は大文字小文字を区別せずに断る
+			name:  "ReservedUsername",
+			value: &account{Username: "Confirm", Password: "c0rrect horse"},
+			expect: []errs.FieldError{
+				{Field: "username", Code: "reserved", Message: "username is reserved"},
+			},
+		},
+		{
+			name:  "WeakPassword",
+			value: &account{Username: "john", Password: "correct horse"},
+			expect: []errs.FieldError{
+				{Field: "password", Code: "too_weak", Message: "password must contain both letters and digits"},
+			},
+		},
+		{
+			name:  "ShortPassword",
+			value: &account{Username: "john", Password: "pass1"},
+			expect: []errs.FieldError{
+				{Field: "password", Code: "too_short", Message: "password must be at least 12 characters"},
+			},
+		},
+		{
+			// よく使われるパスワードは大文字小文字を区別せずに断る
+			name:  "CommonPassword",
+			value: &account{Username: "john", Password: "Password1234"},
+			expect: []errs.FieldError{
+				{Field: "password", Code: "too_common", Message: "password is too common"},
+			},
+		},
+		{
+			name:  "LongPasswordInBytes",
+			value: &account{Username: "john", Password: "1" + strings.Repeat("あ", 25)},
+			expect: []errs.FieldError{
+				{Field: "password", Code: "too_long", Message: "password must be at most 72 bytes"},
+			},
+		},
+		{
+			// 結合文字を含む絵文字も1文字として数える
+			name:  "GraphemeClusters",
+			value: &account{Username: "john", Password: "c0rrect horse", DisplayName: strings.Repeat("👨‍👩‍👧", 30)},
+		},
+		{
+			name:  "TooLong",
+			value: &account{Username: "john", Password: "c0rrect horse", DisplayName: strings.Repeat("a", 31)},
+			expect: []errs.FieldError{
+				{Field: "display_name", Code: "too_long", Message: "display_name must be at most 30 characters"},
+			},
+		},
+		{
+			name:  "Email",
+			value: &signup{Email: "john@example.com"},
+		},
+		{
+			// 表示名付きのアドレスは受け付けない
+			name:  "InvalidEmail",
+			value: &signup{Email: "John <john@example.com>"},
+			expect: []errs.FieldError{
+				{Field: "email", Code: "invalid_format", Message: "email must be an email address"},
+			},
+		},
+		{
+			name:  "RequiredWithout",
+			value: &status{MediaIDs: []int64{1}},
+		},
+		{
+			name:  "Duplicated",
+			value: &status{MediaIDs: []int64{1, 2, 1}},
+			expect: []errs.FieldError{
+				{Field: "media_ids", Code: "duplicated", Message: "media_ids must not contain the same item twice"},
+			},
+		},
+		{
+			name:  "TooMany",
+			value: &status{MediaIDs: []int64{1, 2, 3, 4, 5}},
+			expect: []errs.FieldError{
+				{Field: "media_ids", Code: "too_many", Message: "media_ids must have at most 4 items"},
+			},
+		},
+		{
+			name:  "RequiredWithoutBoth",
+			value: &status{},
+			expect: []errs.FieldError{
+				{Field: "status", Code: "blank", Message: "status is required"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.Struct(tt.value)
+			if tt.expect == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var verr *errs.ValidationError
+			if assert.True(t, errors.As(err, &verr), "%v", err) {
+				assert.Equal(t, tt.expect, verr.Fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/files"
+	"yatter-backend-go/app/logger"
+)
+
+// Number of deleted accounts purged at once
+const purgeBatch = 100
+
+// Periodic job deleting data of accounts deleted by their owners
+type AccountPurge struct {
+	dao      dao.Dao
+	interval time.Duration
+}
+
+// Create purger of deleted accounts
+func NewAccountPurge(dao dao.Dao, interval time.Duration) *AccountPurge {
+	return &AccountPurge{
+		dao:      dao,
+		interval: interval,
+	}
+}
+
+// Run purge every interval until ctx is done
+func (p *AccountPurge) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		// 止められて中断したのはエラーにしない
+		if err := p.Purge(ctx); err != nil && ctx.Err() == nil {
+			logger.FromContext(ctx).Error("purge deleted accounts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Delete statuses, relations, attachments and files of deleted accounts, and then the accounts
+func (p *AccountPurge) Purge(ctx context.Context) error {
+	for {
+		accounts, err := p.dao.Account().FindDeleted(ctx, purgeBatch)
+		if err != nil {
+			return fmt.Errorf("find deleted accounts: %w", err)
+		}
+		for _, a := range accounts {
+			if err := p.purge(ctx, a); err != nil {
+				return fmt.Errorf("purge account %d: %w", a.ID, err)
+			}
+			logger.FromContext(ctx).Info("account purged", "account_id", a.ID, "username", a.Username)
+		}
+		if len(accounts) < purgeBatch {
+			return nil
+		}
+	}
+}
+
+// Release media of the account and then delete its rows.
+// Each step can be run again after failing halfway, as the next purge does.
+func (p *AccountPurge) purge(ctx context.Context, a object.Account) error {
+	attachments, err := p.dao.Attachment().FindByAccountID(ctx, a.ID)
+	if err != nil {
+		return err
+	}
+	// 行と一緒に参照を解放し、途中で失敗してもやり直しで二重に解放しない
+	for _, at := range attachments {
+		if err := releaseAttachment(ctx, p.dao, at); err != nil {
+			return err
+		}
+	}
+
+	// アイコンとヘッダーはmedia blobの参照だけを持っている
+	for i, url := range []*string{a.Avatar, a.Header} {
+		// 同じURLはUnsetImageで両方外すので1度だけ
+		if url == nil || (i == 1 && a.Avatar != nil && *a.Avatar == *url) {
+			continue
+		}
+		if err := p.releaseImage(ctx, a.ID, *url); err != nil {
+			return err
+		}
+	}
+
+	// 参照をすべて解放してから行を消す
+	return p.dao.Account().Purge(ctx, a.ID)
+}
+
+// Unset the avatar or the header at url and release its media blob as many times as it was unset
+func (p *AccountPurge) releaseImage(ctx context.Context, id object.AccountID, url string) error {
+	hash, ok := files.HashOf(url)
+	if !ok {
+		return nil
+	}
+	return p.dao.WithTx(ctx, func(tx dao.Dao) error {
+		n, err := tx.Account().UnsetImage(ctx, id, url)
+		if err != nil {
+			return fmt.Errorf("unset image %s: %w", url, err)
+		}
+		for i := 0; i < n; i++ {
+			if err := release(ctx, tx, url, &hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
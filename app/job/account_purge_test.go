@@ -0,0 +1,150 @@
+package job_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockaccount struct {
+	repository.Account
+	deleted []object.Account
+	purged  []object.AccountID
+
+	// 外したアイコンとヘッダー
+	unset map[object.AccountID][]string
+
+	// Purgeを失敗させる回数
+	failures int
+}
+
+func (m *mockaccount) FindDeleted(ctx context.Context, limit int) ([]object.Account, error) {
+	// 消したアカウントは次から見つからない
+	var found []object.Account
+	for _, a := range m.deleted {
+		if !containsID(m.purged, a.ID) {
+			found = append(found, a)
+		}
+	}
+	return found, nil
+}
+
+func (m *mockaccount) UnsetImage(ctx context.Context, id object.AccountID, url string) (int, error) {
+	if m.unset == nil {
+		m.unset = map[object.AccountID][]string{}
+	}
+	var n int
+	for _, a := range m.deleted {
+		if a.ID != id {
+			continue
+		}
+		for _, image := range []*string{a.Avatar, a.Header} {
+			if image != nil && *image == url {
+				n++
+			}
+		}
+	}
+	// 外した後は何も外れない
+	for _, u := range m.unset[id] {
+		if u == url {
+			return 0, nil
+		}
+	}
+	m.unset[id] = append(m.unset[id], url)
+	return n, nil
+}
+
+func (m *mockaccount) Purge(ctx context.Context, id object.AccountID) error {
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("purge failed")
+	}
+	m.purged = append(m.purged, id)
+	return nil
+}
+
+func containsID(ids []object.AccountID, id object.AccountID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAccountPurge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "media")
+	if err := os.WriteFile(path, []byte("media"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	media := "media"
+	avatar, header := "attachments/avatar", "attachments/shared"
+
+	account := &mockaccount{
+		deleted: []object.Account{
+			{ID: 1, Avatar: &avatar, Header: &header},
+			{ID: 2},
+		},
+	}
+	attachment := &mockattachment{
+		owned: map[object.AccountID][]object.Attachment{
+			1: {{ID: 10, URL: path, BlobHash: &media}},
+		},
+	}
+	mediaBlob := &mockmediablob{refs: map[string]int{media: 1, "avatar": 1, "shared": 2}}
+	p := job.NewAccountPurge(&mockdao{account: account, attachment: attachment, mediaBlob: mediaBlob}, time.Hour)
+
+	if err := p.Purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []object.AccountID{1, 2}, account.purged)
+
+	// attachmentのファイルを消し、アイコンとヘッダーの参照を外す
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, map[string]int{media: 0, "avatar": 0, "shared": 1}, mediaBlob.refs)
+}
+
+func TestAccountPurgeRetry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "media")
+	if err := os.WriteFile(path, []byte("media"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	media := "media"
+	// アイコンとヘッダーに同じ画像を使っている
+	image := "attachments/shared"
+
+	account := &mockaccount{
+		deleted:  []object.Account{{ID: 1, Avatar: &image, Header: &image}},
+		failures: 1,
+	}
+	attachment := &mockattachment{
+		owned: map[object.AccountID][]object.Attachment{
+			1: {{ID: 10, URL: path, BlobHash: &media}},
+		},
+	}
+	mediaBlob := &mockmediablob{refs: map[string]int{media: 2, "shared": 3}}
+	p := job.NewAccountPurge(&mockdao{account: account, attachment: attachment, mediaBlob: mediaBlob}, time.Hour)
+
+	// 行を消す前に失敗しても、参照は解放済み
+	assert.Error(t, p.Purge(context.Background()))
+	assert.Empty(t, account.purged)
+	assert.Equal(t, map[string]int{media: 1, "shared": 1}, mediaBlob.refs)
+
+	// やり直しても二重に解放しない
+	if err := p.Purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []object.AccountID{1}, account.purged)
+	assert.Equal(t, map[string]int{media: 1, "shared": 1}, mediaBlob.refs)
+}
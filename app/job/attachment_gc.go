@@ -0,0 +1,144 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/handler/files"
+	"yatter-backend-go/app/logger"
+)
+
+// Number of orphan attachments fetched at once
+const collectBatch = 100
+
+// Errors of attachments which failed to be collected
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Periodic job deleting attachments which are not used by any status
+type AttachmentGC struct {
+	dao      dao.Dao
+	interval time.Duration
+	maxAge   time.Duration
+}
+
+// Create attachment garbage collector.
+// Attachments never used by a status are deleted once they are older than maxAge.
+func NewAttachmentGC(dao dao.Dao, interval time.Duration, maxAge time.Duration) *AttachmentGC {
+	return &AttachmentGC{
+		dao:      dao,
+		interval: interval,
+		maxAge:   maxAge,
+	}
+}
+
+// Run garbage collection every interval until ctx is done
+func (g *AttachmentGC) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		// 止められて中断したのはエラーにしない
+		if err := g.Collect(ctx); err != nil && ctx.Err() == nil {
+			logger.FromContext(ctx).Error("collect orphan attachments", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Delete orphan attachments and their files once.
+// Attachments failing to be deleted are logged and skipped, and returned together as Errors.
+func (g *AttachmentGC) Collect(ctx context.Context) error {
+	before := time.Now().Add(-g.maxAge)
+	var errs Errors
+	var after object.AttachmentID
+	for {
+		orphans, err := g.dao.Attachment().FindOrphans(ctx, before, after, collectBatch)
+		if err != nil {
+			return append(errs, fmt.Errorf("find orphans: %w", err))
+		}
+		for _, a := range orphans {
+			after = a.ID
+			if err := releaseOrphan(ctx, g.dao, a, before); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				// 消せないファイルがあっても残りは消す
+				logger.FromContext(ctx).Error("collect orphan attachment", "attachment_id", a.ID, "error", err)
+				errs = append(errs, err)
+			}
+		}
+		if len(orphans) < collectBatch {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Delete the attachment if it is still an orphan and release its file.
+// The row is deleted together with the release, so that the file is released only once
+// and retried by the next collection if the file is not removed.
+func releaseOrphan(ctx context.Context, d dao.Dao, a object.Attachment, before time.Time) error {
+	return d.WithTx(ctx, func(tx dao.Dao) error {
+		deleted, err := tx.Attachment().DeleteOrphan(ctx, a.ID, before)
+		if err != nil {
+			return fmt.Errorf("delete attachment %d: %w", a.ID, err)
+		}
+		if !deleted {
+			return nil
+		}
+		return release(ctx, tx, a.URL, a.BlobHash)
+	})
+}
+
+// Delete the attachment with its links to statuses and release its file, as releaseOrphan does.
+func releaseAttachment(ctx context.Context, d dao.Dao, a object.Attachment) error {
+	return d.WithTx(ctx, func(tx dao.Dao) error {
+		deleted, err := tx.Attachment().Delete(ctx, a.ID)
+		if err != nil {
+			return fmt.Errorf("delete attachment %d: %w", a.ID, err)
+		}
+		if !deleted {
+			return nil
+		}
+		return release(ctx, tx, a.URL, a.BlobHash)
+	})
+}
+
+// Release the media blob of the file at url, and remove the file unless others still refer the blob.
+// Files without blob are removed at once.
+func release(ctx context.Context, d dao.Dao, url string, hash *string) error {
+	remove := func() error {
+		if err := files.Remove(url); err != nil {
+			return fmt.Errorf("remove media file %s: %w", url, err)
+		}
+		return nil
+	}
+	if hash == nil {
+		return remove()
+	}
+	// 同じ内容の他のattachmentが残っていればファイルは消さない
+	if _, err := d.MediaBlob().Release(ctx, *hash, remove); err != nil {
+		return fmt.Errorf("release media blob %s: %w", *hash, err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package job_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/domain/object"
+	"yatter-backend-go/app/domain/repository"
+	"yatter-backend-go/app/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	mockdao struct {
+		dao.Dao
+		account    *mockaccount
+		attachment *mockattachment
+		mediaBlob  *mockmediablob
+	}
+
+	mockattachment struct {
+		repository.Attachment
+		orphans []object.Attachment
+		deleted []object.AttachmentID
+
+		// 見つけた後に投稿されたattachment
+		posted map[object.AttachmentID]bool
+
+		// アカウントごとのattachment
+		owned map[object.AccountID][]object.Attachment
+	}
+
+	mockmediablob struct {
+		repository.MediaBlob
+		refs map[string]int
+	}
+)
+
+func (m *mockdao) Account() repository.Account {
+	return m.account
+}
+
+func (m *mockdao) Attachment() repository.Attachment {
+	return m.attachment
+}
+
+func (m *mockdao) MediaBlob() repository.MediaBlob {
+	return m.mediaBlob
+}
+
+func (m *mockdao) WithTx(ctx context.Context, f func(dao.Dao) error) error {
+	return f(m)
+}
+
+func (m *mockmediablob) Release(ctx context.Context, hash string, remove func() error) (bool, error) {
+	m.refs[hash]--
+	if m.refs[hash] > 0 {
+		return false, nil
+	}
+	if err := remove(); err != nil {
+		m.refs[hash]++
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *mockattachment) FindOrphans(ctx context.Context, before time.Time, after object.AttachmentID, limit int) ([]object.Attachment, error) {
+	var found []object.Attachment
+	for _, a := range m.orphans {
+		if a.ID > after && len(found) < limit {
+			found = append(found, a)
+		}
+	}
+	return found, nil
+}
+
+func (m *mockattachment) DeleteOrphan(ctx context.Context, id object.AttachmentID, before time.Time) (bool, error) {
+	if m.posted[id] {
+		return false, nil
+	}
+	return m.Delete(ctx, id)
+}
+
+func (m *mockattachment) FindByAccountID(ctx context.Context, id object.AccountID) ([]object.Attachment, error) {
+	return m.owned[id], nil
+}
+
+func (m *mockattachment) Delete(ctx context.Context, id object.AttachmentID) (bool, error) {
+	// 消したattachmentはもう消えない
+	for _, d := range m.deleted {
+		if d == id {
+			return false, nil
+		}
+	}
+	m.deleted = append(m.deleted, id)
+	return true, nil
+}
+
+func TestAttachmentGCCollect(t *testing.T) {
+	dir := t.TempDir()
+	paths := map[string]string{}
+	for _, name := range []string{"legacy", "shared", "last"} {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shared, last := "shared", "last"
+
+	attachment := &mockattachment{
+		orphans: []object.Attachment{
+			{ID: 1, URL: paths["legacy"]},
+			{ID: 2, URL: filepath.Join(dir, "missing")},
+			{ID: 3, URL: paths["shared"], BlobHash: &shared},
+			{ID: 4, URL: paths["last"], BlobHash: &last},
+		},
+	}
+	mediaBlob := &mockmediablob{refs: map[string]int{shared: 2, last: 1}}
+	gc := job.NewAttachmentGC(&mockdao{attachment: attachment, mediaBlob: mediaBlob}, time.Hour, time.Hour)
+
+	if err := gc.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []object.AttachmentID{1, 2, 3, 4}, attachment.deleted)
+
+	tests := []struct {
+		name   string
+		exists bool
+	}{
+		{name: "legacy", exists: false},
+		{name: "shared", exists: true},
+		{name: "last", exists: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := os.Stat(paths[tt.name])
+			assert.Equal(t, tt.exists, err == nil)
+		})
+	}
+}
+
+func TestAttachmentGCCollectPosted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "posted")
+	if err := os.WriteFile(path, []byte("posted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	posted := "posted"
+
+	// 見つけた後に投稿されたattachmentは消さず、ファイルも残す
+	attachment := &mockattachment{
+		orphans: []object.Attachment{{ID: 1, URL: path, BlobHash: &posted}},
+		posted:  map[object.AttachmentID]bool{1: true},
+	}
+	mediaBlob := &mockmediablob{refs: map[string]int{posted: 1}}
+	gc := job.NewAttachmentGC(&mockdao{attachment: attachment, mediaBlob: mediaBlob}, time.Hour, time.Hour)
+
+	if err := gc.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, attachment.deleted)
+	assert.Equal(t, 1, mediaBlob.refs[posted])
+	_, err := os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestAttachmentGCCollectFailure(t *testing.T) {
+	dir := t.TempDir()
+	// 中身のあるディレクトリは消せない
+	broken := filepath.Join(dir, "broken")
+	if err := os.MkdirAll(filepath.Join(broken, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1回に取得する数より多くても、消せないものの後ろも消す
+	orphans := []object.Attachment{{ID: 1, URL: broken}}
+	var expect []object.AttachmentID
+	for id := object.AttachmentID(2); id <= 150; id++ {
+		orphans = append(orphans, object.Attachment{ID: id, URL: filepath.Join(dir, "missing")})
+		expect = append(expect, id)
+	}
+	attachment := &mockattachment{orphans: orphans}
+	gc := job.NewAttachmentGC(&mockdao{attachment: attachment, mediaBlob: &mockmediablob{}}, time.Hour, time.Hour)
+
+	err := gc.Collect(context.Background())
+	var errs job.Errors
+	if assert.ErrorAs(t, err, &errs) {
+		assert.Len(t, errs, 1)
+	}
+	// モックはロールバックしないので1も記録されるが、ファイルは残る
+	assert.Equal(t, append([]object.AttachmentID{1}, expect...), attachment.deleted)
+	_, err = os.Stat(broken)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,211 @@
+// Package logger writes structured logs as JSON or logfmt lines.
+//
+// Fields are given as alternating keys and values:
+//
+//	l.Info("served", "status", 200, "bytes", 512)
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Severity of a log
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Output format of logs
+type Format string
+
+const (
+	FormatJSON   Format = "json"
+	FormatLogfmt Format = "logfmt"
+)
+
+// Logger writing lines of level or above to out, with fields common to all lines
+type Logger struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	format Format
+	level  Level
+	fields []interface{}
+}
+
+type contextKey struct{}
+
+var std = New(os.Stderr, FormatLogfmt, LevelInfo)
+
+// Create logger
+func New(out io.Writer, format Format, level Level) *Logger {
+	return &Logger{out: out, mu: new(sync.Mutex), format: format, level: level}
+}
+
+// Logger used when the context has none
+func Default() *Logger {
+	return std
+}
+
+// Replace the logger used when the context has none
+func SetDefault(l *Logger) {
+	std = l
+}
+
+// Create context carrying l
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// Read logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return std
+}
+
+// Parse name of level, like "info"
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Create logger adding kv to the fields of every line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	c := *l
+	c.fields = append(append(make([]interface{}, 0, len(l.fields)+len(kv)), l.fields...), kv...)
+	return &c
+}
+
+// Report whether lines of level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.Log(LevelDebug, msg, kv...) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.Log(LevelInfo, msg, kv...) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.Log(LevelWarn, msg, kv...) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.Log(LevelError, msg, kv...) }
+
+// Write a line of level
+func (l *Logger) Log(level Level, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	all := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	all = append(all, "time", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	all = append(append(all, l.fields...), kv...)
+
+	buf := new(bytes.Buffer)
+	if l.format == FormatJSON {
+		writeJSON(buf, all)
+	} else {
+		writeLogfmt(buf, all)
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, kv []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key(kv, i))
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(value(kv, i))
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value(kv, i)))
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+}
+
+func writeLogfmt(buf *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key(kv, i))
+		buf.WriteByte('=')
+		s := fmt.Sprint(value(kv, i))
+		if needsQuote(s) {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+}
+
+// Key at i, which should be a string
+func key(kv []interface{}, i int) string {
+	if s, ok := kv[i].(string); ok {
+		return s
+	}
+	return "!BADKEY"
+}
+
+// Value of the key at i, with errors written as their messages
+func value(kv []interface{}, i int) interface{} {
+	if i+1 >= len(kv) {
+		return "!MISSING"
+	}
+	switch v := kv[i+1].(type) {
+	case error:
+		return fmt.Sprintf("%+v", v)
+	case time.Duration:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
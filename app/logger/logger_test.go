@@ -0,0 +1,67 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"yatter-backend-go/app/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := logger.New(buf, logger.FormatJSON, logger.LevelInfo).With("request_id", "req-1")
+
+	l.Info("served", "status", 200, "error", errors.New("oops"))
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "served", line["msg"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, float64(200), line["status"])
+	assert.Equal(t, "oops", line["error"])
+	assert.NotEmpty(t, line["time"])
+}
+
+func TestLogfmt(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := logger.New(buf, logger.FormatLogfmt, logger.LevelInfo)
+
+	l.Warn("rebuild failed", "path", "/v1/accounts", "empty", "", "odd")
+
+	line := buf.String()
+	// 空白や空文字列を含む値だけ引用符で囲む
+	assert.Contains(t, line, ` level=warn msg="rebuild failed" path=/v1/accounts empty="" odd=!MISSING`)
+	assert.True(t, strings.HasSuffix(line, "\n"))
+}
+
+func TestLevel(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := logger.New(buf, logger.FormatLogfmt, logger.LevelWarn)
+
+	l.Debug("debug")
+	l.Info("info")
+	assert.Empty(t, buf.String())
+	l.Error("error")
+	assert.Contains(t, buf.String(), "level=error")
+
+	level, err := logger.ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, logger.LevelWarn, level)
+	_, err = logger.ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+	l := logger.New(new(bytes.Buffer), logger.FormatJSON, logger.LevelInfo)
+
+	assert.Same(t, logger.Default(), logger.FromContext(context.Background()))
+	assert.Same(t, l, logger.FromContext(logger.NewContext(context.Background(), l)))
+}
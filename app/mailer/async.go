@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"yatter-backend-go/app/logger"
+)
+
+// Time allowed to send each email in the background
+const asyncTimeout = time.Minute
+
+var (
+	// Error of Send when the queue of Async is full
+	ErrQueueFull = errors.New("mailer: queue is full")
+
+	// Error of Send after Async is shut down
+	ErrClosed = errors.New("mailer: closed")
+)
+
+type (
+	// Mailer sending emails in the background, so that requests do not wait for the mail server
+	Async struct {
+		next  Mailer
+		queue chan asyncMessage
+		done  chan struct{}
+
+		mu     sync.Mutex
+		closed bool
+	}
+
+	asyncMessage struct {
+		log *logger.Logger
+		msg Message
+	}
+)
+
+// Create mailer queueing up to size emails to send through next one by one.
+// Shutdown must be called to send the rest before exiting.
+func NewAsync(next Mailer, size int) *Async {
+	a := &Async{
+		next:  next,
+		queue: make(chan asyncMessage, size),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Queue m, failing without waiting if the queue is full.
+// Errors of sending are logged to the logger of ctx, as ctx may be done by then.
+func (a *Async) Send(ctx context.Context, m Message) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	select {
+	case a.queue <- asyncMessage{log: logger.FromContext(ctx), msg: m}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (a *Async) run() {
+	defer close(a.done)
+	for m := range a.queue {
+		// リクエストが終わっても送れるように、リクエストのcontextは使わない
+		ctx, cancel := context.WithTimeout(logger.NewContext(context.Background(), m.log), asyncTimeout)
+		if err := a.next.Send(ctx, m.msg); err != nil {
+			m.log.Warn("send mail", "to", m.msg.To, "error", err)
+		}
+		cancel()
+	}
+}
+
+// Stop accepting emails and wait until queued ones are sent or ctx is done
+func (a *Async) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
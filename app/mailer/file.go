@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"yatter-backend-go/app/logger"
+)
+
+type (
+	// Implementation of Mailer writing emails to files, for local testing
+	fileMailer struct {
+		dir  string
+		from string
+	}
+
+	// Implementation of Mailer writing emails to logs, for local testing
+	logMailer struct {
+		from string
+	}
+)
+
+// Create mailer writing each email to a .eml file in dir
+func NewFile(dir string, from string) Mailer {
+	return &fileMailer{dir: dir, from: from}
+}
+
+func (f *fileMailer) Send(ctx context.Context, m Message) error {
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	now := time.Now()
+	file, err := os.CreateTemp(f.dir, now.Format("20060102-150405")+"-*.eml")
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	_, err = file.Write(m.format(f.from, now))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	logger.FromContext(ctx).Info("mail written", "to", m.To, "file", filepath.Base(file.Name()))
+	return nil
+}
+
+// Create mailer writing each email to the log of the request
+func NewLog(from string) Mailer {
+	return &logMailer{from: from}
+}
+
+func (l *logMailer) Send(ctx context.Context, m Message) error {
+	logger.FromContext(ctx).Info("mail", "from", l.from, "to", m.To, "subject", m.Subject, "body", m.Body)
+	return nil
+}
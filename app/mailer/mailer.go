@@ -0,0 +1,46 @@
+// Package mailer sends emails to accounts, like email confirmations.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"strings"
+	"time"
+)
+
+type (
+	// Sender of emails
+	Mailer interface {
+		Send(ctx context.Context, m Message) error
+	}
+
+	// Plain text email
+	Message struct {
+		// Address of the recipient
+		To string
+
+		Subject string
+		Body    string
+	}
+)
+
+// Format m from the address as RFC 5322 message
+func (m Message) format(from string, now time.Time) []byte {
+	var b bytes.Buffer
+	header := func(name string, value string) {
+		// 改行でヘッダーを追加されないようにする
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from)
+	header("To", m.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
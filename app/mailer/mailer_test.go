@@ -0,0 +1,126 @@
+package mailer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"yatter-backend-go/app/mailer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	m := mailer.NewFile(dir, "yatter@example.com")
+
+	err := m.Send(context.Background(), mailer.Message{
+		To:      "john@example.com",
+		Subject: "メールアドレスの確認",
+		Body:    "line 1\nline 2\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "yatter@example.com", msg.Header.Get("From"))
+	assert.Equal(t, "john@example.com", msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "メールアドレスの確認", subject)
+	body, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "line 1\r\nline 2\r\n", string(body))
+}
+
+func TestHeaderInjection(t *testing.T) {
+	dir := t.TempDir()
+	m := mailer.NewFile(dir, "yatter@example.com")
+
+	// 改行でヘッダーを追加できない
+	err := m.Send(context.Background(), mailer.Message{To: "john@example.com\r\nBcc: eve@example.com", Subject: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, msg.Header.Get("Bcc"))
+}
+
+// Mailer recording messages after release is closed
+type blockingMailer struct {
+	release chan struct{}
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func (b *blockingMailer) Send(ctx context.Context, m mailer.Message) error {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sent = append(b.sent, m.To)
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	b := &blockingMailer{release: make(chan struct{})}
+	a := mailer.NewAsync(b, 1)
+
+	// 送信中の1通とキューの1通を超えると、待たずに失敗する
+	assert.NoError(t, a.Send(context.Background(), mailer.Message{To: "john@example.com"}))
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = a.Send(context.Background(), mailer.Message{To: "sum@example.com"}); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, mailer.ErrQueueFull, a.Send(context.Background(), mailer.Message{To: "eve@example.com"}))
+
+	// 送り切る前に期限が来ればエラー
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, a.Shutdown(ctx))
+
+	// 止めた後は受け付けず、キューに残ったものは送り切る
+	assert.Equal(t, mailer.ErrClosed, a.Send(context.Background(), mailer.Message{To: "eve@example.com"}))
+	close(b.release)
+	assert.NoError(t, a.Shutdown(context.Background()))
+	assert.Equal(t, []string{"john@example.com", "sum@example.com"}, b.sent)
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type (
+	// Implementation of Mailer sending emails to an SMTP server
+	smtpMailer struct {
+		addr string
+		auth smtp.Auth
+		from string
+	}
+)
+
+// Create mailer sending emails from the address through the SMTP server at host:port.
+// The connection is upgraded by STARTTLS if the server supports it,
+// and authenticated by PLAIN if username is given.
+func NewSMTP(host string, port int, username string, password string, from string) Mailer {
+	m := &smtpMailer{addr: net.JoinHostPort(host, strconv.Itoa(port)), from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (s *smtpMailer) Send(ctx context.Context, m Message) error {
+	// net/smtpはcontextを受け取らないので、別のゴルーチンで送って待つ
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, m.format(s.from, time.Now()))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
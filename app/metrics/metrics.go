@@ -0,0 +1,126 @@
+// Package metrics collects metrics of the application to be scraped by Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "yatter"
+
+// Registry of all metrics exposed by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route pattern, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Latency of repository methods by repository, method and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"repository", "method", "result"})
+
+	// Number of statuses posted
+	StatusesPosted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "statuses_posted_total",
+		Help:      "Number of statuses posted.",
+	})
+
+	// Number of follows made
+	Follows = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "follows_total",
+		Help:      "Number of follows made.",
+	})
+
+	// Number of media uploaded
+	MediaUploads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "media_uploads_total",
+		Help:      "Number of media uploaded.",
+	})
+
+	// Bytes of media uploaded
+	MediaBytesStored = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "media_stored_bytes_total",
+		Help:      "Bytes of media uploaded, including content already stored by another upload.",
+	})
+
+	// Number of requests rejected by rate limits, by group
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Number of requests rejected by rate limits by group.",
+	}, []string{"group"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, queryDuration,
+		StatusesPosted, Follows, MediaUploads, MediaBytesStored, RateLimited,
+	)
+}
+
+// Handler serving metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Count requests and observe their latency, labelled by the route pattern of chi
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// unmatched paths are put together, not to make a series for each
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(status)}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Start observing a repository method, returning a function to call with its error on return:
+//
+//	defer metrics.ObserveQuery("account", "Insert")(&err)
+func ObserveQuery(repository string, method string) func(err *error) {
+	start := time.Now()
+	return func(err *error) {
+		result := "ok"
+		if *err != nil {
+			result = "error"
+		}
+		queryDuration.WithLabelValues(repository, method, result).Observe(time.Since(start).Seconds())
+	}
+}
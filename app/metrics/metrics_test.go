@@ -0,0 +1,54 @@
+package metrics_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yatter-backend-go/app/metrics"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+// Handlerの出力を読む
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(metrics.Middleware)
+	r.Route("/v1/statuses", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+	})
+
+	for _, path := range []string{"/v1/statuses/1", "/v1/statuses/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// IDごとではなくルートのパターンごとに数える
+	out := scrape(t)
+	assert.Contains(t, out, `yatter_http_requests_total{method="GET",route="/v1/statuses/{id}",status="404"} 2`)
+	assert.Contains(t, out, `yatter_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, out, `yatter_http_request_duration_seconds_count{method="GET",route="/v1/statuses/{id}",status="404"} 2`)
+}
+
+func TestObserveQuery(t *testing.T) {
+	find := func() (err error) {
+		defer metrics.ObserveQuery("account", "FindByUsername")(&err)
+		return errors.New("oops")
+	}
+	find()
+
+	assert.Contains(t, scrape(t), `yatter_repository_query_duration_seconds_count{method="FindByUsername",repository="account",result="error"} 1`)
+}
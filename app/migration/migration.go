@@ -0,0 +1,487 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// A versioned schema change
+	Migration struct {
+		// Version of the migration, taken from the file name prefix
+		Version int64
+
+		// Name of the migration
+		Name string
+
+		// SQL applying the change
+		Up string
+
+		// SQL reverting the change
+		Down string
+	}
+
+	// Migration and whether it has been applied
+	Status struct {
+		Migration
+
+		// The time the migration was applied, or nil if it is pending
+		AppliedAt *time.Time
+
+		// Whether applying or reverting the migration failed halfway
+		Dirty bool
+	}
+
+	// Apply migrations to the database
+	Migrator struct {
+		db         *sqlx.DB
+		migrations []Migration
+	}
+
+	// Row of schema_migrations
+	record struct {
+		AppliedAt time.Time `db:"applied_at"`
+		Dirty     bool      `db:"dirty"`
+	}
+)
+
+// Table which exists in databases created before migrations were introduced
+const baselineTable = "account"
+
+// e.g. 000001_init.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Create migrator reading migration files in fsys
+func New(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Read migration files in fsys sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileNamePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Apply all pending migrations.
+// A database created before migrations were introduced is adopted by Baseline(1) first.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClean(applied); err != nil {
+		return nil, err
+	}
+
+	// 旧ddl.sqlで作ったデータベースは、最初のマイグレーションを適用済みとして扱う
+	if len(applied) == 0 {
+		exists, err := m.hasTable(ctx, baselineTable)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			if _, err := m.Baseline(ctx, 1); err != nil {
+				return nil, err
+			}
+			if applied, err = m.applied(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var done []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := m.run(ctx, mig, true); err != nil {
+			return done, fmt.Errorf("migrate up %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Revert the latest `steps` applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClean(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(mig.Down) == "" {
+			return done, fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+		if err := m.run(ctx, mig, false); err != nil {
+			return done, fmt.Errorf("migrate down %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// List all migrations with the time they were applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if r, ok := applied[mig.Version]; ok {
+			at := r.AppliedAt
+			s.AppliedAt = &at
+			s.Dirty = r.Dirty
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Record migrations up to version as applied without running them,
+// for databases whose schema was created by other means
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range m.migrations {
+		if mig.Version > version {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		const insert = "INSERT INTO schema_migrations (version, name) VALUES (?, ?)"
+		if _, err := m.db.ExecContext(ctx, m.db.Rebind(insert), mig.Version, mig.Name); err != nil {
+			return done, fmt.Errorf("baseline %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Resolve a dirty migration after the schema has been fixed by hand,
+// recording it as applied if applied is true, or as pending otherwise
+func (m *Migrator) Force(ctx context.Context, version int64, applied bool) error {
+	var mig *Migration
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			mig = &m.migrations[i]
+		}
+	}
+	if mig == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	if _, err := m.applied(ctx); err != nil {
+		return err
+	}
+
+	const remove = "DELETE FROM schema_migrations WHERE version = ?"
+	if _, err := m.db.ExecContext(ctx, m.db.Rebind(remove), version); err != nil {
+		return fmt.Errorf("force %d_%s: %w", mig.Version, mig.Name, err)
+	}
+	if !applied {
+		return nil
+	}
+	const insert = "INSERT INTO schema_migrations (version, name) VALUES (?, ?)"
+	if _, err := m.db.ExecContext(ctx, m.db.Rebind(insert), mig.Version, mig.Name); err != nil {
+		return fmt.Errorf("force %d_%s: %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+// Fail if a migration has failed halfway, as the schema is neither before nor after it
+func checkClean(applied map[int64]record) error {
+	for version, r := range applied {
+		if r.Dirty {
+			return fmt.Errorf("migration %d failed halfway: fix the schema by hand and run `migrate force %d` or `migrate force %d pending`", version, version, version)
+		}
+	}
+	return nil
+}
+
+// Write up/down files of a new migration into dir, and return their paths
+func Create(dir string, name string) (string, string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q", name)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var version int64 = 1
+	if n := len(migrations); n > 0 {
+		version = migrations[n-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%06d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	for _, path := range []string{up, down} {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return "", "", err
+		}
+		_, err = fmt.Fprintf(f, "-- %s\n", filepath.Base(path))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
+
+// Split SQL into statements terminated by `;` at the end of a line
+func Statements(sql string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+	)
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Execute the statements of a migration and update schema_migrations.
+// The migration is marked dirty while it runs. MySQL commits DDL statements implicitly,
+// so if one of them fails the mark is left and further migrations are refused until Force.
+func (m *Migrator) run(ctx context.Context, mig Migration, up bool) error {
+	sql := mig.Up
+	mark, markArgs := "INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, ?)", []interface{}{mig.Version, mig.Name, true}
+	finish, finishArgs := "UPDATE schema_migrations SET dirty = ? WHERE version = ?", []interface{}{false, mig.Version}
+	if !up {
+		sql = mig.Down
+		mark, markArgs = "UPDATE schema_migrations SET dirty = ? WHERE version = ?", []interface{}{true, mig.Version}
+		finish, finishArgs = "DELETE FROM schema_migrations WHERE version = ?", []interface{}{mig.Version}
+	}
+
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// SQLite migrations rebuild tables since ALTER TABLE can't change constraints.
+	// Foreign keys must be disabled outside of the transaction to drop the old table,
+	// so they are checked by foreign_key_check before commit instead.
+	sqlite := m.db.DriverName() == "sqlite"
+	if sqlite {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, m.db.Rebind(mark), markArgs...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, stmt := range Statements(sql) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	if sqlite {
+		if err := checkForeignKeys(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, m.db.Rebind(finish), finishArgs...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Fail if some rows violate foreign key constraints in SQLite
+func checkForeignKeys(ctx context.Context, tx *sqlx.Tx) error {
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var (
+			table  string
+			rowid  interface{}
+			parent string
+			fkid   int
+		)
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		return fmt.Errorf("foreign key violation: %s(rowid %v) references %s", table, rowid, parent)
+	}
+	return rows.Err()
+}
+
+// Fetch applied versions, creating schema_migrations if needed
+func (m *Migrator) applied(ctx context.Context) (map[int64]record, error) {
+	// PostgreSQL has no datetime type
+	timeType := "datetime"
+	if m.db.DriverName() == "postgres" {
+		timeType = "timestamp"
+	}
+	create := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint NOT NULL,
+		name varchar(255) NOT NULL,
+		applied_at ` + timeType + ` NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		dirty boolean NOT NULL DEFAULT FALSE,
+		PRIMARY KEY (version)
+	)
+	`
+	if _, err := m.db.ExecContext(ctx, create); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	// dirtyを追加する前に作られた表に足す
+	hasDirty, err := m.hasColumn(ctx, "schema_migrations", "dirty")
+	if err != nil {
+		return nil, err
+	}
+	if !hasDirty {
+		const alter = "ALTER TABLE schema_migrations ADD COLUMN dirty boolean NOT NULL DEFAULT FALSE"
+		if _, err := m.db.ExecContext(ctx, alter); err != nil {
+			return nil, fmt.Errorf("alter schema_migrations: %w", err)
+		}
+	}
+
+	var rows []struct {
+		Version int64 `db:"version"`
+		record
+	}
+	if err := m.db.SelectContext(ctx, &rows, "SELECT version, applied_at, dirty FROM schema_migrations"); err != nil {
+		return nil, fmt.Errorf("select schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]record, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r.record
+	}
+	return applied, nil
+}
+
+// Whether table exists in the current database
+func (m *Migrator) hasTable(ctx context.Context, table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	switch m.db.DriverName() {
+	case "postgres":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	case "sqlite":
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+	var n int
+	if err := m.db.GetContext(ctx, &n, m.db.Rebind(query), table); err != nil {
+		return false, fmt.Errorf("look up table %s: %w", table, err)
+	}
+	return n > 0, nil
+}
+
+// Whether table has column
+func (m *Migrator) hasColumn(ctx context.Context, table string, column string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+	switch m.db.DriverName() {
+	case "postgres":
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?"
+	case "sqlite":
+		query = "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+	}
+	var n int
+	if err := m.db.GetContext(ctx, &n, m.db.Rebind(query), table, column); err != nil {
+		return false, fmt.Errorf("look up column %s.%s: %w", table, column, err)
+	}
+	return n > 0, nil
+}
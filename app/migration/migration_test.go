@@ -0,0 +1,331 @@
+package migration_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/migration"
+	"yatter-backend-go/ddl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		fsys      fstest.MapFS
+		expect    []migration.Migration
+		expectErr bool
+	}{
+		{
+			name: "SortByVersion",
+			fsys: fstest.MapFS{
+				"000002_second.up.sql":   {Data: []byte("up2")},
+				"000002_second.down.sql": {Data: []byte("down2")},
+				"000001_first.up.sql":    {Data: []byte("up1")},
+				"README.md":              {Data: []byte("ignored")},
+			},
+			expect: []migration.Migration{
+				{Version: 1, Name: "first", Up: "up1"},
+				{Version: 2, Name: "second", Up: "up2", Down: "down2"},
+			},
+		},
+		{
+			name: "MissingUp",
+			fsys: fstest.MapFS{
+				"000001_first.down.sql": {Data: []byte("down1")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "DuplicatedVersion",
+			fsys: fstest.MapFS{
+				"000001_first.up.sql":  {Data: []byte("up1")},
+				"000001_second.up.sql": {Data: []byte("up2")},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := migration.Load(tt.fsys)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expect, actual)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	var expect []string
+	for _, driver := range ddl.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			fsys, err := ddl.Migrations(driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			migrations, err := migration.Load(fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for i, m := range migrations {
+				assert.Equal(t, int64(i+1), m.Version, "versions should be sequential")
+				assert.NotEmpty(t, m.Down, "%06d_%s has no down file", m.Version, m.Name)
+				names = append(names, m.Name)
+			}
+			// 全てのドライバで同じマイグレーションが揃っている
+			if expect == nil {
+				expect = names
+			}
+			assert.Equal(t, expect, names)
+		})
+	}
+}
+
+// SQLiteはファイルだけで動くので、実際に適用と巻き戻しを確かめる
+func TestSQLiteUpDown(t *testing.T) {
+	db, err := dao.Open(&config.SQLiteDB{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	fsys, err := ddl.Migrations(config.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migration.New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	up, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, up)
+
+	// 使用中のattachmentを残したまま巻き戻せる
+	db.MustExec("INSERT INTO account (id, username, password_hash) VALUES (1, 'a', 'x')")
+	db.MustExec("INSERT INTO status (id, account_id, content) VALUES (1, 1, 'c')")
+	db.MustExec("INSERT INTO attachment (id, account_id, type, url) VALUES (1, 1, 'image', 'attachments/x')")
+	db.MustExec("INSERT INTO status_contain_attachment (status_id, attachment_id) VALUES (1, 1)")
+
+	down, err := m.Down(ctx, len(up))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, down, len(up))
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		assert.Nil(t, s.AppliedAt)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	sql := `-- comment
+CREATE TABLE a (
+  id int
+);
+
+UPDATE a SET id = 1;
+INSERT INTO a VALUES (2)`
+
+	expect := []string{
+		"CREATE TABLE a (\n  id int\n);",
+		"UPDATE a SET id = 1;",
+		"INSERT INTO a VALUES (2)",
+	}
+	assert.Equal(t, expect, migration.Statements(sql))
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "000007_existing.up.sql"), []byte("up"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	up, down, err := migration.Create(dir, "add_column")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, filepath.Join(dir, "000008_add_column.up.sql"), up)
+	assert.Equal(t, filepath.Join(dir, "000008_add_column.down.sql"), down)
+
+	// 作成したばかりのファイルがあっても次のバージョンを作れる
+	next, _, err := migration.Create(dir, "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, filepath.Join(dir, "000009_next.up.sql"), next)
+
+	_, _, err = migration.Create(dir, "invalid name")
+	assert.Error(t, err)
+}
+
+// 旧ddl.sqlで作ったデータベースは、最初のマイグレーションを適用済みとして引き継ぐ
+func TestBaseline(t *testing.T) {
+	db, err := dao.Open(&config.SQLiteDB{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	fsys, err := ddl.Migrations(config.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := migration.Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range migration.Statements(migrations[0].Up) {
+		db.MustExec(stmt)
+	}
+
+	m, err := migration.New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	up, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, up, len(migrations)-1)
+	assert.Equal(t, int64(2), up[0].Version)
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, "%06d_%s", s.Version, s.Name)
+	}
+}
+
+// 移行前は同じattachmentを複数の投稿に使え、投稿者も記録していなかった
+func TestAttachmentOwner(t *testing.T) {
+	db, err := dao.Open(&config.SQLiteDB{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	fsys, err := ddl.Migrations(config.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := migration.Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range migration.Statements(migrations[0].Up) {
+		db.MustExec(stmt)
+	}
+	db.MustExec("INSERT INTO account (id, username, password_hash) VALUES (1, 'a', 'x'), (2, 'b', 'x')")
+	db.MustExec("INSERT INTO status (id, account_id, content) VALUES (1, 1, 'first'), (2, 2, 'reused')")
+	db.MustExec("INSERT INTO attachment (id, type, url) VALUES (1, 'image', 'attachments/reused'), (2, 'image', 'attachments/unused')")
+	db.MustExec("INSERT INTO status_contain_attachment (status_id, attachment_id) VALUES (2, 1), (1, 1)")
+
+	m, err := migration.New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 最初の投稿にだけ残り、その投稿者のものになる
+	var statusIDs []int64
+	if err := db.Select(&statusIDs, "SELECT status_id FROM status_contain_attachment WHERE attachment_id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int64{1}, statusIDs)
+	var owner int64
+	if err := db.Get(&owner, "SELECT account_id FROM attachment WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(1), owner)
+
+	// 投稿者の分からない未使用のattachmentは、ファイルを消せるよう回収に回す
+	orphans, err := dao.NewAttachment(db).FindOrphans(ctx, time.Now().Add(-time.Hour), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, orphans, 1) {
+		assert.Equal(t, "attachments/unused", orphans[0].URL)
+	}
+}
+
+// 途中で失敗したマイグレーションがあると、forceで直すまで適用しない
+func TestDirty(t *testing.T) {
+	db, err := dao.Open(&config.SQLiteDB{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// dirtyを追加する前のschema_migrationsも使える
+	db.MustExec("CREATE TABLE schema_migrations (version bigint NOT NULL, name varchar(255) NOT NULL, applied_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (version))")
+
+	fsys := fstest.MapFS{
+		"000001_first.up.sql":    {Data: []byte("CREATE TABLE first (id int);")},
+		"000001_first.down.sql":  {Data: []byte("DROP TABLE first;")},
+		"000002_second.up.sql":   {Data: []byte("CREATE TABLE second (id int);")},
+		"000002_second.down.sql": {Data: []byte("DROP TABLE second;")},
+	}
+	m, err := migration.New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	db.MustExec("UPDATE schema_migrations SET dirty = ? WHERE version = 2", true)
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, statuses[1].Dirty)
+
+	_, err = m.Up(ctx)
+	assert.Error(t, err)
+	_, err = m.Down(ctx, 1)
+	assert.Error(t, err)
+
+	// 手で巻き戻したものとして未適用に戻す
+	db.MustExec("DROP TABLE second")
+	if err := m.Force(ctx, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	up, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, up, 1)
+
+	assert.Error(t, m.Force(ctx, 3, true))
+}
@@ -0,0 +1,79 @@
+// Package secret encrypts values stored in the database with a key kept out of it,
+// so that a leaked database alone does not reveal them.
+//
+// Values are encrypted by AES-256-GCM with a random nonce,
+// and encoded in base64 as the nonce followed by the ciphertext.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Size of keys in bytes
+const KeySize = 32
+
+// Error opening a value sealed by another key or for another context, or modified
+var ErrInvalid = errors.New("secret: invalid sealed value")
+
+// Encrypter of values with a key, safe for concurrent use
+type Box struct {
+	aead cipher.AEAD
+}
+
+// Decode a key written in standard base64, like the output of `openssl rand -base64 32`
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("secret: key is not base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secret: key should be %d bytes, not %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Create box encrypting with key of KeySize bytes
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secret: key should be %d bytes, not %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Encrypt plaintext for context, like the ID of the row it is stored in.
+// The same context is needed to open it, so sealed values cannot be moved to other rows.
+func (b *Box) Seal(plaintext []byte, context []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, plaintext, context)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt a value returned by Seal with the same context
+func (b *Box) Open(sealed string, context []byte) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+	nonce, ciphertext := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, context)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,62 @@
+package secret_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"yatter-backend-go/app/secret"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBox(t *testing.T, b byte) *secret.Box {
+	box, err := secret.New(bytes.Repeat([]byte{b}, secret.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestSealOpen(t *testing.T) {
+	box := newBox(t, 1)
+
+	sealed, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"), []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+
+	opened, err := box.Open(sealed, []byte("1"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", string(opened))
+	}
+
+	// nonceが毎回変わるので、同じ値でも暗号文は異なる
+	again, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"), []byte("1"))
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, sealed, again)
+	}
+
+	// 別の行に移した値や別の鍵、改竄された値は開けない
+	_, err = box.Open(sealed, []byte("2"))
+	assert.ErrorIs(t, err, secret.ErrInvalid)
+	_, err = newBox(t, 2).Open(sealed, []byte("1"))
+	assert.ErrorIs(t, err, secret.ErrInvalid)
+	_, err = box.Open(sealed[:len(sealed)-4]+"AAAA", []byte("1"))
+	assert.ErrorIs(t, err, secret.ErrInvalid)
+	_, err = box.Open("", []byte("1"))
+	assert.ErrorIs(t, err, secret.ErrInvalid)
+}
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, secret.KeySize)
+	parsed, err := secret.ParseKey(base64.StdEncoding.EncodeToString(key))
+	if assert.NoError(t, err) {
+		assert.Equal(t, key, parsed)
+	}
+
+	_, err = secret.ParseKey("not base64!")
+	assert.Error(t, err)
+	_, err = secret.ParseKey(base64.StdEncoding.EncodeToString(key[:16]))
+	assert.Error(t, err)
+}
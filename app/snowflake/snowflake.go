@@ -0,0 +1,103 @@
+// Package snowflake generates 64-bit IDs ordered by the time they are generated.
+//
+// An ID consists of, from the most significant bit,
+// 1 unused sign bit, 41 bits of milliseconds since Epoch,
+// 10 bits of node number and 12 bits of sequence number within the millisecond.
+package snowflake
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+
+	// Largest node number
+	MaxNode = 1<<nodeBits - 1
+
+	maxSequence = 1<<sequenceBits - 1
+	timeShift   = nodeBits + sequenceBits
+)
+
+// Origin of timestamps in IDs
+var Epoch = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator of IDs, safe for concurrent use.
+// Each process generating IDs at the same time should have its own node number.
+type Generator struct {
+	mu       sync.Mutex
+	node     int64
+	last     int64
+	sequence int64
+
+	// clock and sleep, replaced in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// Create generator of node
+func New(node int64) (*Generator, error) {
+	if node < 0 || node > MaxNode {
+		return nil, fmt.Errorf("snowflake: node %d is out of range [0, %d]", node, MaxNode)
+	}
+	return &Generator{node: node, now: time.Now, sleep: time.Sleep}, nil
+}
+
+// Generate an ID greater than any ID generated before by g
+func (g *Generator) Next() int64 {
+	for {
+		id, wait := g.next()
+		if wait <= 0 {
+			return id
+		}
+		// sleep without the lock, as it may be long after the clock goes backwards
+		g.sleep(wait)
+	}
+}
+
+// Generate an ID, or the time to wait for the clock if the sequence is exhausted
+func (g *Generator) next() (int64, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	ms := millis(now)
+	// keep IDs increasing even if the clock goes backwards
+	if ms < g.last {
+		ms = g.last
+	}
+	if ms == g.last {
+		if g.sequence == maxSequence {
+			// sequence exhausted, wait for the next millisecond
+			return 0, Epoch.Add(time.Duration(g.last+1) * time.Millisecond).Sub(now)
+		}
+		g.sequence++
+	} else {
+		g.sequence = 0
+	}
+	g.last = ms
+
+	return ms<<timeShift | g.node<<sequenceBits | g.sequence, 0
+}
+
+// The smallest ID which can be generated at t.
+// IDs generated before t are smaller than it, and IDs generated at or after t are not.
+func FromTime(t time.Time) int64 {
+	ms := millis(t)
+	if ms < 0 {
+		return 0
+	}
+	return ms << timeShift
+}
+
+// The time when id was generated, in milliseconds precision
+func Time(id int64) time.Time {
+	return Epoch.Add(time.Duration(id>>timeShift) * time.Millisecond)
+}
+
+func millis(t time.Time) int64 {
+	return t.Sub(Epoch).Milliseconds()
+}
@@ -0,0 +1,99 @@
+package snowflake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNext(t *testing.T) {
+	now := Epoch.Add(time.Hour)
+	g, err := New(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.now = func() time.Time { return now }
+
+	first := g.Next()
+	assert.Equal(t, now, Time(first))
+	assert.Equal(t, FromTime(now)|3<<sequenceBits, first)
+
+	// 同じミリ秒内ではシーケンス番号で増える
+	second := g.Next()
+	assert.Equal(t, first+1, second)
+
+	// 時計が戻っても減らない
+	now = now.Add(-time.Second)
+	assert.Greater(t, g.Next(), second)
+}
+
+func TestNextExhaustSequence(t *testing.T) {
+	g, err := New(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int64]bool)
+	last := int64(-1)
+	for i := 0; i < 3*(maxSequence+1); i++ {
+		id := g.Next()
+		if !assert.Greater(t, id, last) || !assert.False(t, seen[id]) {
+			return
+		}
+		seen[id] = true
+		last = id
+	}
+}
+
+func TestNextWaitsClockUnlocked(t *testing.T) {
+	now := Epoch.Add(time.Hour)
+	g, err := New(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.now = func() time.Time { return now }
+	last := g.Next()
+
+	// 時計が1秒戻ったままシーケンスを使い切ると、元の時刻の次のミリ秒まで待つ
+	now = now.Add(-time.Second)
+	for i := 0; i < maxSequence; i++ {
+		g.Next()
+	}
+	var waited time.Duration
+	g.sleep = func(d time.Duration) {
+		// 待つ間はロックを持たない
+		g.mu.Lock()
+		g.mu.Unlock()
+		waited += d
+		now = now.Add(d)
+	}
+
+	id := g.Next()
+	assert.Equal(t, time.Second+time.Millisecond, waited)
+	assert.Equal(t, Time(last).Add(time.Millisecond), Time(id))
+}
+
+func TestFromTime(t *testing.T) {
+	at := Epoch.Add(24 * time.Hour)
+	g, err := New(MaxNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.now = func() time.Time { return at.Add(-time.Millisecond) }
+	before := g.Next()
+	g.now = func() time.Time { return at }
+	after := g.Next()
+
+	assert.Less(t, before, FromTime(at))
+	assert.GreaterOrEqual(t, after, FromTime(at))
+	assert.Equal(t, int64(0), FromTime(Epoch.Add(-time.Hour)))
+}
+
+func TestNewOutOfRange(t *testing.T) {
+	_, err := New(MaxNode + 1)
+	assert.Error(t, err)
+	_, err = New(-1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Values of db.system by the names of database/sql drivers
+var dbSystems = map[string]attribute.KeyValue{
+	"mysql":    semconv.DBSystemMySQL,
+	"postgres": semconv.DBSystemPostgreSQL,
+	"sqlite":   semconv.DBSystemSqlite,
+}
+
+// Create connector opening connections of drv registered as driverName to dsn,
+// recording a span of each statement, like "SELECT", with its SQL but not its arguments.
+func Connector(drv driver.Driver, driverName string, dsn string) (driver.Connector, error) {
+	system, ok := dbSystems[driverName]
+	if !ok {
+		system = semconv.DBSystemOtherSQL
+	}
+	c := &connector{drv: drv, system: system}
+	if dc, ok := drv.(driver.DriverContext); ok {
+		base, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		c.base = base
+	} else {
+		c.base = dsnConnector{drv: drv, dsn: dsn}
+	}
+	return c, nil
+}
+
+type connector struct {
+	base   driver.Connector
+	drv    driver.Driver
+	system attribute.KeyValue
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, system: c.system}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.drv
+}
+
+// Connector of drivers without driver.DriverContext
+type dsnConnector struct {
+	drv driver.Driver
+	dsn string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+// Start span of a statement, named by its first keyword
+func startStatement(ctx context.Context, system attribute.KeyValue, query string) (context.Context, trace.Span) {
+	name := "SQL"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		name = strings.ToUpper(fields[0])
+	}
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(system, semconv.DBStatementKey.String(query)),
+	)
+}
+
+// End span of a statement, where driver.ErrSkip only asks database/sql to retry another way
+func endStatement(span trace.Span, err error) {
+	if err == driver.ErrSkip {
+		err = nil
+	}
+	End(span, err)
+}
+
+// Connection recording spans of statements.
+// Optional interfaces of the driver are forwarded, falling back the way database/sql does.
+type tracedConn struct {
+	driver.Conn
+	system attribute.KeyValue
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var s driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: s, conn: c, query: query}, nil
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("tracing: driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startStatement(ctx, c.system, query)
+	result, err := e.ExecContext(ctx, query, args)
+	endStatement(span, err)
+	return result, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startStatement(ctx, c.system, query)
+	rows, err := q.QueryContext(ctx, query, args)
+	endStatement(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// Prepared statement recording a span of each execution
+type tracedStmt struct {
+	driver.Stmt
+	conn  *tracedConn
+	query string
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := startStatement(ctx, s.conn.system, s.query)
+	var result driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(values(args))
+	}
+	endStatement(span, err)
+	return result, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := startStatement(ctx, s.conn.system, s.query)
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(values(args))
+	}
+	endStatement(span, err)
+	return rows, err
+}
+
+func (s *tracedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	// database/sql asks the connection only if the statement does not check
+	return s.conn.CheckNamedValue(nv)
+}
+
+// Arguments for drivers without context, which take no names
+func values(args []driver.NamedValue) []driver.Value {
+	vs := make([]driver.Value, len(args))
+	for i, a := range args {
+		vs[i] = a.Value
+	}
+	return vs
+}
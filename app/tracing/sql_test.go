@@ -0,0 +1,88 @@
+package tracing_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"yatter-backend-go/app/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	_ "modernc.org/sqlite"
+)
+
+func TestConnector(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	raw, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := tracing.Connector(raw.Driver(), "sqlite", ":memory:")
+	raw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx, parent := tracing.StartQuery(context.Background(), "status", "FindByID")
+	if _, err := db.ExecContext(ctx, "CREATE TABLE status (id integer)"); err != nil {
+		t.Fatal(err)
+	}
+	// トランザクションやプリペアドステートメントの中の文も記録する
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO status (id) VALUES (?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.ExecContext(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err := db.QueryRowContext(ctx, "select id from status where id = ?", 1).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.QueryContext(ctx, "SELECT * FROM missing")
+	assert.Error(t, err)
+	parent.End()
+
+	var names, statements []string
+	for _, span := range sr.Ended() {
+		if span.SpanContext().SpanID() == parent.SpanContext().SpanID() {
+			continue
+		}
+		names = append(names, span.Name())
+		for _, kv := range span.Attributes() {
+			if kv.Key == semconv.DBStatementKey {
+				statements = append(statements, kv.Value.AsString())
+			}
+		}
+		assert.Contains(t, span.Attributes(), semconv.DBSystemSqlite)
+		// リポジトリのメソッドの子になる
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		if span.Name() == "SELECT" && statements[len(statements)-1] == "SELECT * FROM missing" {
+			assert.Equal(t, codes.Error, span.Status().Code)
+		}
+	}
+	assert.Equal(t, []string{"CREATE", "INSERT", "SELECT", "SELECT"}, names)
+	assert.Equal(t, []string{
+		"CREATE TABLE status (id integer)",
+		"INSERT INTO status (id) VALUES (?)",
+		"select id from status where id = ?",
+		"SELECT * FROM missing",
+	}, statements)
+}
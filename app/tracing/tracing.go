@@ -0,0 +1,135 @@
+// Package tracing records spans of requests and repository calls with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Name of the instrumentation
+	instrumentationName = "yatter-backend-go"
+
+	// Service name unless OTEL_SERVICE_NAME is set
+	defaultServiceName = "yatter"
+)
+
+// Exporter of spans
+const (
+	// Spans are not recorded
+	ExporterNone = ""
+
+	// Spans are sent by OTLP over HTTP, to OTEL_EXPORTER_OTLP_ENDPOINT (localhost:4318 by default)
+	ExporterOTLP = "otlp"
+
+	// Spans are written to standard output
+	ExporterStdout = "stdout"
+)
+
+// Set up the global tracer provider exporting spans by exporter, and W3C Trace Context propagation.
+// The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var e sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		e, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		e, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	res, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(defaultServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	res, err = sdkresource.Merge(res, sdkresource.Environment())
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(e),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer of the application, from the global tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start span of a repository method, like "status.HomeTimeline".
+// Call End with the error of the method when it returns.
+func StartQuery(ctx context.Context, table string, method string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, table+"."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSQLTableKey.String(table), semconv.DBOperationKey.String(method)),
+	)
+}
+
+// End span, recording err if any
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Record a span of each request, continuing the trace given by the traceparent header.
+// Spans are named by the route pattern of chi, like "GET /v1/statuses/{id}".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", "", r)...),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRouteKey.String(rctx.RoutePattern()))
+		}
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status), attribute.String("http.request_id", middleware.GetReqID(ctx)))
+		// client errors (4xx) are not errors of the server
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yatter-backend-go/app/tracing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddleware(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.ExporterNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Get("/v1/statuses/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// リポジトリの呼び出しはリクエストの子になる
+		_, span := tracing.StartQuery(r.Context(), "status", "FindByID")
+		tracing.End(span, errors.New("oops"))
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/v1/statuses/1", nil)
+	req.Header.Set("traceparent", traceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := sr.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	query, server := spans[0], spans[1]
+
+	// traceparentのトレースを引き継ぐ
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, "GET /v1/statuses/{id}", server.Name())
+	assert.Equal(t, codes.Error, server.Status().Code)
+
+	assert.Equal(t, "status.FindByID", query.Name())
+	assert.Equal(t, server.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Equal(t, codes.Error, query.Status().Code)
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.ExporterStdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(context.Background(), "zipkin")
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/config"
+)
+
+// Handle `approve-account USERNAME` subcommand.
+// With registrations.mode approval, accounts can log in after both this and email confirmation.
+func approveAccount(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: approve-account USERNAME")
+	}
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return err
+	}
+	d, err := app.NewDao(cfg)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	a, err := d.Primary().Account().FindByUsername(ctx, args[0])
+	if err != nil {
+		return err
+	} else if a == nil {
+		return fmt.Errorf("account %q not found", args[0])
+	}
+	if err := d.Account().Approve(ctx, a.ID); err != nil {
+		return err
+	}
+	log.Printf("Approved account %s", a.Username)
+	return nil
+}
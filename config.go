@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"yatter-backend-go/app/config"
+)
+
+const configUsage = `Usage: yatter-backend-go config <command> [flags]
+
+Commands:
+  print          Show the effective config as YAML, with secrets redacted.
+                 Flags are the same as the server's, like -config FILE or -server.port 8080
+`
+
+// Handle `config` subcommand
+func configCommand(args []string) error {
+	if len(args) < 1 || args[0] != "print" {
+		fmt.Fprint(flag.CommandLine.Output(), configUsage)
+		return fmt.Errorf("missing or unknown config command")
+	}
+
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		return err
+	}
+	return cfg.Redacted().WriteYAML(os.Stdout)
+}
@@ -0,0 +1,29 @@
+// Package ddl holds the versioned schema migrations of the database.
+package ddl
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+//go:embed migrations/*/*.sql
+var migrations embed.FS
+
+// Directory of the migration files, relative to the repository root.
+// Migrations of each driver are placed in its own subdirectory.
+const MigrationsDir = "ddl/migrations"
+
+// Drivers which have migrations
+var Drivers = []string{"mysql", "postgres", "sqlite"}
+
+// Migration files of the driver embedded in the binary
+func Migrations(driver string) (fs.FS, error) {
+	for _, d := range Drivers {
+		if d == driver {
+			return fs.Sub(migrations, path.Join("migrations", driver))
+		}
+	}
+	return nil, fmt.Errorf("no migrations for driver %q", driver)
+}
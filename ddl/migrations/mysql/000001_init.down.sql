@@ -0,0 +1,5 @@
+DROP TABLE `status_contain_attachment`;
+DROP TABLE `attachment`;
+DROP TABLE `relation`;
+DROP TABLE `status`;
+DROP TABLE `account`;
@@ -0,0 +1,18 @@
+-- 外部キーが使っているUNIQUEは消せないので、外部キーを外してから付け直す
+ALTER TABLE `status_contain_attachment`
+  DROP FOREIGN KEY `fk_attachment_id`;
+
+ALTER TABLE `status_contain_attachment`
+  DROP INDEX `attachment_id`;
+
+ALTER TABLE `status_contain_attachment`
+  ADD CONSTRAINT `fk_attachment_id` FOREIGN KEY (`attachment_id`) REFERENCES `attachment` (`id`);
+
+ALTER TABLE `attachment`
+  DROP FOREIGN KEY `fk_attachment_account_id`;
+
+ALTER TABLE `attachment`
+  DROP INDEX `idx_attachment_account_id`,
+  DROP COLUMN `account_id`,
+  DROP COLUMN `create_at`,
+  DROP COLUMN `detached_at`;
@@ -0,0 +1,25 @@
+ALTER TABLE `attachment`
+  ADD COLUMN `account_id` bigint(20) AFTER `id`,
+  ADD COLUMN `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD COLUMN `detached_at` datetime;
+
+-- 同じattachmentを使う投稿が複数あれば、最初の投稿にだけ残す
+DELETE sca FROM `status_contain_attachment` AS sca
+  INNER JOIN `status_contain_attachment` AS earlier
+  ON earlier.`attachment_id` = sca.`attachment_id` AND earlier.`status_id` < sca.`status_id`;
+
+-- 投稿に使われているattachmentは投稿者のものとする
+UPDATE `attachment` AS a
+  INNER JOIN `status_contain_attachment` AS sca ON sca.`attachment_id` = a.`id`
+  INNER JOIN `status` AS s ON s.`id` = sca.`status_id`
+SET a.`account_id` = s.`account_id`;
+
+-- 投稿者の分からない未使用のattachmentは外したものとして、ファイルごと回収させる
+UPDATE `attachment` SET `detached_at` = CURRENT_TIMESTAMP WHERE `account_id` IS NULL;
+
+ALTER TABLE `attachment`
+  ADD INDEX `idx_attachment_account_id` (`account_id`),
+  ADD CONSTRAINT `fk_attachment_account_id` FOREIGN KEY (`account_id`) REFERENCES `account` (`id`);
+
+ALTER TABLE `status_contain_attachment`
+  ADD UNIQUE (`attachment_id`);
@@ -0,0 +1,8 @@
+ALTER TABLE `attachment`
+  DROP FOREIGN KEY `fk_attachment_blob_hash`;
+
+ALTER TABLE `attachment`
+  DROP COLUMN `blob_hash`,
+  ADD UNIQUE (`url`);
+
+DROP TABLE `media_blob`;
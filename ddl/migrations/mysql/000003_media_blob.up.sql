@@ -0,0 +1,12 @@
+CREATE TABLE `media_blob` (
+  `hash` char(64) NOT NULL,
+  `size` bigint(20) NOT NULL,
+  `ref_count` int NOT NULL DEFAULT 0,
+  `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`hash`)
+);
+
+ALTER TABLE `attachment`
+  DROP INDEX `url`,
+  ADD COLUMN `blob_hash` char(64) AFTER `url`,
+  ADD CONSTRAINT `fk_attachment_blob_hash` FOREIGN KEY (`blob_hash`) REFERENCES `media_blob` (`hash`);
@@ -0,0 +1 @@
+DROP TABLE `account_stats`;
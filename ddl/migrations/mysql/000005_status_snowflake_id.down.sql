@@ -0,0 +1,6 @@
+SET FOREIGN_KEY_CHECKS=0;
+
+ALTER TABLE `status`
+  MODIFY `id` bigint(20) NOT NULL AUTO_INCREMENT;
+
+SET FOREIGN_KEY_CHECKS=1;
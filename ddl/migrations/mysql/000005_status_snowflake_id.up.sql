@@ -0,0 +1,7 @@
+-- statusのIDはアプリケーションで生成する
+SET FOREIGN_KEY_CHECKS=0;
+
+ALTER TABLE `status`
+  MODIFY `id` bigint(20) NOT NULL;
+
+SET FOREIGN_KEY_CHECKS=1;
@@ -0,0 +1,16 @@
+-- 既存のアカウントはメールアドレスなしで有効なままとする
+ALTER TABLE `account`
+  ADD COLUMN `email` varchar(255) UNIQUE AFTER `username`,
+  ADD COLUMN `state` varchar(16) NOT NULL DEFAULT 'confirmed',
+  ADD COLUMN `email_confirmed_at` datetime,
+  ADD COLUMN `approved_at` datetime;
+
+CREATE TABLE `confirmation_token` (
+  `token_hash` varchar(64) NOT NULL,
+  `account_id` bigint(20) NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`token_hash`),
+  INDEX `idx_confirmation_token_account_id` (`account_id`),
+  CONSTRAINT `fk_confirmation_token_account_id` FOREIGN KEY (`account_id`) REFERENCES `account` (`id`)
+);
@@ -0,0 +1,17 @@
+-- TOTPの秘密鍵は設定の鍵で暗号化し、リカバリーコードはハッシュで保存する
+CREATE TABLE `two_factor` (
+  `account_id` bigint(20) NOT NULL,
+  `secret` varchar(255) NOT NULL,
+  `enabled_at` datetime,
+  `last_used_step` bigint(20) NOT NULL DEFAULT 0,
+  `create_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`account_id`),
+  CONSTRAINT `fk_two_factor_account_id` FOREIGN KEY (`account_id`) REFERENCES `account` (`id`)
+);
+
+CREATE TABLE `recovery_code` (
+  `account_id` bigint(20) NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  PRIMARY KEY (`account_id`, `code_hash`),
+  CONSTRAINT `fk_recovery_code_account_id` FOREIGN KEY (`account_id`) REFERENCES `account` (`id`)
+);
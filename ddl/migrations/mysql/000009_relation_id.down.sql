@@ -0,0 +1,9 @@
+-- idを消すとidx_relation_follower_idは(follower_id)になり、外部キーが使うので残す
+ALTER TABLE `relation`
+  DROP PRIMARY KEY,
+  DROP COLUMN `id`,
+  ADD PRIMARY KEY (`following_id`, `follower_id`);
+
+DROP INDEX `idx_relation_following_id` ON `relation`;
+
+DROP INDEX `uk_relation` ON `relation`;
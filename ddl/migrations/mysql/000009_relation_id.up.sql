@@ -0,0 +1,11 @@
+-- フォローした順に一覧を返すため、relationに連番のIDを付ける
+ALTER TABLE `relation`
+  ADD UNIQUE KEY `uk_relation` (`following_id`, `follower_id`);
+
+ALTER TABLE `relation`
+  DROP PRIMARY KEY,
+  ADD COLUMN `id` bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST;
+
+CREATE INDEX `idx_relation_following_id` ON `relation` (`following_id`, `id`);
+
+CREATE INDEX `idx_relation_follower_id` ON `relation` (`follower_id`, `id`);
@@ -0,0 +1,46 @@
+CREATE TABLE account (
+  id bigserial NOT NULL,
+  username varchar(255) NOT NULL UNIQUE,
+  password_hash varchar(255) NOT NULL,
+  display_name varchar(255),
+  avatar text,
+  header text,
+  note text,
+  create_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE status (
+  id bigserial NOT NULL,
+  account_id bigint NOT NULL,
+  content text NOT NULL,
+  create_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_status_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+CREATE INDEX idx_account_id ON status (account_id);
+
+CREATE TABLE relation (
+  following_id bigint NOT NULL,
+  follower_id bigint NOT NULL,
+  PRIMARY KEY (following_id, follower_id),
+  CONSTRAINT fk_relation_following_id FOREIGN KEY (following_id) REFERENCES account (id),
+  CONSTRAINT fk_relation_follower_id FOREIGN KEY (follower_id) REFERENCES account (id)
+);
+
+CREATE TABLE attachment (
+  id bigserial NOT NULL,
+  type varchar(255) NOT NULL,
+  url varchar(255) NOT NULL UNIQUE,
+  description text,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE status_contain_attachment (
+  status_id bigint NOT NULL,
+  attachment_id bigint NOT NULL,
+  PRIMARY KEY (status_id, attachment_id),
+  CONSTRAINT fk_status_id FOREIGN KEY (status_id) REFERENCES status (id),
+  CONSTRAINT fk_attachment_id FOREIGN KEY (attachment_id) REFERENCES attachment (id)
+);
@@ -0,0 +1,10 @@
+ALTER TABLE status_contain_attachment
+  DROP CONSTRAINT uq_attachment_id;
+
+DROP INDEX idx_attachment_account_id;
+
+ALTER TABLE attachment
+  DROP CONSTRAINT fk_attachment_account_id,
+  DROP COLUMN account_id,
+  DROP COLUMN create_at,
+  DROP COLUMN detached_at;
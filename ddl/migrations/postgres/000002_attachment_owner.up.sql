@@ -0,0 +1,28 @@
+ALTER TABLE attachment
+  ADD COLUMN account_id bigint,
+  ADD COLUMN create_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD COLUMN detached_at timestamp;
+
+-- 同じattachmentを使う投稿が複数あれば、最初の投稿にだけ残す
+DELETE FROM status_contain_attachment AS sca
+USING status_contain_attachment AS earlier
+WHERE earlier.attachment_id = sca.attachment_id
+  AND earlier.status_id < sca.status_id;
+
+-- 投稿に使われているattachmentは投稿者のものとする
+UPDATE attachment AS a
+SET account_id = s.account_id
+FROM status_contain_attachment AS sca
+  INNER JOIN status AS s ON s.id = sca.status_id
+WHERE sca.attachment_id = a.id;
+
+-- 投稿者の分からない未使用のattachmentは外したものとして、ファイルごと回収させる
+UPDATE attachment SET detached_at = CURRENT_TIMESTAMP WHERE account_id IS NULL;
+
+ALTER TABLE attachment
+  ADD CONSTRAINT fk_attachment_account_id FOREIGN KEY (account_id) REFERENCES account (id);
+
+CREATE INDEX idx_attachment_account_id ON attachment (account_id);
+
+ALTER TABLE status_contain_attachment
+  ADD CONSTRAINT uq_attachment_id UNIQUE (attachment_id);
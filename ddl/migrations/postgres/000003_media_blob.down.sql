@@ -0,0 +1,6 @@
+ALTER TABLE attachment
+  DROP CONSTRAINT fk_attachment_blob_hash,
+  DROP COLUMN blob_hash,
+  ADD CONSTRAINT attachment_url_key UNIQUE (url);
+
+DROP TABLE media_blob;
@@ -0,0 +1,12 @@
+CREATE TABLE media_blob (
+  hash char(64) NOT NULL,
+  size bigint NOT NULL,
+  ref_count int NOT NULL DEFAULT 0,
+  create_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (hash)
+);
+
+ALTER TABLE attachment
+  DROP CONSTRAINT attachment_url_key,
+  ADD COLUMN blob_hash char(64),
+  ADD CONSTRAINT fk_attachment_blob_hash FOREIGN KEY (blob_hash) REFERENCES media_blob (hash);
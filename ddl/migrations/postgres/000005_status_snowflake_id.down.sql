@@ -0,0 +1,5 @@
+CREATE SEQUENCE status_id_seq OWNED BY status.id;
+
+SELECT setval('status_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM status;
+
+ALTER TABLE status ALTER COLUMN id SET DEFAULT nextval('status_id_seq');
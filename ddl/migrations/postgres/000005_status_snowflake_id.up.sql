@@ -0,0 +1,4 @@
+-- statusのIDはアプリケーションで生成する
+ALTER TABLE status ALTER COLUMN id DROP DEFAULT;
+
+DROP SEQUENCE status_id_seq;
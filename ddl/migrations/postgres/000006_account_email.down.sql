@@ -0,0 +1,8 @@
+DROP TABLE confirmation_token;
+
+ALTER TABLE account
+  DROP CONSTRAINT uq_account_email,
+  DROP COLUMN email,
+  DROP COLUMN state,
+  DROP COLUMN email_confirmed_at,
+  DROP COLUMN approved_at;
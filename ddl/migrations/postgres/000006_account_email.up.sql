@@ -0,0 +1,18 @@
+-- 既存のアカウントはメールアドレスなしで有効なままとする
+ALTER TABLE account
+  ADD COLUMN email varchar(255),
+  ADD COLUMN state varchar(16) NOT NULL DEFAULT 'confirmed',
+  ADD COLUMN email_confirmed_at timestamp,
+  ADD COLUMN approved_at timestamp,
+  ADD CONSTRAINT uq_account_email UNIQUE (email);
+
+CREATE TABLE confirmation_token (
+  token_hash varchar(64) NOT NULL,
+  account_id bigint NOT NULL,
+  expires_at timestamp NOT NULL,
+  create_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (token_hash),
+  CONSTRAINT fk_confirmation_token_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+CREATE INDEX idx_confirmation_token_account_id ON confirmation_token (account_id);
@@ -0,0 +1,9 @@
+DROP INDEX idx_relation_follower_id;
+
+DROP INDEX idx_relation_following_id;
+
+ALTER TABLE relation DROP CONSTRAINT uk_relation;
+
+ALTER TABLE relation DROP COLUMN id;
+
+ALTER TABLE relation ADD PRIMARY KEY (following_id, follower_id);
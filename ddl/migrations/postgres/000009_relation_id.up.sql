@@ -0,0 +1,10 @@
+-- フォローした順に一覧を返すため、relationに連番のIDを付ける
+ALTER TABLE relation DROP CONSTRAINT relation_pkey;
+
+ALTER TABLE relation ADD COLUMN id bigserial PRIMARY KEY;
+
+ALTER TABLE relation ADD CONSTRAINT uk_relation UNIQUE (following_id, follower_id);
+
+CREATE INDEX idx_relation_following_id ON relation (following_id, id);
+
+CREATE INDEX idx_relation_follower_id ON relation (follower_id, id);
@@ -0,0 +1,43 @@
+CREATE TABLE account (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  username varchar(255) NOT NULL UNIQUE,
+  password_hash varchar(255) NOT NULL,
+  display_name varchar(255),
+  avatar text,
+  header text,
+  note text,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE status (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  account_id bigint NOT NULL,
+  content text NOT NULL,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT fk_status_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+CREATE INDEX idx_account_id ON status (account_id);
+
+CREATE TABLE relation (
+  following_id bigint NOT NULL,
+  follower_id bigint NOT NULL,
+  PRIMARY KEY (following_id, follower_id),
+  CONSTRAINT fk_relation_following_id FOREIGN KEY (following_id) REFERENCES account (id),
+  CONSTRAINT fk_relation_follower_id FOREIGN KEY (follower_id) REFERENCES account (id)
+);
+
+CREATE TABLE attachment (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  type varchar(255) NOT NULL,
+  url varchar(255) NOT NULL UNIQUE,
+  description text
+);
+
+CREATE TABLE status_contain_attachment (
+  status_id bigint NOT NULL,
+  attachment_id bigint NOT NULL,
+  PRIMARY KEY (status_id, attachment_id),
+  CONSTRAINT fk_status_id FOREIGN KEY (status_id) REFERENCES status (id),
+  CONSTRAINT fk_attachment_id FOREIGN KEY (attachment_id) REFERENCES attachment (id)
+);
@@ -0,0 +1,15 @@
+DROP INDEX uq_attachment_id;
+
+CREATE TABLE attachment_old (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  type varchar(255) NOT NULL,
+  url varchar(255) NOT NULL UNIQUE,
+  description text
+);
+
+INSERT INTO attachment_old (id, type, url, description)
+SELECT id, type, url, description FROM attachment;
+
+DROP TABLE attachment;
+
+ALTER TABLE attachment_old RENAME TO attachment;
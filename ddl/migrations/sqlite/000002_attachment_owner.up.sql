@@ -0,0 +1,37 @@
+-- SQLiteはALTER TABLEで制約を追加できないため、テーブルを作り直す
+-- 移行前の投稿者の分からないattachmentだけはaccount_idがNULLになる
+CREATE TABLE attachment_new (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  account_id bigint,
+  type varchar(255) NOT NULL,
+  url varchar(255) NOT NULL UNIQUE,
+  description text,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  detached_at datetime,
+  CONSTRAINT fk_attachment_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+-- 同じattachmentを使う投稿が複数あれば、最初の投稿にだけ残す
+DELETE FROM status_contain_attachment
+WHERE EXISTS (
+  SELECT *
+  FROM status_contain_attachment AS earlier
+  WHERE earlier.attachment_id = status_contain_attachment.attachment_id
+    AND earlier.status_id < status_contain_attachment.status_id
+);
+
+-- 投稿に使われているattachmentは投稿者のものとし、
+-- 投稿者の分からない未使用のattachmentは外したものとして、ファイルごと回収させる
+INSERT INTO attachment_new (id, account_id, type, url, description, detached_at)
+SELECT a.id, s.account_id, a.type, a.url, a.description, CASE WHEN s.account_id IS NULL THEN CURRENT_TIMESTAMP END
+FROM attachment AS a
+  LEFT JOIN status_contain_attachment AS sca ON sca.attachment_id = a.id
+  LEFT JOIN status AS s ON s.id = sca.status_id;
+
+DROP TABLE attachment;
+
+ALTER TABLE attachment_new RENAME TO attachment;
+
+CREATE INDEX idx_attachment_account_id ON attachment (account_id);
+
+CREATE UNIQUE INDEX uq_attachment_id ON status_contain_attachment (attachment_id);
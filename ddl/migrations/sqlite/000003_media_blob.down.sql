@@ -0,0 +1,21 @@
+CREATE TABLE attachment_old (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  account_id bigint,
+  type varchar(255) NOT NULL,
+  url varchar(255) NOT NULL UNIQUE,
+  description text,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  detached_at datetime,
+  CONSTRAINT fk_attachment_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+INSERT INTO attachment_old (id, account_id, type, url, description, create_at, detached_at)
+SELECT id, account_id, type, url, description, create_at, detached_at FROM attachment;
+
+DROP TABLE attachment;
+
+ALTER TABLE attachment_old RENAME TO attachment;
+
+CREATE INDEX idx_attachment_account_id ON attachment (account_id);
+
+DROP TABLE media_blob;
@@ -0,0 +1,29 @@
+CREATE TABLE media_blob (
+  hash char(64) NOT NULL PRIMARY KEY,
+  size bigint NOT NULL,
+  ref_count int NOT NULL DEFAULT 0,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- SQLiteはALTER TABLEでUNIQUE制約を削除できないため、テーブルを作り直す
+CREATE TABLE attachment_new (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  account_id bigint,
+  type varchar(255) NOT NULL,
+  url varchar(255) NOT NULL,
+  blob_hash char(64),
+  description text,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  detached_at datetime,
+  CONSTRAINT fk_attachment_account_id FOREIGN KEY (account_id) REFERENCES account (id),
+  CONSTRAINT fk_attachment_blob_hash FOREIGN KEY (blob_hash) REFERENCES media_blob (hash)
+);
+
+INSERT INTO attachment_new (id, account_id, type, url, description, create_at, detached_at)
+SELECT id, account_id, type, url, description, create_at, detached_at FROM attachment;
+
+DROP TABLE attachment;
+
+ALTER TABLE attachment_new RENAME TO attachment;
+
+CREATE INDEX idx_attachment_account_id ON attachment (account_id);
@@ -0,0 +1,19 @@
+CREATE TABLE account_stats (
+  account_id bigint NOT NULL,
+  following_count int NOT NULL DEFAULT 0,
+  followers_count int NOT NULL DEFAULT 0,
+  statuses_count int NOT NULL DEFAULT 0,
+  last_status_at datetime,
+  PRIMARY KEY (account_id),
+  CONSTRAINT fk_account_stats_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+INSERT INTO account_stats (account_id, following_count, followers_count, statuses_count, last_status_at)
+SELECT
+  a.id,
+  (SELECT COUNT(*) FROM relation WHERE following_id = a.id),
+  (SELECT COUNT(*) FROM relation WHERE follower_id = a.id),
+  (SELECT COUNT(*) FROM status WHERE account_id = a.id),
+  (SELECT MAX(create_at) FROM status WHERE account_id = a.id)
+FROM
+  account AS a;
@@ -0,0 +1,16 @@
+CREATE TABLE status_old (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  account_id bigint NOT NULL,
+  content text NOT NULL,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT fk_status_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+INSERT INTO status_old (id, account_id, content, create_at)
+SELECT id, account_id, content, create_at FROM status;
+
+DROP TABLE status;
+
+ALTER TABLE status_old RENAME TO status;
+
+CREATE INDEX idx_account_id ON status (account_id);
@@ -0,0 +1,18 @@
+-- statusのIDはアプリケーションで生成する
+-- SQLiteはALTER TABLEでAUTOINCREMENTを外せないため、テーブルを作り直す
+CREATE TABLE status_new (
+  id integer NOT NULL PRIMARY KEY,
+  account_id bigint NOT NULL,
+  content text NOT NULL,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT fk_status_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+INSERT INTO status_new (id, account_id, content, create_at)
+SELECT id, account_id, content, create_at FROM status;
+
+DROP TABLE status;
+
+ALTER TABLE status_new RENAME TO status;
+
+CREATE INDEX idx_account_id ON status (account_id);
@@ -0,0 +1,8 @@
+DROP TABLE confirmation_token;
+
+DROP INDEX uq_account_email;
+
+ALTER TABLE account DROP COLUMN email;
+ALTER TABLE account DROP COLUMN state;
+ALTER TABLE account DROP COLUMN email_confirmed_at;
+ALTER TABLE account DROP COLUMN approved_at;
@@ -0,0 +1,18 @@
+-- 既存のアカウントはメールアドレスなしで有効なままとする
+ALTER TABLE account ADD COLUMN email varchar(255);
+ALTER TABLE account ADD COLUMN state varchar(16) NOT NULL DEFAULT 'confirmed';
+ALTER TABLE account ADD COLUMN email_confirmed_at datetime;
+ALTER TABLE account ADD COLUMN approved_at datetime;
+
+-- SQLiteはALTER TABLEでUNIQUE制約を追加できないため、インデックスにする
+CREATE UNIQUE INDEX uq_account_email ON account (email);
+
+CREATE TABLE confirmation_token (
+  token_hash varchar(64) NOT NULL PRIMARY KEY,
+  account_id bigint NOT NULL,
+  expires_at datetime NOT NULL,
+  create_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT fk_confirmation_token_account_id FOREIGN KEY (account_id) REFERENCES account (id)
+);
+
+CREATE INDEX idx_confirmation_token_account_id ON confirmation_token (account_id);
@@ -0,0 +1,3 @@
+DELETE FROM confirmation_token WHERE purpose <> 'email';
+
+ALTER TABLE confirmation_token DROP COLUMN purpose;
@@ -0,0 +1,2 @@
+-- パスワードの再設定にも同じテーブルを使う
+ALTER TABLE confirmation_token ADD COLUMN purpose varchar(16) NOT NULL DEFAULT 'email';
@@ -0,0 +1,14 @@
+CREATE TABLE relation_old (
+  following_id bigint NOT NULL,
+  follower_id bigint NOT NULL,
+  PRIMARY KEY (following_id, follower_id),
+  CONSTRAINT fk_relation_following_id FOREIGN KEY (following_id) REFERENCES account (id),
+  CONSTRAINT fk_relation_follower_id FOREIGN KEY (follower_id) REFERENCES account (id)
+);
+
+INSERT INTO relation_old (following_id, follower_id)
+SELECT following_id, follower_id FROM relation;
+
+DROP TABLE relation;
+
+ALTER TABLE relation_old RENAME TO relation;
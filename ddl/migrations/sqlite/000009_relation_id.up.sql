@@ -0,0 +1,21 @@
+-- フォローした順に一覧を返すため、relationに連番のIDを付ける
+-- SQLiteはALTER TABLEで主キーを変えられないため、テーブルを作り直す
+CREATE TABLE relation_new (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  following_id bigint NOT NULL,
+  follower_id bigint NOT NULL,
+  CONSTRAINT uk_relation UNIQUE (following_id, follower_id),
+  CONSTRAINT fk_relation_following_id FOREIGN KEY (following_id) REFERENCES account (id),
+  CONSTRAINT fk_relation_follower_id FOREIGN KEY (follower_id) REFERENCES account (id)
+);
+
+INSERT INTO relation_new (following_id, follower_id)
+SELECT following_id, follower_id FROM relation ORDER BY following_id, follower_id;
+
+DROP TABLE relation;
+
+ALTER TABLE relation_new RENAME TO relation;
+
+CREATE INDEX idx_relation_following_id ON relation (following_id, id);
+
+CREATE INDEX idx_relation_follower_id ON relation (follower_id, id);
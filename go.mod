@@ -3,13 +3,26 @@ module yatter-backend-go
 go 1.16
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/go-chi/chi v1.5.4
 	github.com/go-chi/cors v1.1.1
 	github.com/go-sql-driver/mysql v1.5.0
-	github.com/google/go-cmp v0.5.7
+	github.com/gomodule/redigo v1.8.9
+	github.com/google/go-cmp v0.5.9
 	github.com/jmoiron/sqlx v1.3.1
+	github.com/lib/pq v1.10.9
 	github.com/pkg/errors v0.9.1
+	github.com/pquerna/otp v1.5.0
+	github.com/prometheus/client_golang v1.11.1
+	github.com/rivo/uniseg v0.2.0
 	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.28.0
 )
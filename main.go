@@ -2,26 +2,154 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 
 	"yatter-backend-go/app/app"
 	"yatter-backend-go/app/config"
 	"yatter-backend-go/app/handler"
+	"yatter-backend-go/app/job"
+	"yatter-backend-go/app/logger"
+	"yatter-backend-go/app/tracing"
 )
 
 func main() {
-	log.Fatalf("%+v", serve(context.Background()))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := migrate(context.Background(), os.Args[2:]); err != nil {
+				log.Fatalf("%+v", err)
+			}
+			return
+		case "repair-counters":
+			if err := repairCounters(context.Background()); err != nil {
+				log.Fatalf("%+v", err)
+			}
+			return
+		case "approve-account":
+			if err := approveAccount(context.Background(), os.Args[2:]); err != nil {
+				log.Fatalf("%+v", err)
+			}
+			return
+		case "disable-two-factor":
+			if err := disableTwoFactor(context.Background(), os.Args[2:]); err != nil {
+				log.Fatalf("%+v", err)
+			}
+			return
+		case "config":
+			if err := configCommand(os.Args[2:]); err != nil {
+				log.Fatalf("%+v", err)
+			}
+			return
+		}
+	}
+
+	if err := serve(context.Background(), os.Args[1:]); err != nil {
+		log.Fatalf("%+v", err)
+	}
 }
 
-func serve(ctx context.Context) error {
-	app, err := app.NewApp()
+func serve(ctx context.Context, args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+
+	// SIGINT/SIGTERMで受け付けを止め、処理中のリクエストを待ってから終了する
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.SetDefault(logger.New(os.Stderr, logger.Format(cfg.Log.Format), cfg.Log.ParsedLevel()))
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Exporter)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	app, err := app.NewApp(cfg)
 	if err != nil {
 		return err
 	}
-	addr := ":" + strconv.Itoa(config.Port())
-	log.Printf("Serve on http://%s", addr)
+	defer func() {
+		if err := app.Close(); err != nil {
+			logger.Default().Error("close app", "error", err)
+		}
+	}()
+
+	// バックグラウンドの処理はctxが終わると止まる
+	var workers sync.WaitGroup
+	gc := job.NewAttachmentGC(app.Dao, cfg.Media.GCInterval, cfg.Media.MaxAge)
+	purge := job.NewAccountPurge(app.Dao, cfg.Accounts.PurgeInterval)
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		gc.Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		purge.Run(ctx)
+	}()
+	// 終了時は止めて待ってからDBを閉じる
+	defer workers.Wait()
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           handler.NewRouter(app),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	errc := make(chan error, 2)
+	go func() {
+		logger.Default().Info("serve", "addr", "http://"+srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	// メトリクスはAPIとは別のアドレスで公開する
+	var admin *http.Server
+	if cfg.Server.AdminAddr != "" {
+		admin = &http.Server{
+			Addr:              cfg.Server.AdminAddr,
+			Handler:           handler.NewAdminRouter(),
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		}
+		go func() {
+			logger.Default().Info("serve admin", "addr", "http://"+admin.Addr)
+			errc <- admin.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
 
-	return http.ListenAndServe(addr, handler.NewRouter(app))
+	timeout := cfg.Server.ShutdownTimeout
+	logger.Default().Info("shut down", "timeout", timeout)
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if admin != nil {
+		if err := admin.Shutdown(sctx); err != nil {
+			return fmt.Errorf("shutdown admin: %w", err)
+		}
+	}
+	// リクエストが終わってから、残りのメールを送り切る
+	if err := app.Shutdown(sctx); err != nil {
+		return fmt.Errorf("shutdown app: %w", err)
+	}
+	return nil
 }
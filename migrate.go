@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"yatter-backend-go/app/config"
+	"yatter-backend-go/app/dao"
+	"yatter-backend-go/app/migration"
+	"yatter-backend-go/ddl"
+)
+
+const migrateUsage = `Usage: yatter-backend-go migrate <command>
+
+Commands:
+  up             Apply all pending migrations
+  down [N]       Revert the latest N migrations (default 1)
+  status         Show applied and pending migrations
+  create NAME    Create up/down files of a new migration for every driver
+  baseline [V]   Record migrations up to version V (default 1) as applied without running them,
+                 for a database created from the old ddl.sql
+  force V [pending]
+                 Record migration V, which failed halfway and has been fixed by hand,
+                 as applied (or as pending)
+`
+
+// Handle `migrate` subcommand
+func migrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := fs.String("dir", ddl.MigrationsDir, "directory containing migration files of each driver")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), migrateUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing migrate command")
+	}
+
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	if command == "create" {
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: migrate create NAME")
+		}
+		// 全てのドライバに同じバージョンのファイルを作る
+		for _, driver := range ddl.Drivers {
+			up, down, err := migration.Create(filepath.Join(*dir, driver), rest[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created %s\nCreated %s\n", up, down)
+		}
+		return nil
+	}
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return err
+	}
+	dbCfg := cfg.Database.Primary()
+	db, err := dao.Open(dbCfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrations, err := ddl.Migrations(dbCfg.DriverName())
+	if err != nil {
+		return err
+	}
+	m, err := migration.New(db, migrations)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, a := range applied {
+			fmt.Printf("Applied %06d_%s\n", a.Version, a.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(rest) > 0 {
+			if steps, err = strconv.Atoi(rest[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", rest[0])
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		for _, r := range reverted {
+			fmt.Printf("Reverted %06d_%s\n", r.Version, r.Name)
+		}
+		return err
+	case "baseline":
+		var version int64 = 1
+		if len(rest) > 0 {
+			if version, err = strconv.ParseInt(rest[0], 10, 64); err != nil || version < 1 {
+				return fmt.Errorf("invalid version %q", rest[0])
+			}
+		}
+		recorded, err := m.Baseline(ctx, version)
+		for _, b := range recorded {
+			fmt.Printf("Recorded %06d_%s as applied\n", b.Version, b.Name)
+		}
+		return err
+	case "force":
+		if len(rest) < 1 || len(rest) > 2 || (len(rest) == 2 && rest[1] != "pending") {
+			return fmt.Errorf("usage: migrate force VERSION [pending]")
+		}
+		version, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", rest[0])
+		}
+		return m.Force(ctx, version, len(rest) == 1)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Dirty {
+				appliedAt = "dirty (failed halfway)"
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
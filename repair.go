@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/config"
+)
+
+// Handle `repair-counters` subcommand.
+// Counters in account_stats are updated along with statuses and relations,
+// so this is only needed after editing those tables by hand.
+func repairCounters(ctx context.Context) error {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return err
+	}
+	d, err := app.NewDao(cfg)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	n, err := d.Account().RecountStats(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Recounted stats of %d accounts", n)
+	return nil
+}
@@ -1,15 +1,16 @@
-INSERT INTO `attachment` (`type`, `url`) VALUES
-('image', 'a.png');
-
-SET @attachment_id = LAST_INSERT_ID();
-
 INSERT INTO `account` (`username`, `password_hash`) VALUES
 ('a', '$2a$10$T3C9WgYroD2SWAQegbB0qOzVC4XbqnWHHd9srL5DQ2ixbSj.Y4MDO');
 
 SET @a_id = LAST_INSERT_ID();
 
-INSERT INTO `status` (`account_id`, `content`) VALUES
-(@a_id, 'from a');
+INSERT INTO `attachment` (`account_id`, `type`, `url`) VALUES
+(@a_id, 'image', 'a.png');
+
+SET @attachment_id = LAST_INSERT_ID();
+
+-- statusのIDはアプリケーションで生成するため、ここでは明示する
+INSERT INTO `status` (`id`, `account_id`, `content`) VALUES
+(1, @a_id, 'from a');
 
 INSERT INTO `account` (`username`, `password_hash`) VALUES
 ('b', '$2a$10$T3C9WgYroD2SWAQegbB0qOzVC4XbqnWHHd9srL5DQ2ixbSj.Y4MDO');
@@ -17,14 +18,14 @@ INSERT INTO `account` (`username`, `password_hash`) VALUES
 SET @id = LAST_INSERT_ID();
 
 INSERT INTO `status_contain_attachment` (`status_id`, `attachment_id`) VALUES
-(@a_id, @attachment_id);
+(1, @attachment_id);
 
 INSERT INTO `relation` (`following_id`, `follower_id`) VALUES
 (@a_id, @id);
 
-INSERT INTO `status` (`account_id`, `content`) VALUES
-(@id, 'from b'),
-(@id, 'from b');
+INSERT INTO `status` (`id`, `account_id`, `content`) VALUES
+(2, @id, 'from b'),
+(3, @id, 'from b');
 
 INSERT INTO `account` (`username`, `password_hash`) VALUES
 ('c', '$2a$10$T3C9WgYroD2SWAQegbB0qOzVC4XbqnWHHd9srL5DQ2ixbSj.Y4MDO');
@@ -34,8 +35,8 @@ SET @id = LAST_INSERT_ID();
 INSERT INTO `relation` (`following_id`, `follower_id`) VALUES
 (@a_id, @id);
 
-INSERT INTO `status` (`account_id`, `content`) VALUES
-(@id, 'from c');
+INSERT INTO `status` (`id`, `account_id`, `content`) VALUES
+(4, @id, 'from c');
 
 INSERT INTO `account` (`username`, `password_hash`) VALUES
 ('d', '$2a$10$T3C9WgYroD2SWAQegbB0qOzVC4XbqnWHHd9srL5DQ2ixbSj.Y4MDO');
@@ -60,6 +61,17 @@ INSERT INTO `relation` (`following_id`, `follower_id`) VALUES
 (@a_id, @id),
 (@e_id, @id);
 
-INSERT INTO `status` (`account_id`, `content`) VALUES
-(@id, 'from g'),
-(@id, 'from g');
+INSERT INTO `status` (`id`, `account_id`, `content`) VALUES
+(5, @id, 'from g'),
+(6, @id, 'from g');
+
+-- 集計値を数える (yatter-backend-go repair-counters と同じ)
+INSERT INTO `account_stats` (`account_id`, `following_count`, `followers_count`, `statuses_count`, `last_status_at`)
+SELECT
+  a.id,
+  (SELECT COUNT(*) FROM relation WHERE following_id = a.id),
+  (SELECT COUNT(*) FROM relation WHERE follower_id = a.id),
+  (SELECT COUNT(*) FROM status WHERE account_id = a.id),
+  (SELECT MAX(create_at) FROM status WHERE account_id = a.id)
+FROM
+  account AS a;
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"yatter-backend-go/app/app"
+	"yatter-backend-go/app/config"
+)
+
+// Handle `disable-two-factor USERNAME` subcommand,
+// for accounts which lost both the authenticator and the recovery codes.
+func disableTwoFactor(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: disable-two-factor USERNAME")
+	}
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return err
+	}
+	d, err := app.NewDao(cfg)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	a, err := d.Primary().Account().FindByUsername(ctx, args[0])
+	if err != nil {
+		return err
+	} else if a == nil {
+		return fmt.Errorf("account %q not found", args[0])
+	}
+	if err := d.TwoFactor().Delete(ctx, a.ID); err != nil {
+		return err
+	}
+	log.Printf("Disabled two-factor authentication of account %s", a.Username)
+	return nil
+}